@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"homework10/internal/adsctl"
+	grpcPort "homework10/internal/ports/grpc"
+	"homework10/internal/tlsconfig"
+)
+
+func main() {
+	flag.Usage = func() {
+		_, _ = fmt.Fprint(flag.CommandLine.Output(), adsctl.Usage(), "\nglobal flags:\n")
+		flag.PrintDefaults()
+	}
+	configPath := flag.String("config", adsctl.DefaultConfigPath(), "path to the config with profiles")
+	profileName := flag.String("profile", "", "profile to use. by default - current_profile from the config")
+	addr := flag.String("addr", "", "service address, overrides the profile")
+	output := flag.String("o", "", "output format: table, json or yaml. overrides the profile")
+	timeout := flag.Duration("timeout", 0, "timeout of the whole command, overrides the profile")
+	ca := flag.String("ca", "", "CA to verify the service with, enables TLS. overrides the profile")
+	cert := flag.String("cert", "", "client certificate for mutual TLS. overrides the profile")
+	key := flag.String("key", "", "key of the client certificate. overrides the profile")
+	token := flag.String("token", os.Getenv("ADSCTL_TOKEN"), "bearer token of the user to act as, see the token command. by default - $ADSCTL_TOKEN, overrides the profile")
+	flag.Parse()
+
+	err := run(func(profile *adsctl.Profile) {
+		if *addr != "" {
+			profile.Address = *addr
+		}
+		if *output != "" {
+			profile.Output = *output
+		}
+		if *timeout != 0 {
+			profile.Timeout = *timeout
+		}
+		if *ca != "" {
+			profile.CAFile = *ca
+		}
+		if *cert != "" {
+			profile.CertFile = *cert
+			profile.KeyFile = *key
+		}
+		if *token != "" {
+			profile.Token = *token
+		}
+	}, *configPath, *profileName, flag.Args())
+	if err != nil {
+		if errors.Is(err, adsctl.ErrUsage) {
+			flag.Usage()
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "adsctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(override func(profile *adsctl.Profile), configPath string, profileName string, args []string) error {
+	config, err := adsctl.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	profile, err := config.Profile(profileName)
+	if err != nil {
+		return err
+	}
+	override(&profile)
+
+	printer, err := adsctl.NewPrinter(os.Stdout, profile.Output)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), profile.Timeout)
+	defer cancel()
+	if profile.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+profile.Token)
+	}
+
+	creds := insecure.NewCredentials()
+	if profile.CAFile != "" {
+		reloader, err := tlsconfig.NewReloader(tlsconfig.Files{CertFile: profile.CertFile, KeyFile: profile.KeyFile, CAFile: profile.CAFile})
+		if err != nil {
+			return err
+		}
+		creds = reloader.ClientCredentials()
+	}
+
+	conn, err := grpc.DialContext(ctx, profile.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %w", profile.Address, err)
+	}
+	defer conn.Close()
+
+	return adsctl.New(grpcPort.NewAdServiceClient(conn), printer, os.Stderr).Run(ctx, args)
+}
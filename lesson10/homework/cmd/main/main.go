@@ -2,27 +2,162 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"expvar"
+	"flag"
 	"fmt"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/baserepo"
+	"homework10/internal/adapters/cache"
 	"homework10/internal/adapters/userrepo"
+	"homework10/internal/ads"
 	"homework10/internal/app"
+	"homework10/internal/auth"
+	"homework10/internal/lifecycle"
+	"homework10/internal/ports/gateway"
 	grpcPort "homework10/internal/ports/grpc"
 	"homework10/internal/ports/httpgin"
+	"homework10/internal/tenant"
+	"homework10/internal/tlsconfig"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
+	dataDir := flag.String("data-dir", "", "directory to persist data in. by default - data is kept in memory only")
+	shards := flag.Int("shards", 0, "number of lock-striped shards of the in-memory repositories. by default - one lock per repository")
+	fsync := flag.String("fsync", "always", "fsync policy of the write-ahead log: always, interval or never")
+	tlsCert := flag.String("tls-cert", "", "certificate to serve all listeners with TLS. by default - plaintext")
+	tlsKey := flag.String("tls-key", "", "key of the certificate from -tls-cert")
+	tlsCA := flag.String("tls-ca", "", "CA of internal services. enables mutual TLS on the GRPC and gateway listeners and is used by the gateway to verify the GRPC server. without it the gateway trusts only -tls-cert")
+	identities := flag.String("grpc-identities", "", "comma separated <common name>=<service identity> pairs of GRPC callers accepted with mutual TLS. the gateway calls with -tls-cert")
+	serviceRoles := flag.String("service-roles", "", "comma separated <service identity>=<role> pairs of services that act on their own when they call without a user token. by default - services can't act, e.g. the gateway acts only for users")
+	cacheEntities := flag.String("cache", "", "comma separated entity types to cache reads of: ads, users. by default - nothing is cached")
+	cacheSize := flag.Int("cache-size", cache.DefaultSize, "number of elements and of lists cached per entity type")
+	cacheTTL := flag.Duration("cache-ttl", cache.DefaultTTL, "how long a cached read is served")
+	debugAddr := flag.String("debug-addr", "", "address to serve metrics on at /debug/vars. by default - not served")
+	tenantsConfig := flag.String("tenants", "", "YAML config of tenants served by the process. by default - a single tenant")
+	adminIDs := flag.String("admins", "", "comma separated IDs of users that are admins whatever their role is. with -tenants admins are set per tenant in the config")
+	compressMinSize := flag.Int("compress-min-size", httpgin.DefaultCompressMinSize, "size in bytes of HTTP responses that are compressed with gzip or brotli. negative - no compression")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long in-flight requests are waited for on SIGTERM before servers are stopped at once")
+	shutdownDelay := flag.Duration("shutdown-delay", 0, "how long the service keeps serving on SIGTERM after it is marked not ready, so that load balancers notice")
+	authSecret := flag.String("auth-secret-file", "", "file with the secret user tokens are verified with, tokens are issued with adsctl token. by default - requests are anonymous and operations that need a user are rejected")
+	reloadInterval := flag.Duration("tls-reload-interval", 10*time.Second, "how often certificate files are checked for rotation")
+	flag.Parse()
+
 	logger := log.Default()
 
-	a := app.NewApp(adrepo.New(), userrepo.New())
+	if *dataDir != "" && *shards != 0 {
+		logger.Fatalf("can't parse flags: -shards can't be used with -data-dir\n")
+	}
+	policy, err := baserepo.ParseSyncPolicy(*fsync)
+	if err != nil {
+		logger.Fatalf("can't parse flags: %s\n", err.Error())
+	}
+	cached, err := parseEntities(*cacheEntities)
+	if err != nil {
+		logger.Fatalf("can't parse flags: %s\n", err.Error())
+	}
+	admins, err := parseIDs(*adminIDs)
+	if err != nil {
+		logger.Fatalf("can't parse flags: %s\n", err.Error())
+	}
+	if *tenantsConfig != "" && len(admins) > 0 {
+		logger.Fatalf("can't parse flags: -admins can't be used with -tenants\n")
+	}
+	services, err := parseRoles(*serviceRoles)
+	if err != nil {
+		logger.Fatalf("can't parse flags: %s\n", err.Error())
+	}
+	if len(services) > 0 && *tlsCA == "" {
+		logger.Fatalf("can't parse flags: -service-roles needs -tls-ca\n")
+	}
+	var tokens *auth.Tokens
+	if *authSecret != "" {
+		if tokens, err = auth.LoadTokens(*authSecret); err != nil {
+			logger.Fatalf("can't load auth secret: %s\n", err.Error())
+		}
+	}
+	opts := repoOptions{
+		dataDir: *dataDir,
+		shards:  *shards,
+		sync:    policy,
+		cached:  cached,
+		cache:   cache.Options{Size: *cacheSize, TTL: *cacheTTL},
+	}
+
+	manager := lifecycle.NewManager(logger, lifecycle.Options{Delay: *shutdownDelay})
+	closers := make([]io.Closer, 0)
+	var tenants *tenant.Registry
+	if *tenantsConfig == "" {
+		a, repoClosers, err := newApp(opts, "", app.WithAdmins(admins...), app.WithServices(services))
+		if err != nil {
+			logger.Fatalf("can't create repositories: %s\n", err.Error())
+		}
+		closers = append(closers, repoClosers...)
+		tenants = tenant.Single(a)
+	} else {
+		config, err := tenant.LoadConfig(*tenantsConfig)
+		if err != nil {
+			logger.Fatalf("can't load tenants: %s\n", err.Error())
+		}
+		tenants, err = tenant.NewRegistry(config, func(id string, t tenant.Tenant) (app.App, error) {
+			a, repoClosers, err := newApp(opts, id, app.WithLimits(t.Limits), app.WithAdmins(t.Admins...), app.WithServices(services))
+			closers = append(closers, repoClosers...)
+			return a, err
+		})
+		if err != nil {
+			logger.Fatalf("can't create tenants: %s\n", err.Error())
+		}
+	}
+
+	var reloader *tlsconfig.Reloader
+	if *tlsCert != "" {
+		var err error
+		reloader, err = tlsconfig.NewReloader(tlsconfig.Files{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA})
+		if err != nil {
+			logger.Fatalf("can't load certificates: %s\n", err.Error())
+		}
+	}
+	grpcOpts := make([]grpc.ServerOption, 0)
+	dialCreds := insecure.NewCredentials()
+	mutual := reloader != nil && *tlsCA != ""
+	if reloader != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig(mutual))))
+		if mutual {
+			ids, err := grpcPort.ParseIdentities(*identities)
+			if err != nil {
+				logger.Fatalf("can't parse flags: %s\n", err.Error())
+			}
+			grpcOpts = append(grpcOpts, grpc.ChainUnaryInterceptor(grpcPort.IdentityUnaryInterceptor(ids)),
+				grpc.ChainStreamInterceptor(grpcPort.IdentityStreamInterceptor(ids)))
+		}
+		dialCreds = reloader.ClientCredentials()
+	}
+
+	for _, closer := range closers {
+		manager.OnFlush("repository", closer.Close)
+	}
+	expvar.Publish("lifecycle", expvar.Func(func() any {
+		return manager.Stats()
+	}))
 
 	sigQuit := make(chan os.Signal, 1)
 	signal.Ignore(syscall.SIGHUP, syscall.SIGPIPE)
@@ -38,71 +173,234 @@ func main() {
 		}
 	})
 
+	// a signal or a failed server starts the shutdown of everything else
+	eg.Go(func() error {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		return manager.Shutdown(shutdownCtx)
+	})
+
+	if reloader != nil {
+		eg.Go(func() error {
+			reloader.Watch(ctx, *reloadInterval, func(err error) {
+				logger.Printf("can't reload certificates: %s\n", err.Error())
+			})
+			return nil
+		})
+	}
+
+	if *debugAddr != "" {
+		// expvar serves its variables on http.DefaultServeMux
+		debugServer := &http.Server{Addr: *debugAddr, Handler: http.DefaultServeMux}
+		eg.Go(func() error {
+			go func() {
+				<-ctx.Done()
+				_ = debugServer.Close()
+			}()
+			if err := debugServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("debug HTTP server error: %w", err)
+			}
+			return nil
+		})
+	}
+
+	httpServer := httpgin.NewTenantHTTPServer(":18080", tenants,
+		httpgin.WithCompressMinSize(*compressMinSize), httpgin.WithLifecycle(manager), httpgin.WithTokens(tokens))
+	manager.OnDrain("HTTP server", httpServer.Shutdown)
+
+	// start HTTP server
+	eg.Go(func() error {
+		logger.Println("starting HTTP server")
+		if err := listen(httpServer.Listen, httpServer.ListenTLS, reloader, false); !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("HTTP server error: %w", err)
+		}
+		return nil
+	})
+
+	// the gateway reaches the service through the GRPC listener like any other client
+	conn, err := grpc.Dial("localhost:1080", grpc.WithTransportCredentials(dialCreds))
+	if err != nil {
+		logger.Fatalf("can't dial GRPC server: %s\n", err.Error())
+		return
+	}
+	defer conn.Close()
+	gatewayServer, err := gateway.NewHTTPServer(ctx, ":18081", conn)
+	if err != nil {
+		logger.Fatalf("can't create gateway: %s\n", err.Error())
+		return
+	}
+	manager.OnDrain("gateway HTTP server", gatewayServer.Shutdown)
+
+	// start gateway HTTP server. the gateway calls GRPC as a trusted
+	// service, so with mutual TLS its clients need certificates as well
+	eg.Go(func() error {
+		logger.Println("starting gateway HTTP server")
+		if err := listen(gatewayServer.Listen, gatewayServer.ListenTLS, reloader, mutual); !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("gateway HTTP server error: %w", err)
+		}
+		return nil
+	})
+
 	lis, err := net.Listen("tcp", ":1080")
 	if err != nil {
 		logger.Fatalf("can't create listener: %s\n", err.Error())
 		return
 	}
-	grpcServer := grpcPort.NewGRPCServer(logger, a)
+	if tokens != nil {
+		grpcOpts = append(grpcOpts, grpc.ChainUnaryInterceptor(grpcPort.AuthUnaryInterceptor(tokens)))
+	}
+	grpcOpts = append(grpcOpts, grpc.ChainUnaryInterceptor(manager.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(manager.StreamServerInterceptor()))
+	grpcServer := grpcPort.NewTenantGRPCServer(logger, tenants, grpcOpts...)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	manager.OnNotReady(healthServer.Shutdown)
+	// the gateway calls through GRPC, so GRPC is stopped after it
+	manager.OnDrain("GRPC server", lifecycle.StopGRPC(grpcServer))
 
 	// start GRPC server
 	eg.Go(func() error {
 		logger.Println("starting GRPC server")
-		errCh := make(chan error)
-
-		defer func() {
-			logger.Println("stopping GRPC server")
-			grpcServer.GracefulStop()
-			lis.Close()
-			close(errCh)
-		}()
-
-		go func() {
-			if err := grpcServer.Serve(lis); err != nil {
-				errCh <- err
-			}
-		}()
-
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case err := <-errCh:
+		if err := grpcServer.Serve(lis); err != nil {
 			return fmt.Errorf("GRPC server error: %w", err)
 		}
+		return nil
 	})
 
-	httpServer := httpgin.NewHTTPServer(":18080", a)
+	if err := eg.Wait(); err != nil {
+		logger.Printf("servers shutdown: %s\n", err.Error())
+	}
+}
 
-	// start HTTP server
-	eg.Go(func() error {
-		logger.Println("starting HTTP server")
-		errCh := make(chan error)
-
-		defer func() {
-			logger.Println("stopping HTTP server")
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-			if err := httpServer.Shutdown(shutdownCtx); err != nil {
-				logger.Printf("error on HTTP server closing occurred: %s", err.Error())
-			}
-			close(errCh)
-		}()
+func listen(plain func() error, withTLS func(*tls.Config) error, reloader *tlsconfig.Reloader, requireClientCert bool) error {
+	if reloader == nil {
+		return plain()
+	}
+	return withTLS(reloader.ServerConfig(requireClientCert))
+}
 
-		go func() {
-			if err := httpServer.Listen(); !errors.Is(err, http.ErrServerClosed) {
-				errCh <- err
-			}
-		}()
+func parseEntities(s string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if s == "" {
+		return result, nil
+	}
+	for _, entity := range strings.Split(s, ",") {
+		entity = strings.TrimSpace(entity)
+		if entity != "ads" && entity != "users" {
+			return nil, fmt.Errorf("unknown entity type %q", entity)
+		}
+		result[entity] = true
+	}
+	return result, nil
+}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case err := <-errCh:
-			return fmt.Errorf("HTTP server error: %w", err)
+func parseIDs(s string) ([]int64, error) {
+	result := make([]int64, 0)
+	if s == "" {
+		return result, nil
+	}
+	for _, id := range strings.Split(s, ",") {
+		parsed, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q", id)
 		}
-	})
+		result = append(result, parsed)
+	}
+	return result, nil
+}
 
-	if err := eg.Wait(); err != nil {
-		logger.Printf("servers shutdown: %s\n", err.Error())
+type repoOptions struct {
+	dataDir string
+	shards  int
+	sync    baserepo.SyncPolicy
+	cached  map[string]bool
+	cache   cache.Options
+}
+
+// newApp creates the repositories of a tenant and an App on top of them.
+// Data of a tenant is kept in a directory named by its ID, the single
+// tenant keeps it right in the data dir.
+func newApp(opts repoOptions, id string, appOpts ...app.Option) (app.App, []io.Closer, error) {
+	var (
+		adsRepository   baserepo.Repository[*ads.Ad]
+		usersRepository baserepo.Repository[*ads.User]
+		closers         []io.Closer
+		err             error
+	)
+	switch {
+	case opts.dataDir != "":
+		dir := filepath.Join(opts.dataDir, id)
+		durableAds, err := adrepo.NewDurable(baserepo.DurableOptions{Dir: filepath.Join(dir, "ads"), Sync: opts.sync})
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't open ads repository: %w", err)
+		}
+		closers = append(closers, durableAds)
+		durableUsers, err := userrepo.NewDurable(baserepo.DurableOptions{Dir: filepath.Join(dir, "users"), Sync: opts.sync})
+		if err != nil {
+			return nil, closers, fmt.Errorf("can't open users repository: %w", err)
+		}
+		closers = append(closers, durableUsers)
+		adsRepository = durableAds
+		usersRepository = durableUsers
+	case opts.shards != 0:
+		if adsRepository, err = adrepo.NewSharded(opts.shards); err != nil {
+			return nil, nil, fmt.Errorf("can't create ads repository: %w", err)
+		}
+		if usersRepository, err = userrepo.NewSharded(opts.shards); err != nil {
+			return nil, nil, fmt.Errorf("can't create users repository: %w", err)
+		}
+	default:
+		adsRepository = adrepo.New()
+		usersRepository = userrepo.New()
+	}
+
+	prefix := "cache."
+	if id != "" {
+		prefix += id + "."
+	}
+	if opts.cached["ads"] {
+		if adsRepository, err = withCache(prefix+"ads", adsRepository, opts.cache); err != nil {
+			return nil, closers, fmt.Errorf("can't cache ads repository: %w", err)
+		}
+	}
+	if opts.cached["users"] {
+		if usersRepository, err = withCache(prefix+"users", usersRepository, opts.cache); err != nil {
+			return nil, closers, fmt.Errorf("can't cache users repository: %w", err)
+		}
+	}
+	return app.NewApp(adsRepository, usersRepository, appOpts...), closers, nil
+}
+
+// withCache puts a cache in front of repo and publishes its stats as the
+// name expvar.
+func withCache[T ads.Entity[T]](name string, repo baserepo.Repository[T], opts cache.Options) (baserepo.Repository[T], error) {
+	cached, err := cache.New(repo, opts)
+	if err != nil {
+		return nil, err
+	}
+	expvar.Publish(name, expvar.Func(func() any {
+		return cached.Stats()
+	}))
+	return cached, nil
+}
+
+func parseRoles(s string) (map[string]ads.Role, error) {
+	result := make(map[string]ads.Role)
+	if s == "" {
+		return result, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		identity, name, ok := strings.Cut(pair, "=")
+		identity = strings.TrimSpace(identity)
+		if !ok || identity == "" {
+			return nil, fmt.Errorf("invalid service role %q", pair)
+		}
+		role, err := ads.ParseRole(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		result[identity] = role
 	}
+	return result, nil
 }
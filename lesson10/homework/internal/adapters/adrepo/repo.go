@@ -2,9 +2,29 @@ package adrepo
 
 import (
 	"homework10/internal/adapters/baserepo"
+	"homework10/internal/adapters/filters"
 	"homework10/internal/ads"
 )
 
+func indexes() []baserepo.Index[*ads.Ad] {
+	return []baserepo.Index[*ads.Ad]{
+		baserepo.MultiIndex(baserepo.NameIndex, func(ad *ads.Ad) string { return ad.Title }),
+		baserepo.MultiIndex(filters.AuthorIndex, func(ad *ads.Ad) int64 { return ad.AuthorID }),
+		baserepo.IndexFunc(filters.PublishedIndex, false,
+			func(ad *ads.Ad) bool { return ad.Published },
+			func(a bool, b bool) bool { return !a && b },
+		),
+	}
+}
+
 func New() baserepo.Repository[*ads.Ad] {
-	return baserepo.New[*ads.Ad]()
+	return baserepo.New[*ads.Ad](indexes()...)
+}
+
+func NewSharded(shards int) (*baserepo.Sharded[*ads.Ad], error) {
+	return baserepo.NewSharded[*ads.Ad](shards, indexes()...)
+}
+
+func NewDurable(opts baserepo.DurableOptions) (*baserepo.Durable[*ads.Ad], error) {
+	return baserepo.NewDurable[*ads.Ad](opts, indexes()...)
 }
@@ -1,7 +1,20 @@
 package adrepo
 
-import "testing"
+import (
+	"homework10/internal/adapters/baserepo"
+	"testing"
+)
 
 func TestNew(t *testing.T) {
 	New()
 }
+
+func TestNewDurable(t *testing.T) {
+	repo, err := NewDurable(baserepo.DurableOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
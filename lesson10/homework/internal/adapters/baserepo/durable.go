@@ -0,0 +1,333 @@
+package baserepo
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"homework10/internal/ads"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.db"
+
+	DefaultSyncInterval  = time.Second
+	DefaultSnapshotEvery = 10000
+)
+
+var (
+	ErrCorruptedSnapshot = errors.New("snapshot is corrupted")
+	ErrCorruptedLog      = errors.New("log is corrupted")
+)
+
+type DurableOptions struct {
+	// Dir keeps the log and the snapshot, it is created if missing.
+	Dir  string
+	Sync SyncPolicy
+	// SyncInterval is used only with SyncInterval policy.
+	SyncInterval time.Duration
+	// SnapshotEvery is the number of log records after which the state is
+	// compacted into a new snapshot.
+	SnapshotEvery int
+}
+
+// Durable is an Impl that writes every mutation to a write-ahead log
+// before applying it, so the state survives a crash. Reads are served
+// from memory.
+type Durable[T ads.Entity[T]] struct {
+	*Impl[T]
+	opts    DurableOptions
+	mutex   sync.Mutex
+	wal     *wal
+	records int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewDurable restores the state from the snapshot and the log in opts.Dir.
+func NewDurable[T ads.Entity[T]](opts DurableOptions, indexes ...Index[T]) (*Durable[T], error) {
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = DefaultSyncInterval
+	}
+	if opts.SnapshotEvery <= 0 {
+		opts.SnapshotEvery = DefaultSnapshotEvery
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("can't create data dir: %w", err)
+	}
+
+	d := &Durable[T]{
+		Impl: newImpl(indexes...),
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := d.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	w, err := openWAL(filepath.Join(opts.Dir, walFileName), opts.Sync, func(record walRecord) error {
+		d.records++
+		return d.apply(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.wal = w
+
+	go d.background()
+	return d, nil
+}
+
+func (d *Durable[T]) apply(record walRecord) error {
+	if record.id >= d.currentId {
+		d.currentId = record.id + 1
+	}
+	switch record.op {
+	case opPut:
+		var elem T
+		if err := json.Unmarshal(record.payload, &elem); err != nil {
+			return err
+		}
+		elem.SetID(record.id)
+		d.put(elem)
+	case opDelete:
+		d.remove(record.id)
+	case opNextID:
+		d.currentId = record.id
+	default:
+		return fmt.Errorf("unknown op %d", record.op)
+	}
+	return nil
+}
+
+func (d *Durable[T]) loadSnapshot() error {
+	file, err := os.Open(filepath.Join(d.opts.Dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat snapshot: %w", err)
+	}
+	// snapshots are renamed into place only when complete, so unlike the
+	// log a damaged snapshot can't be a torn write and is reported
+	valid, err := replay(bufio.NewReader(file), d.apply)
+	if err != nil && !errors.Is(err, errCorruptedRecord) {
+		return err
+	}
+	if err != nil || valid != info.Size() {
+		return ErrCorruptedSnapshot
+	}
+	return nil
+}
+
+func (d *Durable[T]) background() {
+	defer close(d.done)
+	if d.opts.Sync != SyncInterval {
+		<-d.stop
+		return
+	}
+	ticker := time.NewTicker(d.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.mutex.Lock()
+			_ = d.wal.sync()
+			d.mutex.Unlock()
+		}
+	}
+}
+
+func (d *Durable[T]) log(record walRecord) error {
+	if err := d.wal.append(record); err != nil {
+		return err
+	}
+	d.records++
+	return nil
+}
+
+// maybeSnapshot runs after the mutation is applied, a failed compaction
+// doesn't lose anything because the log is kept.
+func (d *Durable[T]) maybeSnapshot() {
+	if d.records >= d.opts.SnapshotEvery {
+		_ = d.snapshot()
+	}
+}
+
+func (d *Durable[T]) Add(elem T) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	// only Durable writes to the embedded Impl, so under d.mutex the next
+	// ID is the one Impl.Add is going to assign
+	id := d.currentId
+	if err := d.checkIndexes(id, elem); err != nil {
+		return err
+	}
+	logged := elem.Clone()
+	logged.SetID(id)
+	payload, err := json.Marshal(logged)
+	if err != nil {
+		return err
+	}
+	if err = d.log(walRecord{op: opPut, id: id, payload: payload}); err != nil {
+		return err
+	}
+	if err = d.Impl.Add(elem); err != nil {
+		return err
+	}
+	d.maybeSnapshot()
+	return nil
+}
+
+// Update changes the element under d.mutex and logs it before it is
+// stored.
+func (d *Durable[T]) Update(id int64, change func(elem T) error) (T, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	// only Durable writes to the embedded Impl, so under d.mutex the element
+	// can't change until it is replaced
+	elem, err := d.Impl.FindByID(id)
+	if err != nil {
+		return getZeroValue[T](), err
+	}
+	if err = change(elem); err != nil {
+		return getZeroValue[T](), err
+	}
+	elem.SetID(id)
+	if err = d.checkIndexes(id, elem); err != nil {
+		return getZeroValue[T](), err
+	}
+	payload, err := json.Marshal(elem)
+	if err != nil {
+		return getZeroValue[T](), err
+	}
+	if err = d.log(walRecord{op: opPut, id: id, payload: payload}); err != nil {
+		return getZeroValue[T](), err
+	}
+	if err = d.Impl.replace(elem); err != nil {
+		return getZeroValue[T](), err
+	}
+	d.maybeSnapshot()
+	return elem, nil
+}
+
+func (d *Durable[T]) DeleteById(id int64) (T, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, err := d.Impl.FindByID(id); err != nil {
+		return getZeroValue[T](), err
+	}
+	if err := d.log(walRecord{op: opDelete, id: id}); err != nil {
+		return getZeroValue[T](), err
+	}
+	elem, err := d.Impl.DeleteById(id)
+	if err != nil {
+		return getZeroValue[T](), err
+	}
+	d.maybeSnapshot()
+	return elem, nil
+}
+
+// Snapshot writes the whole state to a new snapshot and empties the log.
+func (d *Durable[T]) Snapshot() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.snapshot()
+}
+
+func (d *Durable[T]) snapshot() error {
+	path := filepath.Join(d.opts.Dir, snapshotFileName)
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("can't create snapshot: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	if err = d.writeSnapshot(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("can't sync snapshot: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("can't close snapshot: %w", err)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("can't replace snapshot: %w", err)
+	}
+	if err = syncDir(d.opts.Dir); err != nil {
+		return err
+	}
+	// replaying records already in the snapshot is harmless, so a crash
+	// before the reset only costs time on the next start
+	if err = d.wal.reset(); err != nil {
+		return err
+	}
+	d.records = 0
+	return nil
+}
+
+func (d *Durable[T]) writeSnapshot(w io.Writer) error {
+	d.Impl.mutex.RLock()
+	defer d.Impl.mutex.RUnlock()
+
+	buffered := bufio.NewWriter(w)
+	if _, err := buffered.Write(walRecord{op: opNextID, id: d.currentId}.encode()); err != nil {
+		return fmt.Errorf("can't write snapshot: %w", err)
+	}
+	ids := make([]int64, 0, len(d.idToElem))
+	for id := range d.idToElem {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		payload, err := json.Marshal(d.idToElem[id])
+		if err != nil {
+			return err
+		}
+		if _, err = buffered.Write(walRecord{op: opPut, id: id, payload: payload}.encode()); err != nil {
+			return fmt.Errorf("can't write snapshot: %w", err)
+		}
+	}
+	return buffered.Flush()
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("can't open data dir: %w", err)
+	}
+	defer file.Close()
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("can't sync data dir: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the log to disk, the repository must not be used after it.
+func (d *Durable[T]) Close() error {
+	close(d.stop)
+	<-d.done
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.wal.close()
+}
@@ -0,0 +1,238 @@
+package baserepo
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openDurable(t *testing.T, opts DurableOptions) *Durable[*TestType] {
+	repo, err := NewDurable[*TestType](opts)
+	assert.NoError(t, err)
+	return repo
+}
+
+func state(repo *Durable[*TestType]) map[int64]string {
+	result := make(map[int64]string)
+	for id, elem := range repo.idToElem {
+		result[id] = elem.Name
+	}
+	return result
+}
+
+// recordEnds returns the offset right after every record in the file.
+func recordEnds(t *testing.T, path string) []int64 {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	ends := make([]int64, 0)
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		_, n, err := readRecord(reader)
+		if err == io.EOF {
+			return ends
+		}
+		assert.NoError(t, err)
+		offset += n
+		ends = append(ends, offset)
+	}
+}
+
+func TestDurableReplay(t *testing.T) {
+	opts := DurableOptions{Dir: t.TempDir()}
+	repo := openDurable(t, opts)
+
+	for _, name := range []string{"a", "b", "c"} {
+		assert.NoError(t, repo.Add(&TestType{Name: name}))
+	}
+	assert.NoError(t, update(repo, &TestType{ID: 1, Name: "bb"}))
+	_, err := repo.DeleteById(0)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, update(repo, &TestType{ID: 0, Name: "a"}), ErrNotFound)
+	assert.NoError(t, repo.Close())
+
+	repo = openDurable(t, opts)
+	assert.Equal(t, map[int64]string{1: "bb", 2: "c"}, state(repo))
+
+	entity := &TestType{Name: "d"}
+	assert.NoError(t, repo.Add(entity))
+	assert.Equal(t, int64(3), entity.ID)
+
+	elem, err := repo.FindByName("bb")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), elem.ID)
+	assert.NoError(t, repo.Close())
+}
+
+func TestDurableSnapshot(t *testing.T) {
+	opts := DurableOptions{Dir: t.TempDir(), SnapshotEvery: 3}
+	repo := openDurable(t, opts)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, repo.Add(&TestType{Name: name}))
+	}
+	_, err := repo.DeleteById(3)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(opts.Dir, snapshotFileName))
+	assert.NoError(t, err)
+	assert.Len(t, recordEnds(t, filepath.Join(opts.Dir, walFileName)), 2)
+	assert.NoError(t, repo.Close())
+
+	repo = openDurable(t, opts)
+	assert.Equal(t, map[int64]string{0: "a", 1: "b", 2: "c"}, state(repo))
+	assert.NoError(t, repo.Snapshot())
+	assert.Empty(t, recordEnds(t, filepath.Join(opts.Dir, walFileName)))
+
+	entity := &TestType{Name: "e"}
+	assert.NoError(t, repo.Add(entity))
+	assert.Equal(t, int64(4), entity.ID, "deleted IDs are not reused after a snapshot")
+	assert.NoError(t, repo.Close())
+}
+
+func TestDurableTruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	repo := openDurable(t, DurableOptions{Dir: dir})
+	assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+	assert.NoError(t, repo.Add(&TestType{Name: "b"}))
+	assert.NoError(t, update(repo, &TestType{ID: 0, Name: "aa"}))
+	_, err := repo.DeleteById(1)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Close())
+
+	walPath := filepath.Join(dir, walFileName)
+	data, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	ends := recordEnds(t, walPath)
+	expected := []map[int64]string{
+		{},
+		{0: "a"},
+		{0: "a", 1: "b"},
+		{0: "aa", 1: "b"},
+		{0: "aa"},
+	}
+
+	// simulate a crash at every byte of the log
+	for cut := 0; cut <= len(data); cut++ {
+		complete := 0
+		for complete < len(ends) && ends[complete] <= int64(cut) {
+			complete++
+		}
+
+		crashDir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(crashDir, walFileName), data[:cut], 0o644))
+
+		repo = openDurable(t, DurableOptions{Dir: crashDir})
+		assert.Equal(t, expected[complete], state(repo), "cut at %d", cut)
+
+		// the torn tail is dropped, so new records are readable after it
+		assert.NoError(t, repo.Add(&TestType{Name: "new"}))
+		assert.NoError(t, repo.Close())
+
+		repo = openDurable(t, DurableOptions{Dir: crashDir})
+		_, err = repo.FindByName("new")
+		assert.NoError(t, err, "cut at %d", cut)
+		assert.NoError(t, repo.Close())
+	}
+}
+
+func TestDurableCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	repo := openDurable(t, DurableOptions{Dir: dir})
+	assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+	assert.NoError(t, repo.Add(&TestType{Name: "b"}))
+	assert.NoError(t, repo.Close())
+
+	walPath := filepath.Join(dir, walFileName)
+	data, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	assert.NoError(t, os.WriteFile(walPath, data, 0o644))
+
+	repo = openDurable(t, DurableOptions{Dir: dir})
+	assert.Equal(t, map[int64]string{0: "a"}, state(repo))
+	assert.NoError(t, repo.Close())
+}
+
+func TestDurableCorruptedLog(t *testing.T) {
+	dir := t.TempDir()
+	repo := openDurable(t, DurableOptions{Dir: dir})
+	assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+	assert.NoError(t, repo.Add(&TestType{Name: "b"}))
+	assert.NoError(t, repo.Add(&TestType{Name: "c"}))
+	assert.NoError(t, repo.Close())
+
+	walPath := filepath.Join(dir, walFileName)
+	data, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	ends := recordEnds(t, walPath)
+	// damage the payload of a record in the middle of the log
+	data[ends[1]-1] ^= 0xff
+	assert.NoError(t, os.WriteFile(walPath, data, 0o644))
+
+	_, err = NewDurable[*TestType](DurableOptions{Dir: dir})
+	assert.ErrorIs(t, err, ErrCorruptedLog)
+	kept, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	assert.Equal(t, data, kept, "valid records after the damaged one are not truncated")
+}
+
+func TestDurableCorruptedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	repo := openDurable(t, DurableOptions{Dir: dir})
+	assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+	assert.NoError(t, repo.Snapshot())
+	assert.NoError(t, repo.Close())
+
+	snapshotPath := filepath.Join(dir, snapshotFileName)
+	data, err := os.ReadFile(snapshotPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(snapshotPath, data[:len(data)-1], 0o644))
+
+	_, err = NewDurable[*TestType](DurableOptions{Dir: dir})
+	assert.ErrorIs(t, err, ErrCorruptedSnapshot)
+}
+
+func TestDurableSyncPolicies(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		opts := DurableOptions{Dir: t.TempDir(), Sync: policy, SyncInterval: time.Millisecond}
+		repo := openDurable(t, opts)
+		assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+		time.Sleep(5 * time.Millisecond)
+		assert.NoError(t, repo.Close())
+
+		repo = openDurable(t, opts)
+		assert.Equal(t, map[int64]string{0: "a"}, state(repo))
+		assert.NoError(t, repo.Close())
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	tests := []struct {
+		In     string
+		Expect SyncPolicy
+		Err    bool
+	}{
+		{In: "always", Expect: SyncAlways},
+		{In: "interval", Expect: SyncInterval},
+		{In: "never", Expect: SyncNever},
+		{In: "sometimes", Err: true},
+	}
+
+	for _, test := range tests {
+		policy, err := ParseSyncPolicy(test.In)
+		if test.Err {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.Expect, policy)
+	}
+}
@@ -0,0 +1,46 @@
+package baserepo
+
+import "sync"
+
+type EventType int
+
+const (
+	EventAdd EventType = iota
+	EventUpdate
+	EventDelete
+)
+
+// Event tells which element a successful write changed.
+type Event struct {
+	Type EventType
+	ID   int64
+}
+
+// Hook is called right after a write under the lock of the element, so
+// events of an element come in the order of writes. It has to be quick, safe
+// for concurrent use and must not use the repository.
+type Hook func(Event)
+
+// Observable is implemented by repositories that report their writes.
+type Observable interface {
+	Subscribe(hook Hook)
+}
+
+type hooks struct {
+	mutex sync.RWMutex
+	list  []Hook
+}
+
+func (h *hooks) subscribe(hook Hook) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.list = append(h.list, hook)
+}
+
+func (h *hooks) emit(event Event) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, hook := range h.list {
+		hook(event)
+	}
+}
@@ -0,0 +1,52 @@
+package baserepo
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	tests := []struct {
+		Name string
+		Repo func(t *testing.T) Repository[*TestType]
+	}{
+		{Name: "impl", Repo: func(*testing.T) Repository[*TestType] { return New[*TestType]() }},
+		{Name: "sharded", Repo: func(t *testing.T) Repository[*TestType] { return newSharded(t, 2) }},
+		{Name: "durable", Repo: func(t *testing.T) Repository[*TestType] {
+			repo := openDurable(t, DurableOptions{Dir: t.TempDir(), Sync: SyncNever})
+			t.Cleanup(func() { _ = repo.Close() })
+			return repo
+		}},
+	}
+
+	for _, test := range tests {
+		repo := test.Repo(t)
+		mutex := &sync.Mutex{}
+		events := make([]Event, 0)
+		observable, ok := repo.(Observable)
+		assert.True(t, ok, test.Name)
+		observable.Subscribe(func(event Event) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			events = append(events, event)
+		})
+
+		assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+		assert.NoError(t, repo.Add(&TestType{Name: "b"}))
+		assert.NoError(t, update(repo, &TestType{ID: 1, Name: "c"}))
+		assert.Error(t, update(repo, &TestType{ID: 2}), "failed writes are not reported")
+		_, err := repo.DeleteById(0)
+		assert.NoError(t, err)
+		_, err = repo.FindByID(1)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []Event{
+			{Type: EventAdd, ID: 0},
+			{Type: EventAdd, ID: 1},
+			{Type: EventUpdate, ID: 1},
+			{Type: EventDelete, ID: 0},
+		}, events, test.Name)
+	}
+}
@@ -0,0 +1,182 @@
+package baserepo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/btree"
+)
+
+// NameIndex is the index FindByName looks names up in. Its keys have to be
+// strings, names are then searched as key prefixes.
+const NameIndex = "name"
+
+const indexDegree = 32
+
+var ErrDuplicate = errors.New("element with such key already exists")
+
+// Index declares a secondary index: the key extractor and whether a key may
+// belong to one element only. The index itself is built and maintained on
+// every mutation by the repository it is passed to.
+type Index[T any] interface {
+	Name() string
+	Unique() bool
+	newStore() indexStore[T]
+}
+
+type indexDef[T any, K any] struct {
+	name   string
+	unique bool
+	key    func(T) K
+	less   func(K, K) bool
+}
+
+func (d indexDef[T, K]) Name() string {
+	return d.name
+}
+
+func (d indexDef[T, K]) Unique() bool {
+	return d.unique
+}
+
+func (d indexDef[T, K]) newStore() indexStore[T] {
+	return &treeStore[T, K]{
+		def: d,
+		tree: btree.NewG(indexDegree, func(a, b indexItem[T, K]) bool {
+			if d.less(a.key, b.key) {
+				return true
+			}
+			if d.less(b.key, a.key) {
+				return false
+			}
+			return a.id < b.id
+		}),
+		keys: make(map[int64]K),
+	}
+}
+
+// UniqueIndex allows a key to belong to one element only, adding another
+// one fails with ErrDuplicate.
+func UniqueIndex[T any, K btree.Ordered](name string, key func(T) K) Index[T] {
+	return IndexFunc(name, true, key, btree.Less[K]())
+}
+
+// MultiIndex allows any number of elements with the same key.
+func MultiIndex[T any, K btree.Ordered](name string, key func(T) K) Index[T] {
+	return IndexFunc(name, false, key, btree.Less[K]())
+}
+
+// IndexFunc declares an index over keys ordered by less.
+func IndexFunc[T any, K any](name string, unique bool, key func(T) K, less func(K, K) bool) Index[T] {
+	return indexDef[T, K]{name: name, unique: unique, key: key, less: less}
+}
+
+// indexStore keeps every element with its key, sorted by key and then by
+// ID, so reads through the index don't have to go to the main map.
+type indexStore[T any] interface {
+	// check returns ErrDuplicate if elem would break the uniqueness of the index.
+	check(id int64, elem T) error
+	put(id int64, elem T)
+	remove(id int64)
+	// lookup returns the elements with key in the order of IDs, ok is false
+	// if key is of another type.
+	lookup(key any) (elems []T, ok bool)
+	// ascend calls iter for every element in the order of keys.
+	ascend(iter func(id int64, elem T) bool)
+	// ascendPrefix calls iter for elements with string keys starting with
+	// prefix, it returns false if keys are not strings.
+	ascendPrefix(prefix string, iter func(id int64, elem T) bool) bool
+	len() int
+}
+
+type indexItem[T any, K any] struct {
+	key  K
+	id   int64
+	elem T
+}
+
+type treeStore[T any, K any] struct {
+	def  indexDef[T, K]
+	tree *btree.BTreeG[indexItem[T, K]]
+	// keys remembers what every element was indexed by, so it is removed
+	// by ID only
+	keys map[int64]K
+}
+
+func (s *treeStore[T, K]) check(id int64, elem T) error {
+	if !s.def.unique {
+		return nil
+	}
+	key := s.def.key(elem)
+	var err error
+	s.tree.AscendGreaterOrEqual(indexItem[T, K]{key: key, id: math.MinInt64}, func(item indexItem[T, K]) bool {
+		if s.def.less(key, item.key) {
+			return false
+		}
+		if item.id != id {
+			err = fmt.Errorf("%w: %s=%v", ErrDuplicate, s.def.name, key)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+func (s *treeStore[T, K]) put(id int64, elem T) {
+	s.remove(id)
+	key := s.def.key(elem)
+	s.tree.ReplaceOrInsert(indexItem[T, K]{key: key, id: id, elem: elem})
+	s.keys[id] = key
+}
+
+func (s *treeStore[T, K]) remove(id int64) {
+	key, ok := s.keys[id]
+	if !ok {
+		return
+	}
+	s.tree.Delete(indexItem[T, K]{key: key, id: id})
+	delete(s.keys, id)
+}
+
+func (s *treeStore[T, K]) lookup(key any) ([]T, bool) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, false
+	}
+	elems := make([]T, 0)
+	s.tree.AscendGreaterOrEqual(indexItem[T, K]{key: k, id: math.MinInt64}, func(item indexItem[T, K]) bool {
+		if s.def.less(k, item.key) {
+			return false
+		}
+		elems = append(elems, item.elem)
+		return true
+	})
+	return elems, true
+}
+
+func (s *treeStore[T, K]) ascend(iter func(id int64, elem T) bool) {
+	s.tree.Ascend(func(item indexItem[T, K]) bool {
+		return iter(item.id, item.elem)
+	})
+}
+
+func (s *treeStore[T, K]) ascendPrefix(prefix string, iter func(id int64, elem T) bool) bool {
+	k, ok := any(prefix).(K)
+	if !ok {
+		return false
+	}
+	s.tree.AscendGreaterOrEqual(indexItem[T, K]{key: k, id: math.MinInt64}, func(item indexItem[T, K]) bool {
+		key, ok := any(item.key).(string)
+		if !ok || !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		return iter(item.id, item.elem)
+	})
+	return true
+}
+
+func (s *treeStore[T, K]) len() int {
+	return s.tree.Len()
+}
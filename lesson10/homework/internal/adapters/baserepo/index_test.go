@@ -0,0 +1,195 @@
+package baserepo
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/adapters/filters"
+)
+
+const groupIndex = "group"
+
+func testIndexes() []Index[*TestType] {
+	return []Index[*TestType]{
+		MultiIndex(NameIndex, func(elem *TestType) string { return elem.Name }),
+		MultiIndex(groupIndex, func(elem *TestType) int64 { return elem.Group }),
+	}
+}
+
+func groupFilter(group int64) filters.Filter[*TestType] {
+	return filters.WithIndexKey[*TestType](filters.NewDefaultFilter(func(elem *TestType) bool {
+		return elem.Group == group
+	}), groupIndex, group)
+}
+
+func byGroupFilter() filters.Filter[*TestType] {
+	return filters.WithIndexOrder[*TestType](filters.NewSortFilter(func(elem1 *TestType, elem2 *TestType) bool {
+		return elem1.Group < elem2.Group
+	}), groupIndex)
+}
+
+func names(elems []*TestType) []string {
+	result := make([]string, len(elems))
+	for i, elem := range elems {
+		result[i] = elem.Name
+	}
+	return result
+}
+
+func TestUniqueIndex(t *testing.T) {
+	repo := New[*TestType](UniqueIndex(NameIndex, func(elem *TestType) string { return elem.Name }))
+
+	assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+	assert.NoError(t, repo.Add(&TestType{Name: "b"}))
+	duplicate := &TestType{ID: -1, Name: "a"}
+	assert.ErrorIs(t, repo.Add(duplicate), ErrDuplicate)
+	assert.Equal(t, int64(-1), duplicate.ID, "a failed add doesn't change the ID")
+
+	assert.NoError(t, update(repo, &TestType{ID: 0, Name: "a"}), "an element doesn't conflict with itself")
+	assert.ErrorIs(t, update(repo, &TestType{ID: 1, Name: "a"}), ErrDuplicate)
+
+	_, err := repo.DeleteById(0)
+	assert.NoError(t, err)
+	assert.NoError(t, update(repo, &TestType{ID: 1, Name: "a"}))
+	entity := &TestType{Name: "b"}
+	assert.NoError(t, repo.Add(entity))
+	assert.Equal(t, int64(2), entity.ID, "a failed add doesn't take an ID")
+}
+
+func TestIndexFollowsUpdates(t *testing.T) {
+	repo := New[*TestType](testIndexes()...)
+	entity := &TestType{Name: "abc", Group: 1}
+	assert.NoError(t, repo.Add(entity))
+	assert.NoError(t, repo.Add(&TestType{Name: "abd", Group: 2}))
+
+	elem, err := repo.FindByName("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), elem.ID)
+	_, err = repo.FindByName("ab")
+	assert.ErrorIs(t, err, ErrNotFound, "TestType names are matched exactly")
+
+	// entities are changed in place before the update, the index still
+	// knows what to replace
+	entity.Name, entity.Group = "xyz", 2
+	assert.NoError(t, update(repo, entity))
+	_, err = repo.FindByName("abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+	elem, err = repo.FindByName("xyz")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), elem.ID)
+	assert.Equal(t, []string{"xyz", "abd"}, names(repo.GetAll(filters.Filters[*TestType]{groupFilter(2)})))
+	assert.Empty(t, repo.GetAll(filters.Filters[*TestType]{groupFilter(1)}))
+
+	_, err = repo.DeleteById(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"xyz"}, names(repo.GetAll(filters.Filters[*TestType]{groupFilter(2)})))
+	_, err = repo.FindByName("abd")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestIndexedGetAll(t *testing.T) {
+	indexed := New[*TestType](testIndexes()...)
+	plain := New[*TestType]()
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		name, group := fmt.Sprintf("name%d", random.Intn(100)), int64(random.Intn(10))
+		assert.NoError(t, indexed.Add(&TestType{Name: name, Group: group}))
+		assert.NoError(t, plain.Add(&TestType{Name: name, Group: group}))
+	}
+
+	tests := []struct {
+		Name    string
+		Filters filters.Filters[*TestType]
+	}{
+		{Name: "lookup", Filters: filters.Filters[*TestType]{groupFilter(3)}},
+		{Name: "order", Filters: filters.Filters[*TestType]{byGroupFilter()}},
+		{Name: "lookup and order", Filters: filters.Filters[*TestType]{groupFilter(3), byGroupFilter()}},
+		{Name: "missing key", Filters: filters.Filters[*TestType]{groupFilter(42)}},
+		{Name: "filter and order", Filters: filters.Filters[*TestType]{
+			filters.NewDefaultFilter(func(elem *TestType) bool { return elem.Group < 8 }),
+			byGroupFilter(),
+		}},
+	}
+
+	for _, test := range tests {
+		expected := plain.GetAll(test.Filters)
+		actual := indexed.GetAll(test.Filters)
+		assert.Equal(t, len(expected), len(actual), test.Name)
+		for i := range expected {
+			// the sort is not stable, so only the order of groups is compared
+			assert.Equal(t, expected[i].Group, actual[i].Group, test.Name)
+		}
+		if test.Name == "lookup" {
+			assert.Equal(t, expected, actual, "lookups keep the order of IDs")
+		}
+	}
+}
+
+func TestDurableIndexes(t *testing.T) {
+	opts := DurableOptions{Dir: t.TempDir()}
+	repo, err := NewDurable[*TestType](opts, UniqueIndex(NameIndex, func(elem *TestType) string { return elem.Name }))
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+	assert.ErrorIs(t, repo.Add(&TestType{Name: "a"}), ErrDuplicate)
+	assert.NoError(t, repo.Close())
+
+	repo, err = NewDurable[*TestType](opts, UniqueIndex(NameIndex, func(elem *TestType) string { return elem.Name }))
+	assert.NoError(t, err)
+	elem, err := repo.FindByName("a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), elem.ID)
+	assert.ErrorIs(t, repo.Add(&TestType{Name: "a"}), ErrDuplicate, "the rejected add was not logged")
+	assert.NoError(t, repo.Close())
+}
+
+const benchmarkSize = 1_000_000
+
+func fill(b *testing.B, repo Repository[*TestType]) {
+	for i := 0; i < benchmarkSize; i++ {
+		assert.NoError(b, repo.Add(&TestType{Name: fmt.Sprintf("name%d", i), Group: int64(i % 1000)}))
+	}
+}
+
+func benchmarkRepos(b *testing.B, run func(b *testing.B, repo Repository[*TestType])) {
+	for _, test := range []struct {
+		Name string
+		Repo func() Repository[*TestType]
+	}{
+		{Name: "scan", Repo: func() Repository[*TestType] { return New[*TestType]() }},
+		{Name: "index", Repo: func() Repository[*TestType] { return New[*TestType](testIndexes()...) }},
+	} {
+		repo := test.Repo()
+		fill(b, repo)
+		b.Run(test.Name, func(b *testing.B) {
+			run(b, repo)
+		})
+	}
+}
+
+func BenchmarkFindByName(b *testing.B) {
+	benchmarkRepos(b, func(b *testing.B, repo Repository[*TestType]) {
+		for i := 0; i < b.N; i++ {
+			_, err := repo.FindByName(fmt.Sprintf("name%d", i%benchmarkSize))
+			assert.NoError(b, err)
+		}
+	})
+}
+
+func BenchmarkGetAllLookup(b *testing.B) {
+	benchmarkRepos(b, func(b *testing.B, repo Repository[*TestType]) {
+		for i := 0; i < b.N; i++ {
+			assert.Len(b, repo.GetAll(filters.Filters[*TestType]{groupFilter(int64(i % 1000))}), benchmarkSize/1000)
+		}
+	})
+}
+
+func BenchmarkGetAllOrder(b *testing.B) {
+	benchmarkRepos(b, func(b *testing.B, repo Repository[*TestType]) {
+		for i := 0; i < b.N; i++ {
+			assert.Len(b, repo.GetAll(filters.Filters[*TestType]{byGroupFilter()}), benchmarkSize)
+		}
+	})
+}
@@ -4,14 +4,22 @@ import (
 	"errors"
 	"homework10/internal/adapters/filters"
 	"homework10/internal/ads"
+	"math"
 	"sync"
 )
 
 var ErrNotFound = errors.New("element not found")
 
+// Repository keeps its own copies of elements: Add stores a clone of what it
+// is given and reads return clones, so a change to a returned element is
+// saved only by an explicit Update.
 type Repository[T any] interface {
 	GetAll(f filters.Filters[T]) []T
 	Add(elem T) error
+	// Update calls change with a clone of the element with the ID and stores
+	// the changed clone, nothing is written in between, so concurrent
+	// changes aren't lost. If change fails, the element is kept as is.
+	Update(id int64, change func(elem T) error) (T, error)
 	FindByID(id int64) (T, error)
 	FindByName(name string) (T, error)
 	DeleteById(id int64) (T, error)
@@ -22,28 +30,223 @@ func getZeroValue[T any]() T {
 	return result
 }
 
-type Impl[T ads.RepoEntityInterface] struct {
+type Impl[T ads.Entity[T]] struct {
 	currentId int64
 	idToElem  map[int64]T
+	indexes   map[string]indexStore[T]
+	hooks     *hooks
 	mutex     *sync.RWMutex
 }
 
 func (i *Impl[T]) GetAll(f filters.Filters[T]) []T {
 	i.mutex.RLock()
 	defer i.mutex.RUnlock()
-	result := make([]T, 0)
-	for j := int64(0); j < i.currentId; j++ {
-		result = append(result, i.idToElem[j])
+	result, ok := i.lookup(f)
+	if !ok && len(f) > 0 {
+		// sorting everything by an index is just walking it
+		if index, ok := i.orderIndex(f[0]); ok {
+			result = make([]T, 0, index.len())
+			index.ascend(func(_ int64, elem T) bool {
+				result = append(result, elem)
+				return true
+			})
+			return clones(i.filter(f[1:], result))
+		}
+	}
+	if !ok {
+		result = make([]T, 0, len(i.idToElem))
+		for j := int64(0); j < i.currentId; j++ {
+			if elem, ok := i.idToElem[j]; ok {
+				result = append(result, elem)
+			}
+		}
+	}
+	return clones(i.filter(f, result))
+}
+
+// clones replaces elems with their clones in place.
+func clones[T ads.Entity[T]](elems []T) []T {
+	for j, elem := range elems {
+		elems[j] = elem.Clone()
+	}
+	return elems
+}
+
+func (i *Impl[T]) filter(f filters.Filters[T], elems []T) []T {
+	for _, filter := range f {
+		if ordered, ok := i.orderByIndex(filter, elems); ok {
+			elems = ordered
+			continue
+		}
+		elems = filter.Filter(elems)
+	}
+	return elems
+}
+
+// lookup narrows the elements down with the first filter backed by an
+// index key. The filter is still applied afterwards, the index may be
+// coarser than it.
+func (i *Impl[T]) lookup(f filters.Filters[T]) ([]T, bool) {
+	for _, filter := range f {
+		indexed, ok := filter.(filters.Indexed)
+		if !ok {
+			continue
+		}
+		key, ok := indexed.IndexKey()
+		if !ok {
+			continue
+		}
+		index, ok := i.indexes[indexed.IndexName()]
+		if !ok {
+			continue
+		}
+		if result, ok := index.lookup(key); ok {
+			return result, true
+		}
+	}
+	return nil, false
+}
+
+func (i *Impl[T]) orderIndex(filter filters.Filter[T]) (indexStore[T], bool) {
+	indexed, ok := filter.(filters.Indexed)
+	if !ok {
+		return nil, false
+	}
+	if _, ok = indexed.IndexKey(); ok {
+		return nil, false
+	}
+	index, ok := i.indexes[indexed.IndexName()]
+	return index, ok
+}
+
+// orderByIndex sorts elems by walking the index instead of comparing them,
+// which pays off unless elems are a small part of the repository.
+func (i *Impl[T]) orderByIndex(filter filters.Filter[T], elems []T) ([]T, bool) {
+	index, ok := i.orderIndex(filter)
+	if !ok || float64(index.len()) > float64(len(elems))*math.Log2(float64(len(elems))+1) {
+		return nil, false
+	}
+
+	positions := make(map[int64]int, len(elems))
+	for j, elem := range elems {
+		positions[elem.GetID()] = j
+	}
+	if len(positions) != len(elems) {
+		return nil, false
+	}
+	result := make([]T, 0, len(elems))
+	index.ascend(func(id int64, _ T) bool {
+		if j, ok := positions[id]; ok {
+			result = append(result, elems[j])
+		}
+		return len(result) < len(elems)
+	})
+	if len(result) != len(elems) {
+		return nil, false
+	}
+	return result, true
+}
+
+// checkIndexes returns ErrDuplicate if elem with the ID conflicts with
+// another element in a unique index.
+func (i *Impl[T]) checkIndexes(id int64, elem T) error {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.checkAs(id, elem)
+}
+
+func (i *Impl[T]) check(elem T) error {
+	return i.checkAs(elem.GetID(), elem)
+}
+
+// checkAs checks elem as if it had the ID.
+func (i *Impl[T]) checkAs(id int64, elem T) error {
+	for _, index := range i.indexes {
+		if err := index.check(id, elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Impl[T]) put(elem T) {
+	i.idToElem[elem.GetID()] = elem
+	for _, index := range i.indexes {
+		index.put(elem.GetID(), elem)
+	}
+}
+
+func (i *Impl[T]) remove(id int64) {
+	delete(i.idToElem, id)
+	for _, index := range i.indexes {
+		index.remove(id)
 	}
-	return f.Filter(result)
 }
 
 func (i *Impl[T]) Add(elem T) error {
 	i.mutex.Lock()
 	defer i.mutex.Unlock()
+	if err := i.checkAs(i.currentId, elem); err != nil {
+		return err
+	}
 	elem.SetID(i.currentId)
-	i.idToElem[elem.GetID()] = elem
+	i.put(elem.Clone())
 	i.currentId += 1
+	i.hooks.emit(Event{Type: EventAdd, ID: elem.GetID()})
+	return nil
+}
+
+// insert adds elem under the ID allocated for it.
+func (i *Impl[T]) insert(id int64, elem T) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if err := i.checkAs(id, elem); err != nil {
+		return err
+	}
+	elem.SetID(id)
+	i.put(elem.Clone())
+	i.hooks.emit(Event{Type: EventAdd, ID: elem.GetID()})
+	return nil
+}
+
+// Update changes the element with the ID under the lock, it returns
+// ErrNotFound if there is no such element.
+func (i *Impl[T]) Update(id int64, change func(elem T) error) (T, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	stored, ok := i.idToElem[id]
+	if !ok {
+		return getZeroValue[T](), ErrNotFound
+	}
+	elem := stored.Clone()
+	if err := change(elem); err != nil {
+		return getZeroValue[T](), err
+	}
+	// change can't move the element to another ID
+	elem.SetID(id)
+	if err := i.update(elem); err != nil {
+		return getZeroValue[T](), err
+	}
+	return elem, nil
+}
+
+// replace replaces the stored element with the ID of elem by a clone of
+// elem, it returns ErrNotFound if there is no such element.
+func (i *Impl[T]) replace(elem T) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if _, ok := i.idToElem[elem.GetID()]; !ok {
+		return ErrNotFound
+	}
+	return i.update(elem)
+}
+
+func (i *Impl[T]) update(elem T) error {
+	if err := i.check(elem); err != nil {
+		return err
+	}
+	i.put(elem.Clone())
+	i.hooks.emit(Event{Type: EventUpdate, ID: elem.GetID()})
 	return nil
 }
 
@@ -54,15 +257,33 @@ func (i *Impl[T]) FindByID(id int64) (T, error) {
 	if !ok {
 		return getZeroValue[T](), ErrNotFound
 	}
-	return elem, nil
+	return elem.Clone(), nil
 }
 
+// FindByName searches names as prefixes of NameIndex keys if there is such
+// an index, otherwise it goes through every element.
 func (i *Impl[T]) FindByName(name string) (T, error) {
 	i.mutex.RLock()
 	defer i.mutex.RUnlock()
+	if index, ok := i.indexes[NameIndex]; ok {
+		var result T
+		found := false
+		ok = index.ascendPrefix(name, func(_ int64, elem T) bool {
+			if elem.HasName(name) {
+				result, found = elem, true
+			}
+			return !found
+		})
+		if ok && found {
+			return result.Clone(), nil
+		}
+		if ok {
+			return getZeroValue[T](), ErrNotFound
+		}
+	}
 	for _, elem := range i.idToElem {
 		if elem.HasName(name) {
-			return elem, nil
+			return elem.Clone(), nil
 		}
 	}
 	return getZeroValue[T](), ErrNotFound
@@ -75,14 +296,30 @@ func (i *Impl[T]) DeleteById(id int64) (T, error) {
 	if !ok {
 		return getZeroValue[T](), ErrNotFound
 	}
-	delete(i.idToElem, id)
+	// nothing refers to the removed element anymore, it is given away as is
+	i.remove(id)
+	i.hooks.emit(Event{Type: EventDelete, ID: id})
 	return elem, nil
 }
 
-func New[T ads.RepoEntityInterface]() Repository[T] {
-	return &Impl[T]{
+func (i *Impl[T]) Subscribe(hook Hook) {
+	i.hooks.subscribe(hook)
+}
+
+func New[T ads.Entity[T]](indexes ...Index[T]) Repository[T] {
+	return newImpl(indexes...)
+}
+
+func newImpl[T ads.Entity[T]](indexes ...Index[T]) *Impl[T] {
+	impl := &Impl[T]{
 		currentId: 0,
 		idToElem:  make(map[int64]T),
+		indexes:   make(map[string]indexStore[T], len(indexes)),
+		hooks:     &hooks{},
 		mutex:     new(sync.RWMutex),
 	}
+	for _, index := range indexes {
+		impl.indexes[index.Name()] = index.newStore()
+	}
+	return impl
 }
@@ -0,0 +1,196 @@
+package baserepo
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"pgregory.net/rapid"
+
+	"homework10/internal/adapters/filters"
+)
+
+// model is what a repository is expected to hold: values by ID and the next
+// ID to be given out.
+type model struct {
+	elems  map[int64]TestType
+	nextID int64
+}
+
+func (m *model) list(keep func(TestType) bool) []TestType {
+	result := make([]TestType, 0)
+	for _, elem := range m.elems {
+		if keep(elem) {
+			result = append(result, elem)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+func values(t *rapid.T, elems []*TestType) []TestType {
+	result := make([]TestType, len(elems))
+	for i, elem := range elems {
+		if elem == nil {
+			t.Fatalf("nil element at %d", i)
+		}
+		result[i] = *elem
+	}
+	return result
+}
+
+func equal(t *rapid.T, what string, expect []TestType, got []TestType) {
+	if len(expect) != len(got) {
+		t.Fatalf("%s: expect %d elements got %d: %v", what, len(expect), len(got), got)
+	}
+	for i := range expect {
+		if expect[i] != got[i] {
+			t.Fatalf("%s: expect %v got %v at %d", what, expect[i], got[i], i)
+		}
+	}
+}
+
+// checkRepository runs random interleavings of adds, updates, deletes and
+// reads against a fresh repository and compares it with the model after
+// every step. Returned elements are scribbled over to make sure they are
+// copies.
+func checkRepository(t *testing.T, newRepo func(t *rapid.T) (Repository[*TestType], func())) {
+	rapid.Check(t, func(t *rapid.T) {
+		repo, cleanup := newRepo(t)
+		defer cleanup()
+		m := &model{elems: make(map[int64]TestType)}
+
+		// IDs up to a few past the last given one, so missing and deleted
+		// IDs are drawn too
+		anyID := func() int64 {
+			return rapid.Int64Range(0, m.nextID+2).Draw(t, "id")
+		}
+		group := rapid.Int64Range(0, 3)
+		name := rapid.StringMatching(`[ab]{1,3}`)
+
+		steps := rapid.IntRange(1, 50).Draw(t, "steps")
+		for step := 0; step < steps; step++ {
+			switch rapid.SampledFrom([]string{"add", "update", "delete", "find", "list"}).Draw(t, "action") {
+			case "add":
+				elem := &TestType{ID: -1, Name: name.Draw(t, "name"), Group: group.Draw(t, "group")}
+				if err := repo.Add(elem); err != nil {
+					t.Fatalf("add: %v", err)
+				}
+				if elem.ID != m.nextID {
+					t.Fatalf("add: expect ID %d got %d", m.nextID, elem.ID)
+				}
+				m.elems[elem.ID] = *elem
+				m.nextID++
+				elem.Name = "changed after add"
+			case "update":
+				elem := &TestType{ID: anyID(), Name: name.Draw(t, "name"), Group: group.Draw(t, "group")}
+				err := update(repo, elem)
+				if _, ok := m.elems[elem.ID]; !ok {
+					if err != ErrNotFound {
+						t.Fatalf("update of missing %d: %v", elem.ID, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("update: %v", err)
+				}
+				m.elems[elem.ID] = *elem
+				elem.Name = "changed after update"
+			case "delete":
+				id := anyID()
+				elem, err := repo.DeleteById(id)
+				expect, ok := m.elems[id]
+				if !ok {
+					if err != ErrNotFound {
+						t.Fatalf("delete of missing %d: %v", id, err)
+					}
+					continue
+				}
+				if err != nil || *elem != expect {
+					t.Fatalf("delete %d: expect %v got %v, %v", id, expect, elem, err)
+				}
+				delete(m.elems, id)
+			case "find":
+				id := anyID()
+				elem, err := repo.FindByID(id)
+				expect, ok := m.elems[id]
+				if !ok {
+					if err != ErrNotFound {
+						t.Fatalf("find of missing %d: %v", id, err)
+					}
+					continue
+				}
+				if err != nil || *elem != expect {
+					t.Fatalf("find %d: expect %v got %v, %v", id, expect, elem, err)
+				}
+				elem.Name = "changed after find"
+			case "list":
+				for _, elem := range repo.GetAll(nil) {
+					elem.Name = "changed after list"
+				}
+			}
+
+			equal(t, "all", m.list(func(TestType) bool { return true }), values(t, repo.GetAll(nil)))
+			g := group.Draw(t, "filter group")
+			equal(t, "lookup", m.list(func(elem TestType) bool { return elem.Group == g }),
+				values(t, repo.GetAll(filters.Filters[*TestType]{groupFilter(g)})))
+			ordered := m.list(func(TestType) bool { return true })
+			sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Group < ordered[j].Group })
+			equal(t, "order", ordered, values(t, repo.GetAll(filters.Filters[*TestType]{byGroupFilter()})))
+		}
+	})
+}
+
+func TestRepositoryProperties(t *testing.T) {
+	tests := []struct {
+		Name string
+		Repo func(t *rapid.T) (Repository[*TestType], func())
+	}{
+		{
+			Name: "impl",
+			Repo: func(*rapid.T) (Repository[*TestType], func()) {
+				return New[*TestType](), func() {}
+			},
+		},
+		{
+			Name: "indexed",
+			Repo: func(*rapid.T) (Repository[*TestType], func()) {
+				return New[*TestType](testIndexes()...), func() {}
+			},
+		},
+		{
+			Name: "sharded",
+			Repo: func(t *rapid.T) (Repository[*TestType], func()) {
+				repo, err := NewSharded(rapid.IntRange(1, 4).Draw(t, "shards"), testIndexes()...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return repo, func() {}
+			},
+		},
+		{
+			Name: "durable",
+			Repo: func(t *rapid.T) (Repository[*TestType], func()) {
+				dir, err := os.MkdirTemp("", "durable")
+				if err != nil {
+					t.Fatal(err)
+				}
+				repo, err := NewDurable(DurableOptions{Dir: dir, Sync: SyncNever}, testIndexes()...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return repo, func() {
+					_ = repo.Close()
+					_ = os.RemoveAll(dir)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			checkRepository(t, test.Repo)
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package baserepo
 
 import (
-	"github.com/stretchr/testify/assert"
+	"errors"
+	"sync"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 type TestType struct {
-	ID   int64
-	Name string
+	ID    int64
+	Name  string
+	Group int64
 }
 
 func (t *TestType) GetID() int64 {
@@ -18,10 +22,24 @@ func (t *TestType) SetID(ID int64) {
 	t.ID = ID
 }
 
+func (t *TestType) Clone() *TestType {
+	clone := *t
+	return &clone
+}
+
 func (t *TestType) HasName(name string) bool {
 	return t.Name == name
 }
 
+// update replaces the element with the ID of elem by elem.
+func update(repo Repository[*TestType], elem *TestType) error {
+	_, err := repo.Update(elem.ID, func(stored *TestType) error {
+		*stored = *elem
+		return nil
+	})
+	return err
+}
+
 func TestAdd(t *testing.T) {
 	repo := New[*TestType]()
 
@@ -78,3 +96,67 @@ func TestFindByName(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "a", entity.Name)
 }
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		Name string
+		Repo func(t *testing.T) Repository[*TestType]
+	}{
+		{Name: "impl", Repo: func(*testing.T) Repository[*TestType] { return New[*TestType](testIndexes()...) }},
+		{Name: "sharded", Repo: func(t *testing.T) Repository[*TestType] { return newSharded(t, 2) }},
+		{Name: "durable", Repo: func(t *testing.T) Repository[*TestType] {
+			repo := openDurable(t, DurableOptions{Dir: t.TempDir(), Sync: SyncNever})
+			t.Cleanup(func() { _ = repo.Close() })
+			return repo
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			repo := test.Repo(t)
+			assert.NoError(t, repo.Add(&TestType{Name: "a"}))
+
+			// every change is made to the element as the previous one left it
+			wg := sync.WaitGroup{}
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						_, err := repo.Update(0, func(elem *TestType) error {
+							elem.Group++
+							return nil
+						})
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+			elem, err := repo.FindByID(0)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(800), elem.Group)
+
+			errChange := errors.New("change failed")
+			_, err = repo.Update(0, func(elem *TestType) error {
+				elem.Name = "b"
+				return errChange
+			})
+			assert.ErrorIs(t, err, errChange)
+			elem, err = repo.FindByID(0)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", elem.Name, "a failed change isn't stored")
+
+			updated, err := repo.Update(0, func(elem *TestType) error {
+				elem.ID, elem.Name = 5, "c"
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, &TestType{ID: 0, Name: "c", Group: 800}, updated, "change can't move the element")
+			_, err = repo.FindByID(5)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			_, err = repo.Update(1, func(*TestType) error { return nil })
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package baserepo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"homework10/internal/adapters/filters"
+	"homework10/internal/ads"
+)
+
+const DefaultShards = 16
+
+var ErrUnsupportedIndex = errors.New("index is not supported")
+
+// Sharded spreads elements over shards by ID, every shard is an Impl with
+// its own lock, so writers of different shards don't wait for each other.
+// IDs are allocated atomically without any lock.
+type Sharded[T ads.Entity[T]] struct {
+	nextID int64
+	shards []*Impl[T]
+}
+
+// NewSharded creates a repository with the given number of shards,
+// DefaultShards if it is not positive. Unique indexes are rejected: two shards can't check a key
+// against each other without a common lock.
+func NewSharded[T ads.Entity[T]](shards int, indexes ...Index[T]) (*Sharded[T], error) {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	for _, index := range indexes {
+		if index.Unique() {
+			return nil, fmt.Errorf("%w: unique index %s in a sharded repository", ErrUnsupportedIndex, index.Name())
+		}
+	}
+	s := &Sharded[T]{
+		shards: make([]*Impl[T], shards),
+	}
+	for i := range s.shards {
+		s.shards[i] = newImpl(indexes...)
+	}
+	return s, nil
+}
+
+func (s *Sharded[T]) shard(id int64) *Impl[T] {
+	if id < 0 {
+		id = -id
+	}
+	return s.shards[id%int64(len(s.shards))]
+}
+
+// GetAll read-locks every shard before collecting elements, so the result
+// is a consistent snapshot of all shards at once.
+func (s *Sharded[T]) GetAll(f filters.Filters[T]) []T {
+	for _, shard := range s.shards {
+		shard.mutex.RLock()
+	}
+	result := s.collect(f)
+	for _, shard := range s.shards {
+		shard.mutex.RUnlock()
+	}
+	// stored elements are never changed, so they are filtered unlocked
+	return clones(f.Filter(result))
+}
+
+func (s *Sharded[T]) collect(f filters.Filters[T]) []T {
+	result := make([]T, 0)
+	found := true
+	for _, shard := range s.shards {
+		elems, ok := shard.lookup(f)
+		if !ok {
+			found = false
+			break
+		}
+		result = append(result, elems...)
+	}
+	if found && len(f) > 0 {
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].GetID() < result[j].GetID()
+		})
+		return result
+	}
+
+	result = result[:0]
+	// IDs allocated by writers still waiting for their shard are skipped,
+	// those writes are not done yet
+	nextID := atomic.LoadInt64(&s.nextID)
+	for id := int64(0); id < nextID; id++ {
+		if elem, ok := s.shard(id).idToElem[id]; ok {
+			result = append(result, elem)
+		}
+	}
+	return result
+}
+
+func (s *Sharded[T]) Add(elem T) error {
+	id := atomic.AddInt64(&s.nextID, 1) - 1
+	return s.shard(id).insert(id, elem)
+}
+
+func (s *Sharded[T]) Update(id int64, change func(elem T) error) (T, error) {
+	return s.shard(id).Update(id, change)
+}
+
+func (s *Sharded[T]) FindByID(id int64) (T, error) {
+	return s.shard(id).FindByID(id)
+}
+
+func (s *Sharded[T]) FindByName(name string) (T, error) {
+	for _, shard := range s.shards {
+		if elem, err := shard.FindByName(name); err == nil {
+			return elem, nil
+		}
+	}
+	return getZeroValue[T](), ErrNotFound
+}
+
+func (s *Sharded[T]) DeleteById(id int64) (T, error) {
+	return s.shard(id).DeleteById(id)
+}
+
+// Subscribe adds hook to every shard, so it is called concurrently for
+// elements of different shards.
+func (s *Sharded[T]) Subscribe(hook Hook) {
+	for _, shard := range s.shards {
+		shard.Subscribe(hook)
+	}
+}
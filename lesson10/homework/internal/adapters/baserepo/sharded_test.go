@@ -0,0 +1,211 @@
+package baserepo
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/adapters/filters"
+)
+
+func newSharded(t testing.TB, shards int, indexes ...Index[*TestType]) *Sharded[*TestType] {
+	repo, err := NewSharded(shards, indexes...)
+	assert.NoError(t, err)
+	return repo
+}
+
+func TestNewSharded(t *testing.T) {
+	_, err := NewSharded(4, UniqueIndex(NameIndex, func(elem *TestType) string { return elem.Name }))
+	assert.ErrorIs(t, err, ErrUnsupportedIndex)
+
+	repo := newSharded(t, 0)
+	assert.Len(t, repo.shards, DefaultShards)
+}
+
+func TestShardedMatchesImpl(t *testing.T) {
+	impl := New[*TestType](testIndexes()...)
+	sharded := newSharded(t, 4, testIndexes()...)
+
+	for i := 0; i < 100; i++ {
+		for _, repo := range []Repository[*TestType]{impl, sharded} {
+			elem := &TestType{Name: fmt.Sprintf("name%d", i), Group: int64(i % 7)}
+			assert.NoError(t, repo.Add(elem))
+			assert.Equal(t, int64(i), elem.ID)
+		}
+	}
+	for _, repo := range []Repository[*TestType]{impl, sharded} {
+		assert.NoError(t, update(repo, &TestType{ID: 10, Name: "updated", Group: 3}))
+		assert.ErrorIs(t, update(repo, &TestType{ID: 100}), ErrNotFound)
+	}
+
+	tests := []struct {
+		Name    string
+		Filters filters.Filters[*TestType]
+	}{
+		{Name: "no filters"},
+		{Name: "lookup", Filters: filters.Filters[*TestType]{groupFilter(3)}},
+		{Name: "order", Filters: filters.Filters[*TestType]{byGroupFilter()}},
+		{Name: "lookup and order", Filters: filters.Filters[*TestType]{byGroupFilter(), groupFilter(3)}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, names(impl.GetAll(test.Filters)), names(sharded.GetAll(test.Filters)), test.Name)
+	}
+
+	elem, err := sharded.FindByName("updated")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), elem.ID)
+	_, err = sharded.FindByName("name10")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = sharded.DeleteById(10)
+	assert.NoError(t, err)
+	_, err = sharded.FindByID(10)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Len(t, sharded.GetAll(nil), 99, "deleted elements are skipped")
+}
+
+// stress runs writers, each of them adding, updating and deleting its own
+// elements, together with readers checking every result they get. In the
+// end the repository has to hold exactly what the writers left.
+func stress(t *testing.T, repo Repository[*TestType]) {
+	const (
+		writers    = 8
+		readers    = 4
+		operations = 2000
+		groups     = 16
+	)
+
+	var done int64
+	expected := make([]map[int64]string, writers)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			own := make(map[int64]string)
+			ids := make([]int64, 0)
+			for i := 0; i < operations; i++ {
+				name := fmt.Sprintf("w%d-%d", w, i)
+				switch op := r.Intn(4); {
+				case op < 2 || len(ids) == 0:
+					elem := &TestType{Name: name, Group: int64(w)}
+					assert.NoError(t, repo.Add(elem))
+					own[elem.ID] = name
+					ids = append(ids, elem.ID)
+				case op == 2:
+					id := ids[r.Intn(len(ids))]
+					assert.NoError(t, update(repo, &TestType{ID: id, Name: name, Group: int64(w)}))
+					own[id] = name
+				default:
+					j := r.Intn(len(ids))
+					_, err := repo.DeleteById(ids[j])
+					assert.NoError(t, err)
+					delete(own, ids[j])
+					ids[j] = ids[len(ids)-1]
+					ids = ids[:len(ids)-1]
+				}
+			}
+			expected[w] = own
+		}(w)
+	}
+
+	readersWg := &sync.WaitGroup{}
+	for r := 0; r < readers; r++ {
+		readersWg.Add(1)
+		go func(r int) {
+			defer readersWg.Done()
+			for atomic.LoadInt64(&done) == 0 {
+				group := int64(r % writers)
+				elems := repo.GetAll(filters.Filters[*TestType]{groupFilter(group)})
+				for j, elem := range elems {
+					if !assert.NotNil(t, elem) {
+						return
+					}
+					assert.Equal(t, group, elem.Group)
+					if j > 0 {
+						assert.Less(t, elems[j-1].ID, elem.ID, "IDs are ascending and unique")
+					}
+				}
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	atomic.StoreInt64(&done, 1)
+	readersWg.Wait()
+
+	seen := make(map[int64]bool)
+	for w, own := range expected {
+		elems := repo.GetAll(filters.Filters[*TestType]{groupFilter(int64(w))})
+		assert.Len(t, elems, len(own))
+		for _, elem := range elems {
+			assert.Equal(t, own[elem.ID], elem.Name)
+			assert.False(t, seen[elem.ID], "ID %d is given out twice", elem.ID)
+			seen[elem.ID] = true
+		}
+	}
+}
+
+func TestStress(t *testing.T) {
+	t.Run("impl", func(t *testing.T) {
+		stress(t, New[*TestType](testIndexes()...))
+	})
+	t.Run("sharded", func(t *testing.T) {
+		stress(t, newSharded(t, 8, testIndexes()...))
+	})
+}
+
+func parallelRepos(b *testing.B, run func(b *testing.B, repo Repository[*TestType])) {
+	for _, test := range []struct {
+		Name string
+		Repo func() Repository[*TestType]
+	}{
+		{Name: "impl", Repo: func() Repository[*TestType] { return New[*TestType](testIndexes()...) }},
+		{Name: "sharded", Repo: func() Repository[*TestType] { return newSharded(b, DefaultShards, testIndexes()...) }},
+	} {
+		b.Run(test.Name, func(b *testing.B) {
+			run(b, test.Repo())
+		})
+	}
+}
+
+func BenchmarkParallelAdd(b *testing.B) {
+	parallelRepos(b, func(b *testing.B, repo Repository[*TestType]) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				_ = repo.Add(&TestType{Name: fmt.Sprintf("name%d", i), Group: int64(i % 1000)})
+			}
+		})
+	})
+}
+
+// BenchmarkParallelMixed mostly updates and reads existing elements by ID,
+// the way the ads API does.
+func BenchmarkParallelMixed(b *testing.B) {
+	const size = 100_000
+	parallelRepos(b, func(b *testing.B, repo Repository[*TestType]) {
+		for i := 0; i < size; i++ {
+			assert.NoError(b, repo.Add(&TestType{Name: fmt.Sprintf("name%d", i), Group: int64(i % 1000)}))
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			r := rand.New(rand.NewSource(rand.Int63()))
+			for pb.Next() {
+				id := r.Int63n(size)
+				switch r.Intn(10) {
+				case 0:
+					_ = repo.Add(&TestType{Name: "new", Group: id % 1000})
+				case 1, 2, 3:
+					_ = update(repo, &TestType{ID: id, Name: "updated", Group: id % 1000})
+				default:
+					_, _ = repo.FindByID(id)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,239 @@
+package baserepo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Every record in the log and in the snapshot is framed as
+//
+//	| length uint32 | crc32c uint32 | op byte | id int64 | payload ... |
+//
+// where length covers op, id and payload and the checksum is taken over the
+// same bytes. A record that is cut short or fails the checksum at the end of
+// the log was torn by a crashed process and is dropped. A damaged record
+// followed by valid ones can't be torn, the log is reported as corrupted.
+
+type walOp byte
+
+const (
+	opPut walOp = iota + 1
+	opDelete
+	opNextID
+)
+
+const (
+	recordHeaderSize     = 8
+	recordBodyHeaderSize = 9
+	maxRecordSize        = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorruptedRecord = errors.New("corrupted record")
+
+type walRecord struct {
+	op      walOp
+	id      int64
+	payload []byte
+}
+
+func (r walRecord) encode() []byte {
+	buf := make([]byte, recordHeaderSize+recordBodyHeaderSize+len(r.payload))
+	body := buf[recordHeaderSize:]
+	body[0] = byte(r.op)
+	binary.LittleEndian.PutUint64(body[1:], uint64(r.id))
+	copy(body[recordBodyHeaderSize:], r.payload)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(body, crcTable))
+	return buf
+}
+
+// readRecord returns io.EOF on a clean end of data and errCorruptedRecord
+// on a torn or damaged record.
+func readRecord(r io.Reader) (walRecord, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return walRecord{}, 0, io.EOF
+	}
+	if err != nil {
+		return walRecord{}, int64(n), tornRecord(err)
+	}
+	length := binary.LittleEndian.Uint32(header[0:])
+	checksum := binary.LittleEndian.Uint32(header[4:])
+	if length < recordBodyHeaderSize || length > maxRecordSize {
+		return walRecord{}, int64(n), errCorruptedRecord
+	}
+	body := make([]byte, length)
+	m, err := io.ReadFull(r, body)
+	if err != nil {
+		return walRecord{}, int64(n + m), tornRecord(err)
+	}
+	if crc32.Checksum(body, crcTable) != checksum {
+		return walRecord{}, int64(n + m), errCorruptedRecord
+	}
+	return walRecord{
+		op:      walOp(body[0]),
+		id:      int64(binary.LittleEndian.Uint64(body[1:])),
+		payload: body[recordBodyHeaderSize:],
+	}, int64(n + m), nil
+}
+
+func tornRecord(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errCorruptedRecord
+	}
+	return err
+}
+
+type SyncPolicy int
+
+const (
+	// SyncAlways calls fsync after every record, nothing acknowledged is lost.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval calls fsync in the background every DurableOptions.SyncInterval.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	default:
+		return 0, fmt.Errorf("unknown fsync policy: %s", s)
+	}
+}
+
+type wal struct {
+	file   *os.File
+	policy SyncPolicy
+	size   int64
+	dirty  bool
+}
+
+// openWAL replays the log through apply and truncates a torn tail so new
+// records are appended right after the last valid one.
+func openWAL(path string, policy SyncPolicy, apply func(walRecord) error) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open wal: %w", err)
+	}
+	valid, err := replay(bufio.NewReader(file), apply)
+	if errors.Is(err, errCorruptedRecord) {
+		err = checkTornTail(file, valid)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err = file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("can't truncate wal: %w", err)
+	}
+	if _, err = file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("can't seek wal: %w", err)
+	}
+	return &wal{file: file, policy: policy, size: valid}, nil
+}
+
+// replay returns the number of bytes taken by valid records, and
+// errCorruptedRecord if they are followed by a damaged one.
+func replay(r io.Reader, apply func(walRecord) error) (int64, error) {
+	var valid int64
+	for {
+		record, n, err := readRecord(r)
+		if err == io.EOF {
+			return valid, nil
+		}
+		if err != nil {
+			return valid, err
+		}
+		if err = apply(record); err != nil {
+			return valid, fmt.Errorf("can't apply record at offset %d: %w", valid, err)
+		}
+		valid += n
+	}
+}
+
+// checkTornTail returns ErrCorruptedLog if a valid record follows the
+// damaged one at offset. A crash tears only the record being appended, so
+// the tail can't be longer than one record.
+func checkTornTail(file *os.File, offset int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat wal: %w", err)
+	}
+	size := info.Size() - offset
+	if size > recordHeaderSize+maxRecordSize {
+		return fmt.Errorf("%w: damaged record at offset %d", ErrCorruptedLog, offset)
+	}
+	tail := make([]byte, size)
+	if _, err = file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return fmt.Errorf("can't read wal: %w", err)
+	}
+	for i := 1; i < len(tail); i++ {
+		if _, _, err := readRecord(bytes.NewReader(tail[i:])); err == nil {
+			return fmt.Errorf("%w: damaged record at offset %d is followed by valid ones", ErrCorruptedLog, offset)
+		}
+	}
+	return nil
+}
+
+func (w *wal) append(record walRecord) error {
+	data := record.encode()
+	if _, err := w.file.Write(data); err != nil {
+		// cut the partial record off, otherwise replay would stop at it
+		// and drop every record appended later
+		_ = w.file.Truncate(w.size)
+		_, _ = w.file.Seek(w.size, io.SeekStart)
+		return fmt.Errorf("can't write wal: %w", err)
+	}
+	w.size += int64(len(data))
+	if w.policy == SyncAlways {
+		return w.file.Sync()
+	}
+	w.dirty = true
+	return nil
+}
+
+func (w *wal) sync() error {
+	if !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.file.Sync()
+}
+
+func (w *wal) reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("can't truncate wal: %w", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("can't seek wal: %w", err)
+	}
+	w.size = 0
+	w.dirty = false
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type Stats struct {
+	Hits          int64
+	Misses        int64
+	Loads         int64
+	Evictions     int64
+	Expirations   int64
+	Invalidations int64
+}
+
+func (s Stats) add(other Stats) Stats {
+	return Stats{
+		Hits:          s.Hits + other.Hits,
+		Misses:        s.Misses + other.Misses,
+		Loads:         s.Loads + other.Loads,
+		Evictions:     s.Evictions + other.Evictions,
+		Expirations:   s.Expirations + other.Expirations,
+		Invalidations: s.Invalidations + other.Invalidations,
+	}
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// LRU keeps up to size values and drops the least recently used one to
+// make room for a new one. Values older than ttl are missing, zero ttl
+// keeps them until they are dropped.
+type LRU[K comparable, V any] struct {
+	mutex sync.Mutex
+	size  int
+	ttl   time.Duration
+	now   func() time.Time
+	order *list.List
+	items map[K]*list.Element
+	stats Stats
+}
+
+func NewLRU[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:  size,
+		ttl:   ttl,
+		now:   time.Now,
+		order: list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	item, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	e := item.Value.(*entry[K, V])
+	if c.ttl > 0 && !c.now().Before(e.expires) {
+		c.removeElement(item)
+		c.stats.Expirations++
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(item)
+	c.stats.Hits++
+	return e.value, true
+}
+
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.size <= 0 {
+		return
+	}
+	e := &entry[K, V]{key: key, value: value, expires: c.now().Add(c.ttl)}
+	if item, ok := c.items[key]; ok {
+		item.Value = e
+		c.order.MoveToFront(item)
+		return
+	}
+	c.items[key] = c.order.PushFront(e)
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRU[K, V]) Delete(key K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if item, ok := c.items[key]; ok {
+		c.removeElement(item)
+		c.stats.Invalidations++
+	}
+}
+
+// Purge drops every value.
+func (c *LRU[K, V]) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stats.Invalidations += int64(c.order.Len())
+	c.order.Init()
+	c.items = make(map[K]*list.Element)
+}
+
+func (c *LRU[K, V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU[K, V]) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stats
+}
+
+func (c *LRU[K, V]) removeElement(item *list.Element) {
+	c.order.Remove(item)
+	delete(c.items, item.Value.(*entry[K, V]).key)
+}
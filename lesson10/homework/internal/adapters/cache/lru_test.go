@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU[int, string](2, 0)
+	c.Set(1, "a")
+	c.Set(2, "b")
+
+	value, ok := c.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+
+	// 2 is the least recently used now
+	c.Set(3, "c")
+	_, ok = c.Get(2)
+	assert.False(t, ok)
+	for _, key := range []int{1, 3} {
+		_, ok = c.Get(key)
+		assert.True(t, ok, key)
+	}
+
+	c.Set(1, "updated")
+	value, _ = c.Get(1)
+	assert.Equal(t, "updated", value)
+	assert.Equal(t, 2, c.Len())
+
+	c.Delete(1)
+	c.Delete(1)
+	_, ok = c.Get(1)
+	assert.False(t, ok)
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+
+	assert.Equal(t, Stats{Hits: 4, Misses: 2, Evictions: 1, Invalidations: 2}, c.Stats())
+}
+
+func TestLRUTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewLRU[int, string](10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set(1, "a")
+	now = now.Add(30 * time.Second)
+	c.Set(2, "b")
+
+	tests := []struct {
+		After  time.Duration
+		Expect map[int]bool
+	}{
+		{After: 0, Expect: map[int]bool{1: true, 2: true}},
+		{After: 29 * time.Second, Expect: map[int]bool{1: true, 2: true}},
+		{After: time.Second, Expect: map[int]bool{1: false, 2: true}},
+		{After: 30 * time.Second, Expect: map[int]bool{1: false, 2: false}},
+	}
+	for _, test := range tests {
+		now = now.Add(test.After)
+		for key, expect := range test.Expect {
+			_, ok := c.Get(key)
+			assert.Equal(t, expect, ok, "key %d after %v", key, now)
+		}
+	}
+	assert.Equal(t, int64(2), c.Stats().Expirations)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRUZeroSize(t *testing.T) {
+	c := NewLRU[int, string](0, 0)
+	c.Set(1, "a")
+	_, ok := c.Get(1)
+	assert.False(t, ok)
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"homework10/internal/adapters/baserepo"
+	"homework10/internal/adapters/filters"
+	"homework10/internal/ads"
+)
+
+const (
+	DefaultSize = 10000
+	DefaultTTL  = time.Minute
+)
+
+var ErrNotObservable = errors.New("repository doesn't report writes")
+
+type Options struct {
+	// Size is the number of elements and of lists kept, each.
+	Size int
+	TTL  time.Duration
+}
+
+// Repository is a read-through cache in front of a repository. FindByID
+// and GetAll with keyed filters are served from memory until a write to the
+// repository invalidates them, concurrent misses of a key are loaded once.
+// Other calls go to the repository.
+type Repository[T ads.Entity[T]] struct {
+	baserepo.Repository[T]
+	byID  *LRU[int64, T]
+	lists *LRU[string, []T]
+	group singleflight.Group
+	loads int64
+	// generation counts writes, a value loaded before a write is not
+	// cached after it
+	mutex      sync.Mutex
+	generation int64
+}
+
+// New wraps repo, which has to be baserepo.Observable to learn about writes
+// made past the cache.
+func New[T ads.Entity[T]](repo baserepo.Repository[T], opts Options) (*Repository[T], error) {
+	observable, ok := repo.(baserepo.Observable)
+	if !ok {
+		return nil, ErrNotObservable
+	}
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	r := &Repository[T]{
+		Repository: repo,
+		byID:       NewLRU[int64, T](opts.Size, opts.TTL),
+		lists:      NewLRU[string, []T](opts.Size, opts.TTL),
+	}
+	observable.Subscribe(r.invalidate)
+	return r, nil
+}
+
+// invalidate drops the element and every list, since any write may change
+// what a list holds.
+func (r *Repository[T]) invalidate(event baserepo.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.generation++
+	r.byID.Delete(event.ID)
+	r.lists.Purge()
+}
+
+func (r *Repository[T]) currentGeneration() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.generation
+}
+
+func (r *Repository[T]) fill(generation int64, set func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.generation == generation {
+		set()
+	}
+}
+
+// load calls the repository once for all concurrent callers with the same
+// key. Callers that come after a write start a new load, so they see it.
+func (r *Repository[T]) load(key string, fn func(generation int64) (any, error)) (any, error) {
+	generation := r.currentGeneration()
+	value, err, _ := r.group.Do(fmt.Sprintf("%s@%d", key, generation), func() (any, error) {
+		atomic.AddInt64(&r.loads, 1)
+		return fn(generation)
+	})
+	return value, err
+}
+
+func (r *Repository[T]) FindByID(id int64) (T, error) {
+	if elem, ok := r.byID.Get(id); ok {
+		return elem.Clone(), nil
+	}
+	value, err := r.load(fmt.Sprintf("id:%d", id), func(generation int64) (any, error) {
+		elem, err := r.Repository.FindByID(id)
+		if err != nil {
+			return nil, err
+		}
+		r.fill(generation, func() {
+			r.byID.Set(id, elem)
+		})
+		return elem, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value.(T).Clone(), nil
+}
+
+func (r *Repository[T]) GetAll(f filters.Filters[T]) []T {
+	key, ok := f.Key()
+	if !ok {
+		return r.Repository.GetAll(f)
+	}
+	if elems, ok := r.lists.Get(key); ok {
+		return clones(elems)
+	}
+	value, _ := r.load("list:"+key, func(generation int64) (any, error) {
+		elems := r.Repository.GetAll(f)
+		r.fill(generation, func() {
+			r.lists.Set(key, elems)
+		})
+		return elems, nil
+	})
+	return clones(value.([]T))
+}
+
+func (r *Repository[T]) Stats() Stats {
+	stats := r.byID.Stats().add(r.lists.Stats())
+	stats.Loads = atomic.LoadInt64(&r.loads)
+	return stats
+}
+
+func clones[T ads.Entity[T]](elems []T) []T {
+	result := make([]T, len(elems))
+	for i, elem := range elems {
+		result[i] = elem.Clone()
+	}
+	return result
+}
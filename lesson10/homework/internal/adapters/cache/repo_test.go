@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/baserepo"
+	"homework10/internal/adapters/filters"
+	"homework10/internal/ads"
+)
+
+// blockingRepo holds FindByID and GetAll until release is closed, counting
+// the calls that reach it.
+type blockingRepo struct {
+	baserepo.Repository[*ads.Ad]
+	baserepo.Observable
+	started chan struct{}
+	release chan struct{}
+	mutex   sync.Mutex
+	calls   int
+}
+
+func newBlockingRepo() *blockingRepo {
+	repo := adrepo.New()
+	return &blockingRepo{
+		Repository: repo,
+		Observable: repo.(baserepo.Observable),
+		started:    make(chan struct{}, 100),
+		release:    make(chan struct{}),
+	}
+}
+
+func (r *blockingRepo) wait() {
+	r.mutex.Lock()
+	r.calls++
+	r.mutex.Unlock()
+	r.started <- struct{}{}
+	<-r.release
+}
+
+func (r *blockingRepo) FindByID(id int64) (*ads.Ad, error) {
+	r.wait()
+	return r.Repository.FindByID(id)
+}
+
+func (r *blockingRepo) GetAll(f filters.Filters[*ads.Ad]) []*ads.Ad {
+	r.wait()
+	return r.Repository.GetAll(f)
+}
+
+func newCached(t *testing.T, repo baserepo.Repository[*ads.Ad]) *Repository[*ads.Ad] {
+	cached, err := New(repo, Options{})
+	assert.NoError(t, err)
+	return cached
+}
+
+// update replaces the ad with the ID of ad by ad.
+func update(repo baserepo.Repository[*ads.Ad], ad *ads.Ad) error {
+	_, err := repo.Update(ad.ID, func(stored *ads.Ad) error {
+		*stored = *ad
+		return nil
+	})
+	return err
+}
+
+func published() filters.Filters[*ads.Ad] {
+	return filters.Filters[*ads.Ad]{filters.NewFilterNonPublished()}
+}
+
+func TestNotObservable(t *testing.T) {
+	_, err := New[*ads.Ad](struct{ baserepo.Repository[*ads.Ad] }{adrepo.New()}, Options{})
+	assert.ErrorIs(t, err, ErrNotObservable)
+}
+
+func TestReadThrough(t *testing.T) {
+	repo := adrepo.New()
+	cached := newCached(t, repo)
+	assert.NoError(t, cached.Add(&ads.Ad{Title: "a", Published: true}))
+
+	for i := 0; i < 3; i++ {
+		ad, err := cached.FindByID(0)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", ad.Title)
+		ad.Title = "changed by the caller"
+		assert.Len(t, cached.GetAll(published()), 1)
+	}
+	_, err := cached.FindByID(1)
+	assert.ErrorIs(t, err, baserepo.ErrNotFound)
+	assert.Equal(t, Stats{Hits: 4, Misses: 3, Loads: 3}, cached.Stats())
+
+	// filters without a key are never cached
+	cached.GetAll(filters.Filters[*ads.Ad]{filters.NewDefaultFilter(func(*ads.Ad) bool { return true })})
+	assert.Equal(t, int64(3), cached.Stats().Loads)
+}
+
+func TestInvalidation(t *testing.T) {
+	repo := adrepo.New()
+	cached := newCached(t, repo)
+	assert.NoError(t, cached.Add(&ads.Ad{Title: "a", Published: true}))
+	assert.NoError(t, cached.Add(&ads.Ad{Title: "b"}))
+
+	tests := []struct {
+		Name   string
+		Write  func()
+		Title  string
+		Listed int
+	}{
+		{
+			Name: "update through the cache",
+			Write: func() {
+				assert.NoError(t, update(cached, &ads.Ad{RepoEntity: ads.RepoEntity{ID: 0}, Title: "c", Published: true}))
+			},
+			Title:  "c",
+			Listed: 1,
+		},
+		{
+			Name: "update past the cache",
+			Write: func() {
+				assert.NoError(t, update(repo, &ads.Ad{RepoEntity: ads.RepoEntity{ID: 0}, Title: "d", Published: true}))
+			},
+			Title:  "d",
+			Listed: 1,
+		},
+		{
+			Name:   "add of another element",
+			Write:  func() { assert.NoError(t, repo.Add(&ads.Ad{Title: "e", Published: true})) },
+			Title:  "d",
+			Listed: 2,
+		},
+	}
+	for _, test := range tests {
+		_, err := cached.FindByID(0)
+		assert.NoError(t, err)
+		cached.GetAll(published())
+
+		test.Write()
+		ad, err := cached.FindByID(0)
+		assert.NoError(t, err, test.Name)
+		assert.Equal(t, test.Title, ad.Title, test.Name)
+		assert.Len(t, cached.GetAll(published()), test.Listed, test.Name)
+	}
+
+	_, err := repo.DeleteById(0)
+	assert.NoError(t, err)
+	_, err = cached.FindByID(0)
+	assert.ErrorIs(t, err, baserepo.ErrNotFound)
+}
+
+func TestSingleflight(t *testing.T) {
+	repo := newBlockingRepo()
+	assert.NoError(t, repo.Add(&ads.Ad{Title: "a"}))
+	cached := newCached(t, repo)
+
+	const callers = 50
+	wg := &sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ad, err := cached.FindByID(0)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", ad.Title)
+		}()
+	}
+	<-repo.started
+	assert.Eventually(t, func() bool { return cached.Stats().Misses == callers }, time.Second, time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, repo.calls)
+	assert.Equal(t, int64(1), cached.Stats().Loads)
+}
+
+// TestStaleLoad makes a write while a value is being loaded: the loaded
+// value may be older than the write and must not be cached.
+func TestStaleLoad(t *testing.T) {
+	repo := newBlockingRepo()
+	assert.NoError(t, repo.Add(&ads.Ad{Title: "a"}))
+	cached := newCached(t, repo)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := cached.FindByID(0)
+		assert.NoError(t, err)
+	}()
+	<-repo.started
+	assert.NoError(t, update(repo, &ads.Ad{Title: "b"}))
+	close(repo.release)
+	<-done
+
+	ad, err := cached.FindByID(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", ad.Title)
+	assert.Equal(t, 2, repo.calls)
+}
@@ -1,27 +1,66 @@
 package filters
 
-import "homework10/internal/ads"
+import (
+	"fmt"
+	"time"
+
+	"homework10/internal/ads"
+)
+
+// Indexes of an ads repository the filters below are backed by.
+const (
+	PublishedIndex = "published"
+	AuthorIndex    = "author"
+)
 
 func NewFilterNonPublished() Filter[*ads.Ad] {
-	return DefaultFilter[*ads.Ad]{
+	return WithIndexKey[*ads.Ad](DefaultFilter[*ads.Ad]{
 		condition: func(ad *ads.Ad) bool {
 			return ad.Published
 		},
-	}
+	}, PublishedIndex, true)
 }
 
 func NewFilterByAuthor() Filter[*ads.Ad] {
-	return SortFilter[*ads.Ad]{
+	return WithIndexOrder[*ads.Ad](SortFilter[*ads.Ad]{
 		comparator: func(ad1 *ads.Ad, ad2 *ads.Ad) bool {
 			return ad1.AuthorID < ad2.AuthorID
 		},
-	}
+	}, AuthorIndex)
 }
 
 func NewFilterByCreationTime() Filter[*ads.Ad] {
-	return SortFilter[*ads.Ad]{
+	return WithKey[*ads.Ad](SortFilter[*ads.Ad]{
 		comparator: func(ad1 *ads.Ad, ad2 *ads.Ad) bool {
 			return ad2.CreationTime.After(ad1.CreationTime)
 		},
+	}, "by creation time")
+}
+
+// NewFilterCreatedBetween keeps ads created in [from, to), a zero bound
+// leaves the range open on its side.
+func NewFilterCreatedBetween(from time.Time, to time.Time) Filter[*ads.Ad] {
+	return newTimeRangeFilter("created", func(ad *ads.Ad) time.Time { return ad.CreationTime }, from, to)
+}
+
+// NewFilterUpdatedBetween keeps ads last updated in [from, to), a zero bound
+// leaves the range open on its side.
+func NewFilterUpdatedBetween(from time.Time, to time.Time) Filter[*ads.Ad] {
+	return newTimeRangeFilter("updated", func(ad *ads.Ad) time.Time { return ad.LastUpdateTime }, from, to)
+}
+
+func newTimeRangeFilter(name string, field func(*ads.Ad) time.Time, from time.Time, to time.Time) Filter[*ads.Ad] {
+	return WithKey[*ads.Ad](DefaultFilter[*ads.Ad]{
+		condition: func(ad *ads.Ad) bool {
+			t := field(ad)
+			return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+		},
+	}, fmt.Sprintf("%s in [%s, %s)", name, formatBound(from), formatBound(to)))
+}
+
+func formatBound(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.UTC().Format(time.RFC3339Nano)
 }
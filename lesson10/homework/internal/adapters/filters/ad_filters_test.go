@@ -64,3 +64,40 @@ func TestFilterByCreationTime(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterCreatedBetween(t *testing.T) {
+	curTime := time.Now().UTC()
+	ad1 := &ads.Ad{CreationTime: curTime}
+	ad2 := &ads.Ad{CreationTime: curTime.Add(time.Minute)}
+	ad3 := &ads.Ad{CreationTime: curTime.Add(2 * time.Minute)}
+	in := []*ads.Ad{ad1, ad2, ad3}
+
+	tests := []struct {
+		Filter Filter[*ads.Ad]
+		Expect []*ads.Ad
+	}{
+		{Filter: NewFilterCreatedBetween(time.Time{}, time.Time{}), Expect: []*ads.Ad{ad1, ad2, ad3}},
+		{Filter: NewFilterCreatedBetween(curTime.Add(time.Minute), time.Time{}), Expect: []*ads.Ad{ad2, ad3}},
+		{Filter: NewFilterCreatedBetween(time.Time{}, curTime.Add(time.Minute)), Expect: []*ads.Ad{ad1}},
+		{Filter: NewFilterCreatedBetween(curTime, curTime.Add(2*time.Minute)), Expect: []*ads.Ad{ad1, ad2}},
+		{Filter: NewFilterCreatedBetween(curTime.Add(time.Hour), time.Time{}), Expect: []*ads.Ad{}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.Expect, test.Filter.Filter(in))
+	}
+}
+
+func TestFilterUpdatedBetween(t *testing.T) {
+	curTime := time.Now().UTC()
+	ad1 := &ads.Ad{CreationTime: curTime, LastUpdateTime: curTime.Add(time.Hour)}
+	ad2 := &ads.Ad{CreationTime: curTime, LastUpdateTime: curTime}
+
+	filter := NewFilterUpdatedBetween(curTime.Add(time.Minute), time.Time{})
+	assert.Equal(t, []*ads.Ad{ad1}, filter.Filter([]*ads.Ad{ad1, ad2}))
+
+	key, ok := Filters[*ads.Ad]{filter}.Key()
+	assert.True(t, ok)
+	other, _ := Filters[*ads.Ad]{NewFilterUpdatedBetween(curTime, time.Time{})}.Key()
+	assert.NotEqual(t, key, other, "bounds are a part of the key")
+}
@@ -1,6 +1,10 @@
 package filters
 
-import "sort"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 type Filter[T any] interface {
 	Filter([]T) []T
@@ -10,6 +14,10 @@ type DefaultFilter[T any] struct {
 	condition func(T) bool
 }
 
+func NewDefaultFilter[T any](condition func(T) bool) DefaultFilter[T] {
+	return DefaultFilter[T]{condition: condition}
+}
+
 func (f DefaultFilter[T]) Filter(arr []T) []T {
 	result := make([]T, 0, len(arr))
 	for _, elem := range arr {
@@ -41,12 +49,17 @@ type SortFilter[T any] struct {
 	comparator func(T, T) bool
 }
 
+func NewSortFilter[T any](comparator func(T, T) bool) SortFilter[T] {
+	return SortFilter[T]{comparator: comparator}
+}
+
 func (f SortFilter[T]) Filter(arr []T) []T {
 	sorter := itemsSorter[T]{
 		arr,
 		f.comparator,
 	}
-	sort.Sort(sorter)
+	// equal elements keep their order, the same as in an index walk
+	sort.Stable(sorter)
 	return sorter.arr
 }
 
@@ -58,3 +71,89 @@ func (f Filters[T]) Filter(arr []T) []T {
 	}
 	return arr
 }
+
+// Key identifies the whole chain, it is false if any of the filters has no
+// key.
+func (f Filters[T]) Key() (string, bool) {
+	keys := make([]string, len(f))
+	for i, filter := range f {
+		keyed, ok := filter.(Keyed)
+		if !ok {
+			return "", false
+		}
+		keys[i] = keyed.Key()
+	}
+	return strings.Join(keys, ","), true
+}
+
+// Keyed is implemented by filters that always keep and order elements the
+// same way, so their results may be cached by the key.
+type Keyed interface {
+	Key() string
+}
+
+type KeyedFilter[T any] struct {
+	filter Filter[T]
+	key    string
+}
+
+func (f KeyedFilter[T]) Filter(arr []T) []T {
+	return f.filter.Filter(arr)
+}
+
+func (f KeyedFilter[T]) Key() string {
+	return f.key
+}
+
+// WithKey marks filter as doing the same for the same key.
+func WithKey[T any](filter Filter[T], key string) KeyedFilter[T] {
+	return KeyedFilter[T]{filter: filter, key: key}
+}
+
+// Indexed is implemented by filters a repository can answer with one of
+// its secondary indexes instead of going through every element.
+type Indexed interface {
+	// IndexName is the index the filter is backed by.
+	IndexName() string
+	// IndexKey is the key of every element the filter keeps. Filters that
+	// only order elements by the index return false.
+	IndexKey() (any, bool)
+}
+
+type IndexedFilter[T any] struct {
+	filter Filter[T]
+	index  string
+	key    any
+	hasKey bool
+}
+
+func (f IndexedFilter[T]) Filter(arr []T) []T {
+	return f.filter.Filter(arr)
+}
+
+func (f IndexedFilter[T]) IndexName() string {
+	return f.index
+}
+
+func (f IndexedFilter[T]) IndexKey() (any, bool) {
+	return f.key, f.hasKey
+}
+
+// Key is made of the index and the key, the filter is bound to agree with
+// them.
+func (f IndexedFilter[T]) Key() string {
+	if !f.hasKey {
+		return "by " + f.index
+	}
+	return fmt.Sprintf("%s=%v", f.index, f.key)
+}
+
+// WithIndexKey marks filter as keeping exactly the elements with key in index.
+func WithIndexKey[T any](filter Filter[T], index string, key any) IndexedFilter[T] {
+	return IndexedFilter[T]{filter: filter, index: index, key: key, hasKey: true}
+}
+
+// WithIndexOrder marks filter as sorting the elements in the order of index.
+func WithIndexOrder[T any](filter Filter[T], index string) IndexedFilter[T] {
+	return IndexedFilter[T]{filter: filter, index: index}
+}
@@ -55,6 +55,26 @@ func TestFilters(t *testing.T) {
 	}
 }
 
+func TestFilters_Key(t *testing.T) {
+	condition := func(elem int) bool { return elem > 123 }
+	tests := []struct {
+		In     Filters[int]
+		Expect string
+		Ok     bool
+	}{
+		{In: Filters[int]{}, Expect: "", Ok: true},
+		{In: Filters[int]{WithKey[int](DefaultFilter[int]{condition: condition}, "big")}, Expect: "big", Ok: true},
+		{In: Filters[int]{WithIndexKey[int](DefaultFilter[int]{condition: condition}, "size", true), WithIndexOrder[int](SortFilter[int]{}, "size")}, Expect: "size=true,by size", Ok: true},
+		{In: Filters[int]{WithKey[int](DefaultFilter[int]{condition: condition}, "big"), DefaultFilter[int]{condition: condition}}, Ok: false},
+	}
+
+	for _, test := range tests {
+		key, ok := test.In.Key()
+		assert.Equal(t, test.Ok, ok)
+		assert.Equal(t, test.Expect, key)
+	}
+}
+
 func FuzzFilters_Filter(f *testing.F) {
 	condition := func(s string) bool { return len(s) > 2 }
 	filter := DefaultFilter[string]{
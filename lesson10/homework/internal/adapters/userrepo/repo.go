@@ -5,6 +5,20 @@ import (
 	"homework10/internal/ads"
 )
 
+func indexes() []baserepo.Index[*ads.User] {
+	return []baserepo.Index[*ads.User]{
+		baserepo.MultiIndex(baserepo.NameIndex, func(user *ads.User) string { return user.Nickname }),
+	}
+}
+
 func New() baserepo.Repository[*ads.User] {
-	return baserepo.New[*ads.User]()
+	return baserepo.New[*ads.User](indexes()...)
+}
+
+func NewSharded(shards int) (*baserepo.Sharded[*ads.User], error) {
+	return baserepo.NewSharded[*ads.User](shards, indexes()...)
+}
+
+func NewDurable(opts baserepo.DurableOptions) (*baserepo.Durable[*ads.User], error) {
+	return baserepo.NewDurable[*ads.User](opts, indexes()...)
 }
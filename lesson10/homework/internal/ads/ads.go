@@ -15,6 +15,11 @@ type Ad struct {
 	LastUpdateTime time.Time
 }
 
+func (ad *Ad) Clone() *Ad {
+	clone := *ad
+	return &clone
+}
+
 func (ad *Ad) HasName(name string) bool {
 	return strings.HasPrefix(ad.Title, name)
 }
@@ -31,3 +31,12 @@ func TestAd_HasName(t *testing.T) {
 		})
 	}
 }
+
+func TestAd_Clone(t *testing.T) {
+	ad := &Ad{Title: "title", Text: "text"}
+	clone := ad.Clone()
+	assert.Equal(t, ad, clone)
+
+	clone.Title = "changed"
+	assert.Equal(t, "title", ad.Title)
+}
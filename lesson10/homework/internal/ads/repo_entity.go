@@ -6,6 +6,13 @@ type RepoEntityInterface interface {
 	HasName(name string) bool
 }
 
+// Entity is what repositories keep. They store clones of added elements
+// and hand out clones too, so a stored value is never changed in place.
+type Entity[T any] interface {
+	RepoEntityInterface
+	Clone() T
+}
+
 type RepoEntity struct {
 	ID int64
 }
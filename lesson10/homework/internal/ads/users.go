@@ -1,9 +1,51 @@
 package ads
 
+import "fmt"
+
+// Role orders what a user is allowed to do, every role can do what the
+// roles below it can.
+type Role int
+
+const (
+	RoleUser Role = iota
+	RoleModerator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleUser:      "user",
+	RoleModerator: "moderator",
+	RoleAdmin:     "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+func ParseRole(s string) (Role, error) {
+	for role, name := range roleNames {
+		if name == s {
+			return role, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown role %q", s)
+}
+
 type User struct {
 	RepoEntity
 	Nickname string
 	Email    string
+	Role     Role
+	// Blocked users can't change anything.
+	Blocked bool
+}
+
+func (user *User) Clone() *User {
+	clone := *user
+	return &clone
 }
 
 func (user *User) HasName(name string) bool {
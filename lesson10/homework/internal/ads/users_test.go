@@ -25,3 +25,22 @@ func TestUser_HasName(t *testing.T) {
 		})
 	}
 }
+
+func TestUser_Clone(t *testing.T) {
+	user := &User{Nickname: "nickname", Email: "email"}
+	clone := user.Clone()
+	assert.Equal(t, user, clone)
+
+	clone.Nickname = "changed"
+	assert.Equal(t, "nickname", user.Nickname)
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []Role{RoleUser, RoleModerator, RoleAdmin} {
+		parsed, err := ParseRole(role.String())
+		assert.NoError(t, err)
+		assert.Equal(t, role, parsed)
+	}
+	_, err := ParseRole("root")
+	assert.Error(t, err)
+}
@@ -0,0 +1,297 @@
+package adsctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"gopkg.in/yaml.v3"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/app"
+	"homework10/internal/auth"
+	grpcPort "homework10/internal/ports/grpc"
+)
+
+type CLISuite struct {
+	suite.Suite
+	Ctx    context.Context
+	Cancel context.CancelFunc
+	Srv    *grpc.Server
+	Conn   *grpc.ClientConn
+	Client grpcPort.AdServiceClient
+	Out    *bytes.Buffer
+	Secret string
+	Tokens *auth.Tokens
+}
+
+func (s *CLISuite) SetupTest() {
+	s.Ctx, s.Cancel = context.WithTimeout(context.Background(), 30*time.Second)
+
+	s.Secret = filepath.Join(s.T().TempDir(), "secret")
+	s.Require().NoError(os.WriteFile(s.Secret, bytes.Repeat([]byte("s"), auth.MinSecretSize), 0o600))
+	tokens, err := auth.LoadTokens(s.Secret)
+	s.Require().NoError(err)
+	s.Tokens = tokens
+
+	lis := bufconn.Listen(1024 * 1024)
+	s.Srv = grpcPort.NewGRPCServer(log.New(&bytes.Buffer{}, "", 0), app.NewApp(adrepo.New(), userrepo.New(), app.WithAdmins(0)),
+		grpc.ChainUnaryInterceptor(grpcPort.AuthUnaryInterceptor(tokens)))
+	go func() {
+		_ = s.Srv.Serve(lis)
+	}()
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	conn, err := grpc.DialContext(s.Ctx, "", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	s.Require().NoError(err, "grpc.DialContext")
+	s.Conn = conn
+	s.Client = grpcPort.NewAdServiceClient(conn)
+	s.Out = &bytes.Buffer{}
+}
+
+func (s *CLISuite) TearDownTest() {
+	s.Conn.Close()
+	s.Srv.Stop()
+	s.Cancel()
+}
+
+func (s *CLISuite) run(format string, args ...string) error {
+	return s.runIn(s.Ctx, format, args...)
+}
+
+// runAs runs a command with the token of the user with userID, the way
+// -token does.
+func (s *CLISuite) runAs(userID int64, format string, args ...string) error {
+	token, err := s.Tokens.Issue("", userID, time.Hour)
+	s.Require().NoError(err)
+	return s.runIn(metadata.AppendToOutgoingContext(s.Ctx, "authorization", "Bearer "+token), format, args...)
+}
+
+func (s *CLISuite) runIn(ctx context.Context, format string, args ...string) error {
+	s.Out.Reset()
+	printer, err := NewPrinter(s.Out, format)
+	s.Require().NoError(err)
+	return New(s.Client, printer, &bytes.Buffer{}).Run(ctx, args)
+}
+
+func (s *CLISuite) TestUserCRUD() {
+	s.NoError(s.run(FormatJSON, "user", "create", "-nickname", "Oleg", "-email", "test@gmail.com"))
+	var user User
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &user))
+	s.Equal(User{ID: 0, Nickname: "Oleg", Email: "test@gmail.com"}, user)
+
+	s.Error(s.run(FormatYAML, "user", "update", "-id", "0", "-nickname", "Oleg1", "-email", "test1@gmail.com"))
+	s.NoError(s.runAs(0, FormatYAML, "user", "update", "-id", "0", "-nickname", "Oleg1", "-email", "test1@gmail.com"))
+	s.NoError(yaml.Unmarshal(s.Out.Bytes(), &user))
+	s.Equal("Oleg1", user.Nickname)
+
+	s.NoError(s.runAs(0, FormatJSON, "user", "update", "-id", "0", "-nickname", "Oleg2"))
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &user))
+	s.Equal(User{ID: 0, Nickname: "Oleg2", Email: "test1@gmail.com"}, user, "omitted flags keep the fields")
+	s.NoError(s.runAs(0, FormatJSON, "user", "update", "-id", "0", "-nickname", "Oleg1"))
+
+	s.NoError(s.run(FormatTable, "user", "find", "-query", "Oleg1"))
+	s.Contains(s.Out.String(), "NICKNAME")
+	s.Contains(s.Out.String(), "test1@gmail.com")
+
+	s.NoError(s.runAs(0, FormatJSON, "user", "delete", "-id", "0"))
+	s.Error(s.run(FormatJSON, "user", "get", "-id", "0"))
+}
+
+func (s *CLISuite) TestAdLifecycle() {
+	s.NoError(s.run(FormatJSON, "user", "create", "-nickname", "Oleg", "-email", "test@gmail.com"))
+	s.Error(s.run(FormatJSON, "ad", "create", "-title", "title", "-text", "text"), "ads are created by the user of the token")
+	s.NoError(s.runAs(0, FormatJSON, "ad", "create", "-title", "title", "-text", "text"))
+	s.NoError(s.runAs(0, FormatJSON, "ad", "update", "-id", "0", "-title", "title1", "-text", "text1"))
+	s.NoError(s.runAs(0, FormatJSON, "ad", "update", "-id", "0", "-text", "text2"))
+
+	var ads []Ad
+	s.NoError(s.run(FormatJSON, "ad", "list"))
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &ads))
+	s.Empty(ads)
+
+	s.NoError(s.run(FormatJSON, "ad", "list", "-all"))
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &ads))
+	s.Len(ads, 1)
+
+	s.NoError(s.runAs(0, FormatJSON, "ad", "publish", "-id", "0"))
+	var ad Ad
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &ad))
+	s.True(ad.Published)
+	s.Equal("title1", ad.Title)
+
+	s.NoError(s.run(FormatJSON, "ad", "find", "-query", "tit"))
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &ad))
+	s.Equal(int64(0), ad.ID)
+
+	s.NoError(s.runAs(0, FormatJSON, "ad", "unpublish", "-id", "0"))
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &ad))
+	s.False(ad.Published)
+
+	s.Error(s.runAs(1, FormatJSON, "ad", "delete", "-id", "0"))
+	s.NoError(s.runAs(0, FormatJSON, "ad", "delete", "-id", "0"))
+	s.Error(s.run(FormatJSON, "ad", "get", "-id", "0"))
+}
+
+func (s *CLISuite) TestAdmin() {
+	s.NoError(s.run(FormatJSON, "user", "create", "-nickname", "admin", "-email", "admin@gmail.com"))
+	s.NoError(s.run(FormatJSON, "user", "create", "-nickname", "Oleg", "-email", "test@gmail.com"))
+	s.NoError(s.runAs(1, FormatJSON, "ad", "create", "-title", "title", "-text", "text"))
+	s.NoError(s.runAs(1, FormatJSON, "ad", "publish", "-id", "0"))
+
+	s.Error(s.runAs(1, FormatJSON, "user", "role", "-id", "1", "-role", "admin"))
+	s.Error(s.runAs(1, FormatJSON, "ad", "takedown", "-id", "0"))
+	s.Error(s.run(FormatJSON, "ad", "takedown", "-id", "0"))
+	s.NoError(s.runAs(0, FormatJSON, "ad", "takedown", "-id", "0"))
+	var ad Ad
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &ad))
+	s.False(ad.Published)
+
+	s.NoError(s.runAs(0, FormatJSON, "user", "block", "-id", "1"))
+	s.Error(s.runAs(1, FormatJSON, "ad", "publish", "-id", "0"))
+	s.NoError(s.runAs(0, FormatJSON, "user", "unblock", "-id", "1"))
+	s.NoError(s.runAs(1, FormatJSON, "ad", "publish", "-id", "0"))
+
+	s.Error(s.runAs(1, FormatJSON, "user", "delete", "-id", "0"))
+	s.NoError(s.runAs(0, FormatJSON, "user", "delete", "-id", "1"))
+	s.Error(s.run(FormatJSON, "user", "get", "-id", "1"))
+}
+
+func (s *CLISuite) TestToken() {
+	s.NoError(s.run(FormatJSON, "user", "create", "-nickname", "Oleg", "-email", "test@gmail.com"))
+	s.ErrorIs(s.run(FormatJSON, "token", "-user", "0"), ErrUsage)
+
+	s.NoError(s.run(FormatJSON, "token", "-secret-file", s.Secret, "-user", "0", "-ttl", "1m"))
+	var token Token
+	s.NoError(json.Unmarshal(s.Out.Bytes(), &token))
+	s.Equal(int64(0), token.UserID)
+	subject, err := s.Tokens.Verify("", token.Token)
+	s.NoError(err)
+	s.Equal(auth.User(0), subject)
+
+	ctx := metadata.AppendToOutgoingContext(s.Ctx, "authorization", "Bearer "+token.Token)
+	s.NoError(s.runIn(ctx, FormatJSON, "user", "update", "-id", "0", "-nickname", "Oleg1"))
+}
+
+func (s *CLISuite) TestExportImport() {
+	s.NoError(s.run(FormatJSON, "user", "create", "-nickname", "Oleg", "-email", "test@gmail.com"))
+	s.NoError(s.run(FormatJSON, "user", "create", "-nickname", "Ivan", "-email", "ivan@gmail.com"))
+	s.NoError(s.runAs(1, FormatJSON, "ad", "create", "-title", "first", "-text", "text"))
+	s.NoError(s.runAs(1, FormatJSON, "ad", "create", "-title", "second", "-text", "text"))
+	s.NoError(s.runAs(1, FormatJSON, "ad", "publish", "-id", "1"))
+
+	files := []string{
+		filepath.Join(s.T().TempDir(), "dump.json"),
+		filepath.Join(s.T().TempDir(), "dump.yaml"),
+	}
+	for _, file := range files {
+		s.NoError(s.run(FormatTable, "export", "-file", file))
+
+		data, err := os.ReadFile(file)
+		s.NoError(err)
+		var dump Dump
+		s.NoError(yaml.Unmarshal(data, &dump))
+		s.Equal([]User{{ID: 1, Nickname: "Ivan", Email: "ivan@gmail.com"}}, dump.Users)
+		s.Len(dump.Ads, 2)
+	}
+
+	s.ErrorIs(s.run(FormatJSON, "import", "-file", files[0]), ErrUsage, "ads are imported with tokens of their authors")
+
+	for _, file := range files {
+		s.NoError(s.run(FormatJSON, "import", "-file", file, "-secret-file", s.Secret))
+		var imported Dump
+		s.NoError(json.Unmarshal(s.Out.Bytes(), &imported))
+		s.Len(imported.Users, 1)
+		s.Len(imported.Ads, 2)
+		for _, ad := range imported.Ads {
+			s.Equal(imported.Users[0].ID, ad.AuthorID)
+		}
+		s.False(imported.Ads[0].Published)
+		s.True(imported.Ads[1].Published)
+	}
+}
+
+func (s *CLISuite) TestImportUnknownAuthor() {
+	file := filepath.Join(s.T().TempDir(), "dump.yaml")
+	dump := Dump{
+		Users: []User{{ID: 5, Nickname: "Oleg", Email: "test@gmail.com"}},
+		Ads:   []Ad{{ID: 0, AuthorID: 5, Title: "first"}, {ID: 1, AuthorID: 0, Title: "second"}},
+	}
+	data, err := yaml.Marshal(dump)
+	s.NoError(err)
+	s.NoError(os.WriteFile(file, data, 0o644))
+
+	s.ErrorIs(s.run(FormatJSON, "import", "-file", file), ErrUnknownAuthor)
+	// nothing is imported, so the ad can't be attached to user 0 either
+	s.Error(s.run(FormatJSON, "user", "get", "-id", "0"))
+	s.Error(s.run(FormatJSON, "ad", "get", "-id", "0"))
+}
+
+func (s *CLISuite) TestUsageErrors() {
+	s.ErrorIs(s.run(FormatJSON), ErrUsage)
+	s.ErrorIs(s.run(FormatJSON, "qwe"), ErrUsage)
+	s.ErrorIs(s.run(FormatJSON, "user"), ErrUsage)
+	s.ErrorIs(s.run(FormatJSON, "ad", "qwe"), ErrUsage)
+	s.ErrorIs(s.run(FormatJSON, "ad", "get", "-id", "qwe"), ErrUsage)
+	s.ErrorIs(s.run(FormatJSON, "import"), ErrUsage)
+}
+
+func TestCLISuite(t *testing.T) {
+	suite.Run(t, new(CLISuite))
+}
+
+func TestNewPrinter(t *testing.T) {
+	for _, format := range []string{FormatTable, FormatJSON, FormatYAML} {
+		_, err := NewPrinter(&bytes.Buffer{}, format)
+		assert.NoError(t, err, format)
+	}
+	_, err := NewPrinter(&bytes.Buffer{}, "xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.NoError(t, err)
+	profile, err := config.Profile("")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{Address: DefaultAddress, Timeout: DefaultTimeout, Output: FormatTable}, profile)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte(`current_profile: prod
+profiles:
+  prod:
+    address: ads.example.com:1080
+    output: json
+    timeout: 5s
+  local: {}
+`)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	config, err = LoadConfig(path)
+	assert.NoError(t, err)
+
+	profile, err = config.Profile("")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{Address: "ads.example.com:1080", Timeout: 5 * time.Second, Output: FormatJSON}, profile)
+
+	profile, err = config.Profile("local")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAddress, profile.Address)
+
+	_, err = config.Profile("qwe")
+	assert.ErrorIs(t, err, ErrUnknownProfile)
+}
@@ -0,0 +1,411 @@
+package adsctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"gopkg.in/yaml.v3"
+
+	"homework10/internal/app"
+	"homework10/internal/auth"
+	grpcPort "homework10/internal/ports/grpc"
+)
+
+var ErrUsage = errors.New("usage error")
+
+// ErrUnknownAuthor is returned by import for an ad whose author is not in
+// the dump.
+var ErrUnknownAuthor = errors.New("author is not in the dump")
+
+const usage = `usage: adsctl [global flags] <command> [flags]
+
+commands:
+  user create   -nickname <nickname> -email <email>
+  user get      -id <user id>
+  user update   -id <user id> [-nickname <nickname>] [-email <email>]
+  user find     -query <nickname>
+  user delete   -id <user id>
+  user block    -id <user id>
+  user unblock  -id <user id>
+  user role     -id <user id> -role <user|moderator|admin>
+  ad create     -title <title> -text <text>
+  ad get        -id <ad id>
+  ad update     -id <ad id> [-title <title>] [-text <text>]
+  ad find       -query <title prefix>
+  ad delete     -id <ad id>
+  ad list       [-all] [-by-author] [-by-creation-time]
+  ad publish    -id <ad id>
+  ad unpublish  -id <ad id>
+  ad takedown   -id <ad id>
+  export        [-file <path.json|path.yaml>]
+  import        -file <path.json|path.yaml> [-secret-file <path>] [-tenant <tenant id>]
+  token         -secret-file <path> -user <user id> [-tenant <tenant id>] [-ttl <duration>]
+
+user update, delete, block, unblock, role and ad create, update, delete,
+publish, unpublish and takedown are performed by the user of the -token
+global flag, token issues one with the secret of the service. import
+creates ads as their authors with tokens it issues with -secret-file.
+`
+
+type CLI struct {
+	client  grpcPort.AdServiceClient
+	printer Printer
+	errOut  io.Writer
+}
+
+func New(client grpcPort.AdServiceClient, printer Printer, errOut io.Writer) *CLI {
+	return &CLI{
+		client:  client,
+		printer: printer,
+		errOut:  errOut,
+	}
+}
+
+func Usage() string {
+	return usage
+}
+
+func (c *CLI) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: no command given", ErrUsage)
+	}
+	switch args[0] {
+	case "user":
+		return c.runUser(ctx, args[1:])
+	case "ad":
+		return c.runAd(ctx, args[1:])
+	case "export":
+		return c.export(ctx, args[1:])
+	case "import":
+		return c.importDump(ctx, args[1:])
+	case "token":
+		return c.issueToken(args[1:])
+	default:
+		return fmt.Errorf("%w: unknown command %q", ErrUsage, args[0])
+	}
+}
+
+func (c *CLI) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.errOut)
+	return fs
+}
+
+func (c *CLI) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", ErrUsage, err.Error())
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected arguments %v", ErrUsage, fs.Args())
+	}
+	return nil
+}
+
+// updateMask lists the fields whose flags are given, so the fields left out
+// keep their values.
+func updateMask(fs *flag.FlagSet, fields ...string) *fieldmaskpb.FieldMask {
+	mask := &fieldmaskpb.FieldMask{Paths: make([]string, 0, len(fields))}
+	fs.Visit(func(f *flag.Flag) {
+		for _, field := range fields {
+			if f.Name == field {
+				mask.Paths = append(mask.Paths, field)
+			}
+		}
+	})
+	return mask
+}
+
+func (c *CLI) runUser(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: user subcommand is required", ErrUsage)
+	}
+	fs := c.flagSet("user " + args[0])
+	id := fs.Int64("id", 0, "user id")
+	nickname := fs.String("nickname", "", "user nickname")
+	email := fs.String("email", "", "user email")
+	query := fs.String("query", "", "nickname to search for")
+	role := fs.String("role", "", "new role of the user")
+	if err := c.parse(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var (
+		user *grpcPort.UserResponse
+		err  error
+	)
+	switch args[0] {
+	case "create":
+		user, err = c.client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: *nickname, Email: *email})
+	case "get":
+		user, err = c.client.GetUser(ctx, &grpcPort.GetUserRequest{Id: *id})
+	case "update":
+		user, err = c.client.PatchUser(ctx, &grpcPort.PatchUserRequest{
+			Id:         *id,
+			User:       &grpcPort.UserPatch{Nickname: *nickname, Email: *email},
+			UpdateMask: updateMask(fs, "nickname", "email"),
+		})
+	case "find":
+		user, err = c.client.FindUser(ctx, &grpcPort.FindUserRequest{Query: *query})
+	case "delete":
+		user, err = c.client.DeleteUser(ctx, &grpcPort.DeleteUserRequest{Id: *id})
+	case "block", "unblock":
+		user, err = c.client.BlockUser(ctx, &grpcPort.BlockUserRequest{
+			Id:      *id,
+			Blocked: args[0] == "block",
+		})
+	case "role":
+		user, err = c.client.SetUserRole(ctx, &grpcPort.SetUserRoleRequest{Id: *id, Role: *role})
+	default:
+		return fmt.Errorf("%w: unknown user subcommand %q", ErrUsage, args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return c.printer.PrintUser(userFromResponse(user))
+}
+
+func (c *CLI) runAd(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: ad subcommand is required", ErrUsage)
+	}
+	fs := c.flagSet("ad " + args[0])
+	id := fs.Int64("id", 0, "ad id")
+	title := fs.String("title", "", "ad title")
+	text := fs.String("text", "", "ad text")
+	query := fs.String("query", "", "title prefix to search for")
+	all := fs.Bool("all", false, "list non-published ads too")
+	byAuthor := fs.Bool("by-author", false, "sort ads by author")
+	byCreationTime := fs.Bool("by-creation-time", false, "sort ads by creation time")
+	if err := c.parse(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var (
+		ad  *grpcPort.AdResponse
+		err error
+	)
+	switch args[0] {
+	case "create":
+		ad, err = c.client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: *title, Text: *text})
+	case "get":
+		ad, err = c.client.GetAd(ctx, &grpcPort.GetAdRequest{Id: *id})
+	case "update":
+		ad, err = c.client.PatchAd(ctx, &grpcPort.PatchAdRequest{
+			AdId:       *id,
+			Ad:         &grpcPort.AdPatch{Title: *title, Text: *text},
+			UpdateMask: updateMask(fs, "title", "text"),
+		})
+	case "find":
+		ad, err = c.client.FindAd(ctx, &grpcPort.FindAdRequest{Query: *query})
+	case "delete":
+		ad, err = c.client.DeleteAd(ctx, &grpcPort.DeleteAdRequest{AdId: *id})
+	case "publish", "unpublish":
+		ad, err = c.client.ChangeAdStatus(ctx, &grpcPort.ChangeAdStatusRequest{
+			AdId:      *id,
+			Published: args[0] == "publish",
+		})
+	case "takedown":
+		ad, err = c.client.UnpublishAd(ctx, &grpcPort.UnpublishAdRequest{AdId: *id})
+	case "list":
+		var bitmask int64
+		if *all {
+			bitmask |= app.NonPublished
+		}
+		if *byAuthor {
+			bitmask |= app.ByAuthor
+		}
+		if *byCreationTime {
+			bitmask |= app.ByCreationTime
+		}
+		ads, err := c.listAds(ctx, bitmask)
+		if err != nil {
+			return err
+		}
+		return c.printer.PrintAds(ads)
+	default:
+		return fmt.Errorf("%w: unknown ad subcommand %q", ErrUsage, args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return c.printer.PrintAd(adFromResponse(ad))
+}
+
+func (c *CLI) listAds(ctx context.Context, bitmask int64) ([]Ad, error) {
+	res, err := c.client.ListAds(ctx, &grpcPort.ListAdsRequest{Bitmask: bitmask})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Ad, len(res.List))
+	for i, ad := range res.List {
+		result[i] = adFromResponse(ad)
+	}
+	return result, nil
+}
+
+// export dumps every ad together with its authors. The service has no way
+// to list users, so users without ads are not exported.
+func (c *CLI) export(ctx context.Context, args []string) error {
+	fs := c.flagSet("export")
+	file := fs.String("file", "", "file to write, format is chosen by extension. by default - stdout")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	ads, err := c.listAds(ctx, app.NonPublished)
+	if err != nil {
+		return err
+	}
+	dump := Dump{Users: make([]User, 0), Ads: ads}
+	seen := make(map[int64]struct{})
+	for _, ad := range ads {
+		if _, ok := seen[ad.AuthorID]; ok {
+			continue
+		}
+		seen[ad.AuthorID] = struct{}{}
+		user, err := c.client.GetUser(ctx, &grpcPort.GetUserRequest{Id: ad.AuthorID})
+		if err != nil {
+			return fmt.Errorf("can't get author of ad %d: %w", ad.ID, err)
+		}
+		dump.Users = append(dump.Users, userFromResponse(user))
+	}
+	sort.Slice(dump.Users, func(i, j int) bool {
+		return dump.Users[i].ID < dump.Users[j].ID
+	})
+
+	if *file == "" {
+		return c.printer.PrintDump(dump)
+	}
+	var data []byte
+	if strings.EqualFold(filepath.Ext(*file), ".json") {
+		data, err = json.MarshalIndent(dump, "", "  ")
+	} else {
+		data, err = yaml.Marshal(dump)
+	}
+	if err != nil {
+		return fmt.Errorf("can't encode dump: %w", err)
+	}
+	return os.WriteFile(*file, data, 0o644)
+}
+
+// importDump creates every user and ad from the dump. IDs are assigned by
+// the service, so ads are re-linked to the newly created authors, and a dump
+// with an ad of an unknown author is rejected before anything is created.
+// Ads are created by their authors, so their tokens are issued with the
+// secret of the service.
+func (c *CLI) importDump(ctx context.Context, args []string) error {
+	fs := c.flagSet("import")
+	file := fs.String("file", "", "file to read, json or yaml")
+	secretFile := fs.String("secret-file", "", "file with the secret the service verifies tokens with, required for ads")
+	tenantID := fs.String("tenant", "", "tenant to import into. by default - the single tenant")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("%w: -file is required", ErrUsage)
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("can't read dump: %w", err)
+	}
+	// yaml is a superset of json, so both formats are handled here
+	var dump Dump
+	if err = yaml.Unmarshal(data, &dump); err != nil {
+		return fmt.Errorf("can't decode dump: %w", err)
+	}
+
+	userIDs := make(map[int64]int64, len(dump.Users))
+	for _, user := range dump.Users {
+		userIDs[user.ID] = user.ID
+	}
+	for _, ad := range dump.Ads {
+		if _, ok := userIDs[ad.AuthorID]; !ok {
+			return fmt.Errorf("can't import ad %d: %w: %d", ad.ID, ErrUnknownAuthor, ad.AuthorID)
+		}
+	}
+	var tokens *auth.Tokens
+	if len(dump.Ads) > 0 {
+		if *secretFile == "" {
+			return fmt.Errorf("%w: -secret-file is required to import ads", ErrUsage)
+		}
+		if tokens, err = auth.LoadTokens(*secretFile); err != nil {
+			return err
+		}
+	}
+
+	imported := Dump{Users: make([]User, 0, len(dump.Users)), Ads: make([]Ad, 0, len(dump.Ads))}
+	for _, user := range dump.Users {
+		res, err := c.client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: user.Nickname, Email: user.Email})
+		if err != nil {
+			return fmt.Errorf("can't import user %d: %w", user.ID, err)
+		}
+		userIDs[user.ID] = res.Id
+		imported.Users = append(imported.Users, userFromResponse(res))
+	}
+	for _, ad := range dump.Ads {
+		token, err := tokens.Issue(*tenantID, userIDs[ad.AuthorID], time.Hour)
+		if err != nil {
+			return err
+		}
+		authorCtx := withToken(ctx, token)
+		res, err := c.client.CreateAd(authorCtx, &grpcPort.CreateAdRequest{Title: ad.Title, Text: ad.Text})
+		if err != nil {
+			return fmt.Errorf("can't import ad %d: %w", ad.ID, err)
+		}
+		if ad.Published {
+			res, err = c.client.ChangeAdStatus(authorCtx, &grpcPort.ChangeAdStatusRequest{AdId: res.Id, Published: true})
+			if err != nil {
+				return fmt.Errorf("can't publish ad %d: %w", ad.ID, err)
+			}
+		}
+		imported.Ads = append(imported.Ads, adFromResponse(res))
+	}
+	return c.printer.PrintDump(imported)
+}
+
+// withToken makes calls of ctx with token instead of the one of the
+// -token global flag.
+func withToken(ctx context.Context, token string) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set("authorization", "Bearer "+token)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// issueToken signs a token of a user with the secret of the service, it
+// doesn't call the service.
+func (c *CLI) issueToken(args []string) error {
+	fs := c.flagSet("token")
+	secretFile := fs.String("secret-file", "", "file with the secret the service verifies tokens with")
+	userID := fs.Int64("user", -1, "id of the user to issue the token for")
+	tenantID := fs.String("tenant", "", "tenant of the user. by default - the single tenant")
+	ttl := fs.Duration("ttl", 24*time.Hour, "how long the token is valid")
+	if err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if *secretFile == "" || *userID < 0 {
+		return fmt.Errorf("%w: -secret-file and -user are required", ErrUsage)
+	}
+
+	tokens, err := auth.LoadTokens(*secretFile)
+	if err != nil {
+		return err
+	}
+	token, err := tokens.Issue(*tenantID, *userID, *ttl)
+	if err != nil {
+		return err
+	}
+	return c.printer.PrintToken(Token{UserID: *userID, Token: token})
+}
@@ -0,0 +1,93 @@
+package adsctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultProfile = "default"
+	DefaultAddress = "localhost:1080"
+	DefaultTimeout = 10 * time.Second
+)
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+type Profile struct {
+	Address string        `yaml:"address"`
+	Timeout time.Duration `yaml:"timeout"`
+	Output  string        `yaml:"output"`
+	// TLS is used when CAFile is set, CertFile and KeyFile add a client
+	// certificate for services with mutual TLS
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Token is the bearer token of the user commands are performed by
+	Token string `yaml:"token"`
+}
+
+type Config struct {
+	CurrentProfile string             `yaml:"current_profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+func DefaultConfigPath() string {
+	if path := os.Getenv("ADSCTL_CONFIG"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".adsctl.yaml"
+	}
+	return filepath.Join(home, ".adsctl.yaml")
+}
+
+// LoadConfig reads profiles from path. A missing file is not an error:
+// the returned config then contains only the default profile.
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{
+		CurrentProfile: DefaultProfile,
+		Profiles: map[string]Profile{
+			DefaultProfile: {Address: DefaultAddress},
+		},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read config: %w", err)
+	}
+	if err = yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("can't parse config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.CurrentProfile
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	if profile.Address == "" {
+		profile.Address = DefaultAddress
+	}
+	if profile.Timeout == 0 {
+		profile.Timeout = DefaultTimeout
+	}
+	if profile.Output == "" {
+		profile.Output = FormatTable
+	}
+	return profile, nil
+}
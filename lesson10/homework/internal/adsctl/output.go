@@ -0,0 +1,180 @@
+package adsctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	grpcPort "homework10/internal/ports/grpc"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+var ErrUnknownFormat = errors.New("unknown output format")
+
+type User struct {
+	ID       int64  `json:"id" yaml:"id"`
+	Nickname string `json:"nickname" yaml:"nickname"`
+	Email    string `json:"email" yaml:"email"`
+}
+
+type Ad struct {
+	ID        int64  `json:"id" yaml:"id"`
+	Title     string `json:"title" yaml:"title"`
+	Text      string `json:"text" yaml:"text"`
+	AuthorID  int64  `json:"author_id" yaml:"author_id"`
+	Published bool   `json:"published" yaml:"published"`
+}
+
+// Token is a token issued by the token command.
+type Token struct {
+	UserID int64  `json:"user_id" yaml:"user_id"`
+	Token  string `json:"token" yaml:"token"`
+}
+
+// Dump is the document written by export and read by import.
+type Dump struct {
+	Users []User `json:"users" yaml:"users"`
+	Ads   []Ad   `json:"ads" yaml:"ads"`
+}
+
+func userFromResponse(user *grpcPort.UserResponse) User {
+	return User{
+		ID:       user.Id,
+		Nickname: user.Nickname,
+		Email:    user.Email,
+	}
+}
+
+func adFromResponse(ad *grpcPort.AdResponse) Ad {
+	return Ad{
+		ID:        ad.Id,
+		Title:     ad.Title,
+		Text:      ad.Text,
+		AuthorID:  ad.AuthorId,
+		Published: ad.Published,
+	}
+}
+
+type Printer interface {
+	PrintUser(user User) error
+	PrintAd(ad Ad) error
+	PrintAds(ads []Ad) error
+	PrintDump(dump Dump) error
+	PrintToken(token Token) error
+}
+
+func NewPrinter(w io.Writer, format string) (Printer, error) {
+	switch format {
+	case FormatTable:
+		return tablePrinter{w: w}, nil
+	case FormatJSON:
+		return encoderPrinter{encode: func(v any) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(v)
+		}}, nil
+	case FormatYAML:
+		return encoderPrinter{encode: func(v any) error {
+			encoder := yaml.NewEncoder(w)
+			encoder.SetIndent(2)
+			defer encoder.Close()
+			return encoder.Encode(v)
+		}}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+type encoderPrinter struct {
+	encode func(v any) error
+}
+
+func (p encoderPrinter) PrintUser(user User) error {
+	return p.encode(user)
+}
+
+func (p encoderPrinter) PrintAd(ad Ad) error {
+	return p.encode(ad)
+}
+
+func (p encoderPrinter) PrintAds(ads []Ad) error {
+	return p.encode(ads)
+}
+
+func (p encoderPrinter) PrintDump(dump Dump) error {
+	return p.encode(dump)
+}
+
+func (p encoderPrinter) PrintToken(token Token) error {
+	return p.encode(token)
+}
+
+type tablePrinter struct {
+	w io.Writer
+}
+
+func (p tablePrinter) print(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if i > 0 {
+				_, _ = io.WriteString(tw, "\t")
+			}
+			_, _ = io.WriteString(tw, cell)
+		}
+		_, _ = io.WriteString(tw, "\n")
+	}
+	return tw.Flush()
+}
+
+func (p tablePrinter) PrintUser(user User) error {
+	return p.printUsers([]User{user})
+}
+
+func (p tablePrinter) PrintAd(ad Ad) error {
+	return p.PrintAds([]Ad{ad})
+}
+
+func (p tablePrinter) printUsers(users []User) error {
+	rows := make([][]string, len(users))
+	for i, user := range users {
+		rows[i] = []string{strconv.FormatInt(user.ID, 10), user.Nickname, user.Email}
+	}
+	return p.print([]string{"ID", "NICKNAME", "EMAIL"}, rows)
+}
+
+func (p tablePrinter) PrintAds(ads []Ad) error {
+	rows := make([][]string, len(ads))
+	for i, ad := range ads {
+		rows[i] = []string{
+			strconv.FormatInt(ad.ID, 10),
+			ad.Title,
+			ad.Text,
+			strconv.FormatInt(ad.AuthorID, 10),
+			strconv.FormatBool(ad.Published),
+		}
+	}
+	return p.print([]string{"ID", "TITLE", "TEXT", "AUTHOR", "PUBLISHED"}, rows)
+}
+
+func (p tablePrinter) PrintDump(dump Dump) error {
+	if err := p.printUsers(dump.Users); err != nil {
+		return err
+	}
+	_, _ = io.WriteString(p.w, "\n")
+	return p.PrintAds(dump.Ads)
+}
+
+func (p tablePrinter) PrintToken(token Token) error {
+	return p.print([]string{"USER", "TOKEN"}, [][]string{{strconv.FormatInt(token.UserID, 10), token.Token}})
+}
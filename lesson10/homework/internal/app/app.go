@@ -7,6 +7,9 @@ import (
 	"homework10/internal/adapters/baserepo"
 	"homework10/internal/adapters/filters"
 	"homework10/internal/ads"
+	"homework10/internal/auth"
+	"homework10/internal/policy"
+	"reflect"
 	"time"
 )
 
@@ -24,26 +27,214 @@ var ErrValidation = errors.New("validation error")
 type App interface {
 	CreateUser(nickname string, email string) (*ads.User, error)
 	GetUser(userID int64) (*ads.User, error)
-	UpdateUser(userID int64, nickname string, email string) (*ads.User, error)
+	UpdateUser(userID int64, actor auth.Subject, nickname string, email string) (*ads.User, error)
+	PatchUser(userID int64, actor auth.Subject, patch UserPatch) (*ads.User, error)
 	FindUser(nickname string) (*ads.User, error)
-	DeleteUser(userID int64) (*ads.User, error)
+	DeleteUser(userID int64, actor auth.Subject) (*ads.User, error)
+	BlockUser(userID int64, actor auth.Subject, blocked bool) (*ads.User, error)
+	SetUserRole(userID int64, actor auth.Subject, role ads.Role) (*ads.User, error)
 	ListAds(bitmask int64) []*ads.Ad
-	CreateAd(title string, text string, userId int64) (*ads.Ad, error)
+	SearchAds(query AdsQuery) []*ads.Ad
+	CreateAd(title string, text string, actor auth.Subject) (*ads.Ad, error)
 	GetAd(adID int64) (*ads.Ad, error)
-	UpdateAd(adID int64, userID int64, title string, text string) (*ads.Ad, error)
-	ChangeAdStatus(adID int64, userID int64, published bool) (*ads.Ad, error)
+	UpdateAd(adID int64, actor auth.Subject, title string, text string) (*ads.Ad, error)
+	PatchAd(adID int64, actor auth.Subject, patch AdPatch) (*ads.Ad, error)
+	ChangeAdStatus(adID int64, actor auth.Subject, published bool) (*ads.Ad, error)
 	FindAd(title string) (*ads.Ad, error)
-	DeleteAd(adID int64, userID int64) (*ads.Ad, error)
+	DeleteAd(adID int64, actor auth.Subject) (*ads.Ad, error)
+	UnpublishAd(adID int64, actor auth.Subject) (*ads.Ad, error)
 }
 
-type AdValidatorStruct struct {
-	Title string `validate:"min:1;max:100"`
-	Text  string `validate:"min:1;max:500"`
+// AdsQuery selects ads by the filters of Bitmask and by time ranges
+// [From, To), a zero bound leaves its side of a range open.
+type AdsQuery struct {
+	Bitmask     int64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	UpdatedFrom time.Time
+	UpdatedTo   time.Time
 }
 
+// UserPatch changes the fields that are not nil only.
+type UserPatch struct {
+	Nickname *string
+	Email    *string
+}
+
+// AdPatch changes the fields that are not nil only, they are the only ones
+// validated.
+type AdPatch struct {
+	Title *string
+	Text  *string
+}
+
+// Limits are the rules ad fields are validated with, in the syntax of
+// validate tags.
+type Limits struct {
+	Title string `yaml:"title"`
+	Text  string `yaml:"text"`
+}
+
+var DefaultLimits = Limits{
+	Title: "min:1;max:100",
+	Text:  "min:1;max:500",
+}
+
+// adValidator keeps a struct type for every ad field with the rule of the
+// field in the tag of its only field, the validator reads rules from tags
+// only.
+type adValidator struct {
+	title reflect.Type
+	text  reflect.Type
+}
+
+func (l Limits) adValidator() adValidator {
+	return adValidator{
+		title: ruleType(l.Title),
+		text:  ruleType(l.Text),
+	}
+}
+
+func ruleType(rule string) reflect.Type {
+	return reflect.StructOf([]reflect.StructField{
+		{Name: "Value", Type: reflect.TypeOf(""), Tag: reflect.StructTag(fmt.Sprintf(`validate:"%s"`, rule))},
+	})
+}
+
+// validate checks the fields that are set only.
+func (v adValidator) validate(title *string, text *string) error {
+	var errs validator.ValidationErrors
+	for _, field := range []struct {
+		rule  reflect.Type
+		value *string
+	}{{v.title, title}, {v.text, text}} {
+		if field.value == nil {
+			continue
+		}
+		value := reflect.New(field.rule).Elem()
+		value.Field(0).SetString(*field.value)
+		err := validator.Validate(value.Interface())
+		var fieldErrs validator.ValidationErrors
+		if errors.As(err, &fieldErrs) {
+			errs = append(errs, fieldErrs...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the syntax of the rules.
+func (l Limits) Validate() error {
+	var errs validator.ValidationErrors
+	empty := ""
+	if !errors.As(l.adValidator().validate(&empty, &empty), &errs) {
+		return nil
+	}
+	for _, err := range errs {
+		if errors.Is(err.Err, validator.ErrInvalidValidatorSyntax) {
+			return fmt.Errorf("can't parse limits %q, %q: %w", l.Title, l.Text, err.Err)
+		}
+	}
+	return nil
+}
+
+type Option func(*Impl)
+
+// WithLimits replaces DefaultLimits, limits are expected to be valid.
+func WithLimits(limits Limits) Option {
+	return func(a *Impl) {
+		a.adValidator = limits.adValidator()
+	}
+}
+
+// WithClock replaces time.Now for creation and update times.
+func WithClock(now func() time.Time) Option {
+	return func(a *Impl) {
+		a.now = now
+	}
+}
+
+// WithPolicy replaces policy.Default.
+func WithPolicy(p policy.Policy) Option {
+	return func(a *Impl) {
+		a.policy = p
+	}
+}
+
+// WithAdmins makes the users with ids admins whatever role they have, so
+// there is someone to grant roles to others.
+func WithAdmins(ids ...int64) Option {
+	return func(a *Impl) {
+		for _, id := range ids {
+			a.admins[id] = struct{}{}
+		}
+	}
+}
+
+// WithServices lets the services with the identities act with the roles,
+// e.g. a moderation service take ads down. Services aren't users, so they
+// own nothing, and services without a role can't act at all.
+func WithServices(roles map[string]ads.Role) Option {
+	return func(a *Impl) {
+		for identity, role := range roles {
+			a.services[identity] = role
+		}
+	}
+}
+
+// serviceID is the ID of services acting as users, no user has it.
+const serviceID = -1
+
 type Impl struct {
 	adsRepository   baserepo.Repository[*ads.Ad]
 	usersRepository baserepo.Repository[*ads.User]
+	adValidator     adValidator
+	policy          policy.Policy
+	admins          map[int64]struct{}
+	services        map[string]ads.Role
+	now             func() time.Time
+}
+
+// actor is the user with userID who performs an operation, with the role
+// the policy is checked for.
+func (a Impl) actor(userID int64) (*ads.User, error) {
+	user, err := a.usersRepository.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if _, ok := a.admins[userID]; ok {
+		user.Role = ads.RoleAdmin
+	}
+	return user, nil
+}
+
+// authenticated is the actor subject is, anonymous subjects can't act.
+func (a Impl) authenticated(subject auth.Subject) (*ads.User, error) {
+	if identity, ok := subject.Service(); ok {
+		role, ok := a.services[identity]
+		if !ok {
+			return nil, fmt.Errorf("%w: service %q has no role", policy.ErrForbidden, identity)
+		}
+		return &ads.User{RepoEntity: ads.RepoEntity{ID: serviceID}, Nickname: identity, Role: role}, nil
+	}
+	userID, ok := subject.UserID()
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	return a.actor(userID)
+}
+
+// authorizeAd keeps ErrNotUsersAd for users who act on ads of others.
+func (a Impl) authorizeAd(actor *ads.User, action policy.Action, ad *ads.Ad) error {
+	err := a.policy.Check(actor, action, ad.AuthorID)
+	if errors.Is(err, policy.ErrForbidden) && ad.AuthorID != actor.ID {
+		return ErrNotUsersAd
+	}
+	return err
 }
 
 func (a Impl) CreateUser(nickname string, email string) (*ads.User, error) {
@@ -62,14 +253,48 @@ func (a Impl) GetUser(userID int64) (*ads.User, error) {
 	return a.usersRepository.FindByID(userID)
 }
 
-func (a Impl) UpdateUser(userID int64, nickname string, email string) (*ads.User, error) {
-	user, err := a.usersRepository.FindByID(userID)
+func (a Impl) UpdateUser(userID int64, actor auth.Subject, nickname string, email string) (*ads.User, error) {
+	return a.PatchUser(userID, actor, UserPatch{Nickname: &nickname, Email: &email})
+}
+
+func (a Impl) PatchUser(userID int64, subject auth.Subject, patch UserPatch) (*ads.User, error) {
+	actor, err := a.authenticated(subject)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, err
+	}
+	if err = a.policy.Check(actor, policy.UpdateUser, userID); err != nil {
+		return nil, err
+	}
+
+	if patch.Nickname == nil && patch.Email == nil {
+		user, err := a.usersRepository.FindByID(userID)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
 	}
 
-	user.Nickname = nickname
-	user.Email = email
+	return a.updateUser(userID, func(user *ads.User) error {
+		if patch.Nickname != nil {
+			user.Nickname = *patch.Nickname
+		}
+		if patch.Email != nil {
+			user.Email = *patch.Email
+		}
+		return nil
+	})
+}
+
+// updateUser changes the user in the repository at once, so concurrent
+// changes of other fields aren't lost.
+func (a Impl) updateUser(userID int64, change func(*ads.User) error) (*ads.User, error) {
+	user, err := a.usersRepository.Update(userID, change)
+	if errors.Is(err, baserepo.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
 	return user, nil
 }
 
@@ -77,15 +302,59 @@ func (a Impl) FindUser(nickname string) (*ads.User, error) {
 	return a.usersRepository.FindByName(nickname)
 }
 
-func (a Impl) DeleteUser(userID int64) (*ads.User, error) {
+func (a Impl) DeleteUser(userID int64, subject auth.Subject) (*ads.User, error) {
+	actor, err := a.authenticated(subject)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.policy.Check(actor, policy.DeleteUser, userID); err != nil {
+		return nil, err
+	}
 	return a.usersRepository.DeleteById(userID)
 }
 
+func (a Impl) BlockUser(userID int64, actor auth.Subject, blocked bool) (*ads.User, error) {
+	return a.changeUser(userID, actor, policy.BlockUser, func(user *ads.User) {
+		user.Blocked = blocked
+	})
+}
+
+func (a Impl) SetUserRole(userID int64, actor auth.Subject, role ads.Role) (*ads.User, error) {
+	return a.changeUser(userID, actor, policy.SetUserRole, func(user *ads.User) {
+		user.Role = role
+	})
+}
+
+func (a Impl) changeUser(userID int64, subject auth.Subject, action policy.Action, change func(*ads.User)) (*ads.User, error) {
+	actor, err := a.authenticated(subject)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.policy.Check(actor, action, userID); err != nil {
+		return nil, err
+	}
+	return a.updateUser(userID, func(user *ads.User) error {
+		change(user)
+		return nil
+	})
+}
+
 func (a Impl) ListAds(bitmask int64) []*ads.Ad {
+	return a.SearchAds(AdsQuery{Bitmask: bitmask})
+}
+
+func (a Impl) SearchAds(query AdsQuery) []*ads.Ad {
+	bitmask := query.Bitmask
 	f := make(filters.Filters[*ads.Ad], 0)
 	if !(bitmask&NonPublished != 0) {
 		f = append(f, filters.NewFilterNonPublished())
 	}
+	if !query.CreatedFrom.IsZero() || !query.CreatedTo.IsZero() {
+		f = append(f, filters.NewFilterCreatedBetween(query.CreatedFrom, query.CreatedTo))
+	}
+	if !query.UpdatedFrom.IsZero() || !query.UpdatedTo.IsZero() {
+		f = append(f, filters.NewFilterUpdatedBetween(query.UpdatedFrom, query.UpdatedTo))
+	}
 	if bitmask&ByAuthor != 0 {
 		f = append(f, filters.NewFilterByAuthor())
 	}
@@ -95,17 +364,21 @@ func (a Impl) ListAds(bitmask int64) []*ads.Ad {
 	return a.adsRepository.GetAll(f)
 }
 
-func (a Impl) CreateAd(title string, text string, userID int64) (*ads.Ad, error) {
-	_, err := a.usersRepository.FindByID(userID)
+// CreateAd creates an ad authored by the user subject is, services own
+// nothing, so they can't author ads.
+func (a Impl) CreateAd(title string, text string, subject auth.Subject) (*ads.Ad, error) {
+	actor, err := a.authenticated(subject)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, err
 	}
-
-	validateStruct := AdValidatorStruct{
-		Title: title,
-		Text:  text,
+	if _, ok := subject.Service(); ok {
+		return nil, fmt.Errorf("%w: services can't author ads", policy.ErrForbidden)
 	}
-	err = validator.Validate(validateStruct)
+	if err = a.policy.Check(actor, policy.CreateAd, actor.ID); err != nil {
+		return nil, err
+	}
+
+	err = a.adValidator.validate(&title, &text)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
 	}
@@ -113,9 +386,9 @@ func (a Impl) CreateAd(title string, text string, userID int64) (*ads.Ad, error)
 	ad := &ads.Ad{
 		Title:        title,
 		Text:         text,
-		AuthorID:     userID,
+		AuthorID:     actor.ID,
 		Published:    false,
-		CreationTime: time.Now().UTC(),
+		CreationTime: a.now().UTC(),
 	}
 	ad.LastUpdateTime = ad.CreationTime
 	err = a.adsRepository.Add(ad)
@@ -125,22 +398,31 @@ func (a Impl) CreateAd(title string, text string, userID int64) (*ads.Ad, error)
 	return ad, nil
 }
 
-func (a Impl) ChangeAdStatus(adID int64, userID int64, published bool) (*ads.Ad, error) {
-	_, err := a.usersRepository.FindByID(userID)
+func (a Impl) ChangeAdStatus(adID int64, subject auth.Subject, published bool) (*ads.Ad, error) {
+	actor, err := a.authenticated(subject)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, err
 	}
 
-	ad, err := a.adsRepository.FindByID(adID)
-	if err != nil {
+	return a.updateAd(adID, func(ad *ads.Ad) error {
+		if err := a.authorizeAd(actor, policy.ChangeAdStatus, ad); err != nil {
+			return err
+		}
+		ad.Published = published
+		return nil
+	})
+}
+
+// updateAd changes the ad in the repository at once, so the change is made
+// to and authorized for the ad as it is stored.
+func (a Impl) updateAd(adID int64, change func(*ads.Ad) error) (*ads.Ad, error) {
+	ad, err := a.adsRepository.Update(adID, change)
+	if errors.Is(err, baserepo.ErrNotFound) {
 		return nil, ErrAdNotFound
 	}
-
-	if ad.AuthorID != userID {
-		return nil, ErrNotUsersAd
+	if err != nil {
+		return nil, err
 	}
-
-	ad.Published = published
 	return ad, nil
 }
 
@@ -148,56 +430,97 @@ func (a Impl) GetAd(adID int64) (*ads.Ad, error) {
 	return a.adsRepository.FindByID(adID)
 }
 
-func (a Impl) UpdateAd(adID int64, userID int64, title string, text string) (*ads.Ad, error) {
-	_, err := a.usersRepository.FindByID(userID)
-	if err != nil {
-		return nil, ErrUserNotFound
-	}
+func (a Impl) UpdateAd(adID int64, subject auth.Subject, title string, text string) (*ads.Ad, error) {
+	return a.PatchAd(adID, subject, AdPatch{Title: &title, Text: &text})
+}
 
-	validateStruct := AdValidatorStruct{
-		Title: title,
-		Text:  text,
-	}
-	err = validator.Validate(validateStruct)
+func (a Impl) PatchAd(adID int64, subject auth.Subject, patch AdPatch) (*ads.Ad, error) {
+	actor, err := a.authenticated(subject)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
+		return nil, err
 	}
 
-	ad, err := a.adsRepository.FindByID(adID)
+	err = a.adValidator.validate(patch.Title, patch.Text)
 	if err != nil {
-		return nil, ErrAdNotFound
+		return nil, fmt.Errorf("%w: %s", ErrValidation, err.Error())
 	}
 
-	if ad.AuthorID != userID {
-		return nil, ErrNotUsersAd
+	if patch.Title == nil && patch.Text == nil {
+		ad, err := a.adsRepository.FindByID(adID)
+		if err != nil {
+			return nil, ErrAdNotFound
+		}
+		if err = a.authorizeAd(actor, policy.UpdateAd, ad); err != nil {
+			return nil, err
+		}
+		return ad, nil
 	}
 
-	ad.LastUpdateTime = time.Now().UTC()
-	ad.Title = title
-	ad.Text = text
-	return ad, nil
+	return a.updateAd(adID, func(ad *ads.Ad) error {
+		if err := a.authorizeAd(actor, policy.UpdateAd, ad); err != nil {
+			return err
+		}
+		ad.LastUpdateTime = a.now().UTC()
+		if patch.Title != nil {
+			ad.Title = *patch.Title
+		}
+		if patch.Text != nil {
+			ad.Text = *patch.Text
+		}
+		return nil
+	})
 }
 
 func (a Impl) FindAd(title string) (*ads.Ad, error) {
 	return a.adsRepository.FindByName(title)
 }
 
-func (a Impl) DeleteAd(adID int64, userID int64) (*ads.Ad, error) {
+func (a Impl) DeleteAd(adID int64, subject auth.Subject) (*ads.Ad, error) {
+	actor, err := a.authenticated(subject)
+	if err != nil {
+		return nil, err
+	}
+
 	ad, err := a.adsRepository.FindByID(adID)
 	if err != nil {
 		return nil, ErrAdNotFound
 	}
 
-	if ad.AuthorID != userID {
-		return nil, ErrNotUsersAd
+	if err = a.authorizeAd(actor, policy.DeleteAd, ad); err != nil {
+		return nil, err
 	}
 
 	return a.adsRepository.DeleteById(adID)
 }
 
-func NewApp(adsRepository baserepo.Repository[*ads.Ad], usersRepository baserepo.Repository[*ads.User]) App {
-	return &Impl{
+// UnpublishAd takes an ad of any author off publication.
+func (a Impl) UnpublishAd(adID int64, subject auth.Subject) (*ads.Ad, error) {
+	actor, err := a.authenticated(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.updateAd(adID, func(ad *ads.Ad) error {
+		if err := a.policy.Check(actor, policy.UnpublishAd, ad.AuthorID); err != nil {
+			return err
+		}
+		ad.Published = false
+		return nil
+	})
+}
+
+func NewApp(adsRepository baserepo.Repository[*ads.Ad], usersRepository baserepo.Repository[*ads.User], opts ...Option) App {
+	a := &Impl{
 		adsRepository:   adsRepository,
 		usersRepository: usersRepository,
+		adValidator:     DefaultLimits.adValidator(),
+		policy:          policy.Default,
+		admins:          make(map[int64]struct{}),
+		services:        make(map[string]ads.Role),
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+	return a
 }
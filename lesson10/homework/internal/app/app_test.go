@@ -9,7 +9,10 @@ import (
 	"homework10/internal/adapters/userrepo"
 	"homework10/internal/ads"
 	"homework10/internal/app/mocks"
+	"homework10/internal/auth"
+	"homework10/internal/policy"
 	"testing"
+	"time"
 )
 
 type SuiteStruct struct {
@@ -23,6 +26,7 @@ func (s *SuiteStruct) SetupTest() {
 	s.AdsRepository = mocks.NewAdsRepoMock()
 	s.AdsRepository.On("GetAll", mock.Anything)
 	s.AdsRepository.On("Add", mock.Anything)
+	s.AdsRepository.On("Update", mock.Anything, mock.Anything)
 	s.AdsRepository.On("FindByID", mock.Anything)
 	s.AdsRepository.On("FindByName", mock.Anything)
 	s.AdsRepository.On("DeleteById", mock.Anything)
@@ -30,6 +34,7 @@ func (s *SuiteStruct) SetupTest() {
 	s.UserRepository = mocks.NewUsersRepoMock()
 	s.UserRepository.On("GetAll", mock.Anything)
 	s.UserRepository.On("Add", mock.Anything)
+	s.UserRepository.On("Update", mock.Anything, mock.Anything)
 	s.UserRepository.On("FindByID", mock.Anything)
 	s.UserRepository.On("FindByName", mock.Anything)
 	s.UserRepository.On("DeleteById", mock.Anything)
@@ -68,12 +73,34 @@ func (s *SuiteStruct) TestUpdateUser() {
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	res, err := a.UpdateUser(0, "Oleg1", "test1@gmail.com")
+	res, err := a.UpdateUser(0, auth.User(0), "Oleg1", "test1@gmail.com")
 	s.NoError(err, "app.UpdateUser")
 	s.Equal(int64(0), res.ID)
 	s.Equal("Oleg1", res.Nickname)
 	s.Equal("test1@gmail.com", res.Email)
-	s.UserRepository.AssertNumberOfCalls(s.T(), "FindByID", 1)
+	s.UserRepository.AssertNumberOfCalls(s.T(), "Update", 1)
+}
+
+func (s *SuiteStruct) TestPatchUser() {
+	a := s.A
+
+	_, err := a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+
+	nickname, email := "Oleg1", ""
+	res, err := a.PatchUser(0, auth.User(0), UserPatch{Nickname: &nickname})
+	s.NoError(err, "app.PatchUser")
+	s.Equal("Oleg1", res.Nickname)
+	s.Equal("test@gmail.com", res.Email, "fields that aren't set are kept")
+
+	res, err = a.PatchUser(0, auth.User(0), UserPatch{Email: &email})
+	s.NoError(err, "app.PatchUser")
+	s.Equal("Oleg1", res.Nickname)
+	s.Equal("", res.Email, "empty fields are set")
+
+	_, err = a.PatchUser(0, auth.User(0), UserPatch{})
+	s.NoError(err, "app.PatchUser")
+	s.UserRepository.AssertNumberOfCalls(s.T(), "Update", 2)
 }
 
 func (s *SuiteStruct) TestFindUser() {
@@ -96,7 +123,7 @@ func (s *SuiteStruct) TestDeleteUser() {
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	res, err := a.DeleteUser(0)
+	res, err := a.DeleteUser(0, auth.User(0))
 	s.NoError(err, "app.DeleteUser")
 	s.Equal(int64(0), res.ID)
 	s.Equal("Oleg", res.Nickname)
@@ -107,13 +134,170 @@ func (s *SuiteStruct) TestDeleteUser() {
 	s.Error(err, "app.GetUser")
 }
 
+func (s *SuiteStruct) TestDeleteOtherUser() {
+	a := NewApp(s.AdsRepository, s.UserRepository, WithAdmins(0))
+
+	_, err := a.CreateUser("admin", "admin@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+
+	_, err = a.DeleteUser(0, auth.User(1))
+	s.ErrorIs(err, policy.ErrForbidden)
+	_, err = a.DeleteUser(1, auth.User(0))
+	s.NoError(err, "admins delete anyone")
+	_, err = a.DeleteUser(0, auth.User(2))
+	s.ErrorIs(err, ErrUserNotFound)
+}
+
+func (s *SuiteStruct) TestUpdateOtherUser() {
+	a := NewApp(s.AdsRepository, s.UserRepository, WithAdmins(0))
+
+	_, err := a.CreateUser("admin", "admin@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+
+	nickname := "Oleg1"
+	_, err = a.PatchUser(1, auth.Subject{}, UserPatch{Nickname: &nickname})
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+	_, err = a.PatchUser(0, auth.User(1), UserPatch{Nickname: &nickname})
+	s.ErrorIs(err, policy.ErrForbidden)
+	_, err = a.PatchUser(0, auth.User(1), UserPatch{})
+	s.ErrorIs(err, policy.ErrForbidden, "empty patches are authorized too")
+	res, err := a.UpdateUser(1, auth.User(0), "Oleg1", "test1@gmail.com")
+	s.NoError(err, "admins update anyone")
+	s.Equal("Oleg1", res.Nickname)
+
+	_, err = a.DeleteUser(1, auth.Subject{})
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+	_, err = a.BlockUser(1, auth.Subject{}, true)
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+	_, err = a.UnpublishAd(0, auth.Subject{})
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+}
+
+func (s *SuiteStruct) TestAdsOfOthers() {
+	a := NewApp(s.AdsRepository, s.UserRepository, WithAdmins(0))
+
+	_, err := a.CreateUser("admin", "admin@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateUser("Ivan", "ivan@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	ad, err := a.CreateAd("title", "text", auth.User(1))
+	s.NoError(err, "app.CreateAd")
+	s.Equal(int64(1), ad.AuthorID, "the author is the subject")
+
+	_, err = a.CreateAd("title", "text", auth.Subject{})
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+	_, err = a.ChangeAdStatus(0, auth.Subject{}, true)
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+	_, err = a.UpdateAd(0, auth.Subject{}, "title1", "text1")
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+	_, err = a.DeleteAd(0, auth.Subject{})
+	s.ErrorIs(err, auth.ErrUnauthenticated)
+
+	_, err = a.ChangeAdStatus(0, auth.User(2), true)
+	s.ErrorIs(err, ErrNotUsersAd)
+	_, err = a.UpdateAd(0, auth.User(2), "title1", "text1")
+	s.ErrorIs(err, ErrNotUsersAd)
+	_, err = a.DeleteAd(0, auth.User(2))
+	s.ErrorIs(err, ErrNotUsersAd)
+
+	_, err = a.DeleteAd(0, auth.User(0))
+	s.NoError(err, "admins delete ads of anyone")
+}
+
+func (s *SuiteStruct) TestServices() {
+	a := NewApp(s.AdsRepository, s.UserRepository, WithServices(map[string]ads.Role{"moderation": ads.RoleModerator}))
+
+	_, err := a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateAd("title", "text", auth.User(0))
+	s.NoError(err, "app.CreateAd")
+	_, err = a.ChangeAdStatus(0, auth.User(0), true)
+	s.NoError(err, "app.ChangeAdStatus")
+
+	_, err = a.UnpublishAd(0, auth.Service("gateway"))
+	s.ErrorIs(err, policy.ErrForbidden, "services without a role can't act")
+	_, err = a.CreateAd("title", "text", auth.Service("moderation"))
+	s.ErrorIs(err, policy.ErrForbidden, "services author no ads")
+	_, err = a.BlockUser(0, auth.Service("moderation"), true)
+	s.ErrorIs(err, policy.ErrForbidden)
+	nickname := "moderation"
+	_, err = a.PatchUser(0, auth.Service("moderation"), UserPatch{Nickname: &nickname})
+	s.ErrorIs(err, policy.ErrForbidden, "services own no users")
+
+	ad, err := a.UnpublishAd(0, auth.Service("moderation"))
+	s.NoError(err, "app.UnpublishAd")
+	s.False(ad.Published)
+}
+
+func (s *SuiteStruct) TestBlockUser() {
+	a := NewApp(s.AdsRepository, s.UserRepository, WithAdmins(0))
+
+	_, err := a.CreateUser("admin", "admin@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateAd("title", "text", auth.User(1))
+	s.NoError(err, "app.CreateAd")
+
+	_, err = a.BlockUser(0, auth.User(1), true)
+	s.ErrorIs(err, policy.ErrForbidden)
+	res, err := a.BlockUser(1, auth.User(0), true)
+	s.NoError(err, "app.BlockUser")
+	s.True(res.Blocked)
+
+	_, err = a.CreateAd("title", "text", auth.User(1))
+	s.ErrorIs(err, policy.ErrBlocked)
+	_, err = a.ChangeAdStatus(0, auth.User(1), true)
+	s.ErrorIs(err, policy.ErrBlocked)
+
+	_, err = a.BlockUser(1, auth.User(0), false)
+	s.NoError(err, "app.BlockUser")
+	_, err = a.ChangeAdStatus(0, auth.User(1), true)
+	s.NoError(err, "app.ChangeAdStatus")
+}
+
+func (s *SuiteStruct) TestSetUserRole() {
+	a := NewApp(s.AdsRepository, s.UserRepository, WithAdmins(0))
+
+	_, err := a.CreateUser("admin", "admin@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateUser("moderator", "moderator@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateAd("title", "text", auth.User(2))
+	s.NoError(err, "app.CreateAd")
+	_, err = a.ChangeAdStatus(0, auth.User(2), true)
+	s.NoError(err, "app.ChangeAdStatus")
+
+	_, err = a.UnpublishAd(0, auth.User(1))
+	s.ErrorIs(err, policy.ErrForbidden)
+	_, err = a.SetUserRole(1, auth.User(1), ads.RoleModerator)
+	s.ErrorIs(err, policy.ErrForbidden)
+	res, err := a.SetUserRole(1, auth.User(0), ads.RoleModerator)
+	s.NoError(err, "app.SetUserRole")
+	s.Equal(ads.RoleModerator, res.Role)
+
+	ad, err := a.UnpublishAd(0, auth.User(1))
+	s.NoError(err, "app.UnpublishAd")
+	s.False(ad.Published)
+	_, err = a.UpdateAd(0, auth.User(1), "title1", "text1")
+	s.ErrorIs(err, ErrNotUsersAd, "moderators don't edit ads of others")
+}
+
 func (s *SuiteStruct) TestListAds() {
 	a := s.A
 
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	_, err = a.CreateAd("title", "text", 0)
+	_, err = a.CreateAd("title", "text", auth.User(0))
 	s.NoError(err, "app.CreateAd")
 
 	res := a.ListAds(0)
@@ -121,7 +305,7 @@ func (s *SuiteStruct) TestListAds() {
 	s.Equal(0, len(res))
 	s.AdsRepository.AssertNumberOfCalls(s.T(), "GetAll", 1)
 
-	_, err = a.ChangeAdStatus(0, 0, true)
+	_, err = a.ChangeAdStatus(0, auth.User(0), true)
 	s.NoError(err, "app.ChangeAdStatus")
 
 	res = a.ListAds(0)
@@ -131,13 +315,44 @@ func (s *SuiteStruct) TestListAds() {
 	s.AdsRepository.AssertNumberOfCalls(s.T(), "GetAll", 2)
 }
 
+func (s *SuiteStruct) TestSearchAds() {
+	now := time.Date(2023, 3, 8, 12, 0, 0, 0, time.UTC)
+	a := NewApp(s.AdsRepository, s.UserRepository, WithClock(func() time.Time { return now }))
+
+	_, err := a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateAd("title", "text", auth.User(0))
+	s.NoError(err, "app.CreateAd")
+	now = now.Add(time.Hour)
+	_, err = a.CreateAd("title", "text", auth.User(0))
+	s.NoError(err, "app.CreateAd")
+	now = now.Add(time.Hour)
+	ad, err := a.UpdateAd(0, auth.User(0), "title1", "text1")
+	s.NoError(err, "app.UpdateAd")
+	s.Equal(now, ad.LastUpdateTime)
+	s.Equal(now.Add(-2*time.Hour), ad.CreationTime)
+
+	ids := func(list []*ads.Ad) []int64 {
+		result := make([]int64, 0, len(list))
+		for _, ad := range list {
+			result = append(result, ad.ID)
+		}
+		return result
+	}
+	s.Equal([]int64{0, 1}, ids(a.SearchAds(AdsQuery{Bitmask: NonPublished})))
+	s.Equal([]int64{1}, ids(a.SearchAds(AdsQuery{Bitmask: NonPublished, CreatedFrom: now.Add(-time.Hour)})))
+	s.Equal([]int64{0}, ids(a.SearchAds(AdsQuery{Bitmask: NonPublished, CreatedTo: now.Add(-time.Hour)})))
+	s.Equal([]int64{0}, ids(a.SearchAds(AdsQuery{Bitmask: NonPublished, UpdatedFrom: now})))
+	s.Empty(a.SearchAds(AdsQuery{CreatedFrom: now.Add(-3 * time.Hour)}), "published filter still applies")
+}
+
 func (s *SuiteStruct) TestCreateAd() {
 	a := s.A
 
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	res, err := a.CreateAd("title", "text", 0)
+	res, err := a.CreateAd("title", "text", auth.User(0))
 	s.NoError(err, "app.CreateAd")
 	s.Equal(int64(0), res.ID)
 	s.Equal("title", res.Title)
@@ -153,7 +368,7 @@ func (s *SuiteStruct) TestGetAd() {
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	_, err = a.CreateAd("title", "text", 0)
+	_, err = a.CreateAd("title", "text", auth.User(0))
 	s.NoError(err, "app.CreateAd")
 
 	res, err := a.GetAd(0)
@@ -171,16 +386,57 @@ func (s *SuiteStruct) TestUpdateAd() {
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	_, err = a.CreateAd("title", "text", 0)
+	_, err = a.CreateAd("title", "text", auth.User(0))
 	s.NoError(err, "app.CreateAd")
 
-	res, err := a.UpdateAd(0, 0, "title1", "text1")
+	res, err := a.UpdateAd(0, auth.User(0), "title1", "text1")
 	s.NoError(err, "app.UpdateAd")
 	s.Equal(int64(0), res.ID)
 	s.Equal("title1", res.Title)
 	s.Equal("text1", res.Text)
 	s.Equal(false, res.Published)
-	s.AdsRepository.AssertNumberOfCalls(s.T(), "FindByID", 1)
+	s.AdsRepository.AssertNumberOfCalls(s.T(), "Update", 1)
+}
+
+func (s *SuiteStruct) TestPatchAd() {
+	a := s.A
+
+	_, err := a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+
+	_, err = a.CreateAd("title", "text", auth.User(0))
+	s.NoError(err, "app.CreateAd")
+
+	text, empty := "text1", ""
+	res, err := a.PatchAd(0, auth.User(0), AdPatch{Text: &text})
+	s.NoError(err, "app.PatchAd")
+	s.Equal("title", res.Title)
+	s.Equal("text1", res.Text)
+
+	_, err = a.PatchAd(0, auth.User(0), AdPatch{Title: &empty})
+	s.ErrorIs(err, ErrValidation, "empty title is set, not skipped")
+
+	_, err = a.PatchAd(0, auth.User(1), AdPatch{Text: &text})
+	s.ErrorIs(err, ErrUserNotFound)
+	s.AdsRepository.AssertNumberOfCalls(s.T(), "Update", 1)
+}
+
+func (s *SuiteStruct) TestPatchAdValidatesSetFieldsOnly() {
+	a := NewApp(s.AdsRepository, s.UserRepository)
+
+	_, err := a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+	_, err = a.CreateAd("long title", "text", auth.User(0))
+	s.NoError(err, "app.CreateAd")
+
+	a = NewApp(s.AdsRepository, s.UserRepository, WithLimits(Limits{Title: "min:1;max:5", Text: DefaultLimits.Text}))
+	text, title := "text1", "long title"
+	res, err := a.PatchAd(0, auth.User(0), AdPatch{Text: &text})
+	s.NoError(err, "the stored title isn't validated")
+	s.Equal("long title", res.Title)
+
+	_, err = a.PatchAd(0, auth.User(0), AdPatch{Title: &title})
+	s.ErrorIs(err, ErrValidation)
 }
 
 func (s *SuiteStruct) TestChangeAdStatus() {
@@ -189,16 +445,37 @@ func (s *SuiteStruct) TestChangeAdStatus() {
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	_, err = a.CreateAd("title", "text", 0)
+	_, err = a.CreateAd("title", "text", auth.User(0))
 	s.NoError(err, "app.CreateAd")
 
-	res, err := a.ChangeAdStatus(0, 0, true)
+	res, err := a.ChangeAdStatus(0, auth.User(0), true)
 	s.NoError(err, "app.UpdateAd")
 	s.Equal(int64(0), res.ID)
 	s.Equal("title", res.Title)
 	s.Equal("text", res.Text)
 	s.Equal(true, res.Published)
-	s.AdsRepository.AssertNumberOfCalls(s.T(), "FindByID", 1)
+	s.AdsRepository.AssertNumberOfCalls(s.T(), "Update", 1)
+}
+
+func (s *SuiteStruct) TestReturnedAdIsCopy() {
+	a := s.A
+
+	_, err := a.CreateUser("Oleg", "test@gmail.com")
+	s.NoError(err, "app.CreateUser")
+
+	created, err := a.CreateAd("title", "text", auth.User(0))
+	s.NoError(err, "app.CreateAd")
+	created.Title = "changed"
+
+	res, err := a.GetAd(0)
+	s.NoError(err, "app.GetAd")
+	res.Published = true
+	s.Equal(0, len(a.ListAds(0)), "changes are saved only by Update")
+
+	res, err = a.GetAd(0)
+	s.NoError(err, "app.GetAd")
+	s.Equal("title", res.Title)
+	s.Equal(false, res.Published)
 }
 
 func (s *SuiteStruct) TestFindAd() {
@@ -207,7 +484,7 @@ func (s *SuiteStruct) TestFindAd() {
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	_, err = a.CreateAd("title", "text", 0)
+	_, err = a.CreateAd("title", "text", auth.User(0))
 	s.NoError(err, "app.CreateAd")
 
 	res, err := a.FindAd("title")
@@ -225,10 +502,10 @@ func (s *SuiteStruct) TestDeleteAd() {
 	_, err := a.CreateUser("Oleg", "test@gmail.com")
 	s.NoError(err, "app.CreateUser")
 
-	_, err = a.CreateAd("title", "text", 0)
+	_, err = a.CreateAd("title", "text", auth.User(0))
 	s.NoError(err, "app.CreateAd")
 
-	res, err := a.DeleteAd(0, 0)
+	res, err := a.DeleteAd(0, auth.User(0))
 	s.NoError(err, "app.DeleteAd")
 	s.Equal(int64(0), res.ID)
 	s.Equal("title", res.Title)
@@ -250,9 +527,9 @@ func BenchmarkListAds(b *testing.B) {
 	for i := int64(0); i < 100; i++ {
 		name := fmt.Sprintf("ad%d", i)
 		userID := i % 2
-		_, err = a.CreateAd(name, name, i%2)
+		_, err = a.CreateAd(name, name, auth.User(i%2))
 		if i%3 == 0 {
-			_, err := a.ChangeAdStatus(i, userID, true)
+			_, err := a.ChangeAdStatus(i, auth.User(userID), true)
 			assert.NoError(b, err, "can't change ad status")
 		}
 		assert.NoError(b, err, "can't create ad")
@@ -7,7 +7,7 @@ import (
 	"homework10/internal/ads"
 )
 
-type AbstractRepoMock[T ads.RepoEntityInterface] struct {
+type AbstractRepoMock[T ads.Entity[T]] struct {
 	repo baserepo.Repository[T]
 	mock.Mock
 }
@@ -22,6 +22,11 @@ func (a *AbstractRepoMock[T]) Add(elem T) error {
 	return a.repo.Add(elem)
 }
 
+func (a *AbstractRepoMock[T]) Update(id int64, change func(elem T) error) (T, error) {
+	a.Called(id, change)
+	return a.repo.Update(id, change)
+}
+
 func (a *AbstractRepoMock[T]) FindByID(id int64) (T, error) {
 	a.Called(id)
 	return a.repo.FindByID(id)
@@ -37,7 +42,7 @@ func (a *AbstractRepoMock[T]) DeleteById(id int64) (T, error) {
 	return a.repo.DeleteById(id)
 }
 
-func NewAbstractRepoMock[T ads.RepoEntityInterface]() *AbstractRepoMock[T] {
+func NewAbstractRepoMock[T ads.Entity[T]]() *AbstractRepoMock[T] {
 	return &AbstractRepoMock[T]{
 		repo: baserepo.New[T](),
 	}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MinSecretSize is the shortest secret tokens are signed with.
+const MinSecretSize = 32
+
+var (
+	ErrUnauthenticated = errors.New("not authenticated")
+	ErrInvalidToken    = errors.New("invalid token")
+)
+
+// Subject is who performs a request. The zero value is an anonymous one.
+type Subject struct {
+	userID  int64
+	user    bool
+	service string
+}
+
+// User is the subject of a user who presented a token.
+func User(id int64) Subject {
+	return Subject{userID: id, user: true}
+}
+
+// Service is the subject of a service authenticated by its certificate.
+func Service(identity string) Subject {
+	return Subject{service: identity}
+}
+
+// UserID returns the ID of the user the subject is, if it is one.
+func (s Subject) UserID() (int64, bool) {
+	return s.userID, s.user
+}
+
+// Service returns the identity of the service the subject is, if it is
+// one.
+func (s Subject) Service() (string, bool) {
+	return s.service, s.service != ""
+}
+
+type ctxKey struct{}
+
+func WithSubject(ctx context.Context, s Subject) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext returns the subject put into ctx, or an anonymous one.
+func FromContext(ctx context.Context) Subject {
+	s, _ := ctx.Value(ctxKey{}).(Subject)
+	return s
+}
+
+// Tokens issues and verifies bearer tokens of users. A token names the
+// tenant and the user it is issued for and when it expires, and is signed
+// with HMAC-SHA256, so only those who know the secret can issue one.
+type Tokens struct {
+	secret []byte
+	now    func() time.Time
+}
+
+type claims struct {
+	Tenant  string `json:"tenant"`
+	User    int64  `json:"user"`
+	Expires int64  `json:"exp"`
+}
+
+func NewTokens(secret []byte) (*Tokens, error) {
+	if len(secret) < MinSecretSize {
+		return nil, fmt.Errorf("secret is shorter than %d bytes", MinSecretSize)
+	}
+	return &Tokens{secret: secret, now: time.Now}, nil
+}
+
+// LoadTokens reads the secret from path, surrounding whitespace is not a
+// part of it.
+func LoadTokens(path string) (*Tokens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read secret: %w", err)
+	}
+	return NewTokens(bytes.TrimSpace(data))
+}
+
+// Issue returns a token of the user with userID in the tenant with tenantID
+// valid for ttl.
+func (t *Tokens) Issue(tenantID string, userID int64, ttl time.Duration) (string, error) {
+	payload, err := json.Marshal(claims{Tenant: tenantID, User: userID, Expires: t.now().Add(ttl).Unix()})
+	if err != nil {
+		return "", fmt.Errorf("can't encode token: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(t.sign(encoded)), nil
+}
+
+func (t *Tokens) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// Verify returns the user token is issued for, tokens of other tenants are
+// invalid.
+func (t *Tokens) Verify(tenantID string, token string) (Subject, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Subject{}, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, t.sign(encoded)) {
+		return Subject{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Subject{}, ErrInvalidToken
+	}
+	var c claims
+	if err = json.Unmarshal(payload, &c); err != nil {
+		return Subject{}, ErrInvalidToken
+	}
+	if c.Tenant != tenantID {
+		return Subject{}, fmt.Errorf("%w: issued for another tenant", ErrInvalidToken)
+	}
+	if t.now().Unix() >= c.Expires {
+		return Subject{}, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	return User(c.User), nil
+}
+
+// Authenticate verifies the bearer token of an Authorization header value,
+// requests without one are anonymous.
+func (t *Tokens) Authenticate(tenantID string, authorization string) (Subject, error) {
+	if authorization == "" {
+		return Subject{}, nil
+	}
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return Subject{}, fmt.Errorf("%w: bearer token expected", ErrInvalidToken)
+	}
+	return t.Verify(tenantID, strings.TrimSpace(token))
+}
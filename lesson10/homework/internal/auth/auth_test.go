@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokens(t *testing.T, secret string) *Tokens {
+	tokens, err := NewTokens([]byte(strings.Repeat(secret, MinSecretSize)))
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestTokens(t *testing.T) {
+	tokens := newTokens(t, "s")
+	token, err := tokens.Issue("ru", 7, time.Hour)
+	require.NoError(t, err)
+
+	subject, err := tokens.Verify("ru", token)
+	assert.NoError(t, err)
+	id, ok := subject.UserID()
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), id)
+
+	_, err = tokens.Verify("kz", token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "token of another tenant")
+	_, err = newTokens(t, "o").Verify("ru", token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "token signed with another secret")
+
+	encoded, signature, _ := strings.Cut(token, ".")
+	forged, err := tokens.Issue("ru", 0, time.Hour)
+	require.NoError(t, err)
+	forgedEncoded, _, _ := strings.Cut(forged, ".")
+	_, err = tokens.Verify("ru", forgedEncoded+"."+signature)
+	assert.ErrorIs(t, err, ErrInvalidToken, "claims of another token")
+	_, err = tokens.Verify("ru", encoded)
+	assert.ErrorIs(t, err, ErrInvalidToken, "no signature")
+
+	tokens.now = func() time.Time { return time.Now().Add(time.Hour) }
+	_, err = tokens.Verify("ru", token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "expired token")
+}
+
+func TestAuthenticate(t *testing.T) {
+	tokens := newTokens(t, "s")
+	token, err := tokens.Issue("", 3, time.Hour)
+	require.NoError(t, err)
+
+	subject, err := tokens.Authenticate("", "")
+	assert.NoError(t, err)
+	_, ok := subject.UserID()
+	assert.False(t, ok, "requests without a token are anonymous")
+
+	subject, err = tokens.Authenticate("", "bearer "+token)
+	assert.NoError(t, err)
+	id, _ := subject.UserID()
+	assert.Equal(t, int64(3), id)
+
+	_, err = tokens.Authenticate("", "Basic "+token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = tokens.Authenticate("", "Bearer x")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestLoadTokens(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(path, append(bytes.Repeat([]byte("s"), MinSecretSize), '\n'), 0o600))
+	_, err := LoadTokens(path)
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("short\n"), 0o600))
+	_, err = LoadTokens(path)
+	assert.Error(t, err)
+	_, err = LoadTokens(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,251 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrDraining = errors.New("service is shutting down")
+
+// State of a service, it only moves forward.
+type State int
+
+const (
+	StateReady State = iota
+	// StateNotReady still serves requests, it gives load balancers time
+	// to stop sending them.
+	StateNotReady
+	// StateDraining rejects new requests and waits for in-flight ones.
+	StateDraining
+	StateStopped
+)
+
+var stateNames = map[State]string{
+	StateReady:    "ready",
+	StateNotReady: "not ready",
+	StateDraining: "draining",
+	StateStopped:  "stopped",
+}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+type Options struct {
+	// Delay is how long the service keeps serving once it is not ready.
+	Delay time.Duration
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager counts in-flight requests and shuts a service down in stages:
+// it marks the service not ready, drains servers and requests, then flushes
+// persistence.
+type Manager struct {
+	logger   *log.Logger
+	opts     Options
+	mu       sync.Mutex
+	state    State
+	inFlight int
+	// idle is closed once the last in-flight request ends while draining
+	idle     chan struct{}
+	notReady []func()
+	drain    []hook
+	flush    []hook
+	once     sync.Once
+	err      error
+}
+
+type Stats struct {
+	State    string `json:"state"`
+	InFlight int    `json:"in_flight"`
+}
+
+func NewManager(logger *log.Logger, opts Options) *Manager {
+	return &Manager{
+		logger: logger,
+		opts:   opts,
+		idle:   make(chan struct{}),
+	}
+}
+
+// OnNotReady adds fn called once the service is marked not ready, e.g. to
+// fail health checks.
+func (m *Manager) OnNotReady(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notReady = append(m.notReady, fn)
+}
+
+// OnDrain adds fn that stops a server, it returns once connections of the
+// server are closed. Servers are drained in the order they are added.
+func (m *Manager) OnDrain(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.drain = append(m.drain, hook{name: name, fn: fn})
+}
+
+// OnFlush adds fn called after requests are drained, even if draining timed
+// out, e.g. to close repositories.
+func (m *Manager) OnFlush(name string, fn func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flush = append(m.flush, hook{name: name, fn: func(context.Context) error { return fn() }})
+}
+
+func (m *Manager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Stats{State: m.state.String(), InFlight: m.inFlight}
+}
+
+// Begin counts a request in, end counts it out. Requests are rejected with
+// ErrDraining once draining starts.
+func (m *Manager) Begin() (end func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state >= StateDraining {
+		return nil, ErrDraining
+	}
+	m.inFlight++
+	var once sync.Once
+	return func() {
+		once.Do(m.end)
+	}, nil
+}
+
+func (m *Manager) end() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	if m.inFlight == 0 && m.state >= StateDraining {
+		close(m.idle)
+	}
+}
+
+func (m *Manager) setState(state State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = state
+	if state == StateDraining && m.inFlight == 0 {
+		close(m.idle)
+	}
+}
+
+// Shutdown runs the stages once, later calls return the result of the
+// first one. Servers are stopped at once when ctx is done.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.once.Do(func() {
+		m.err = m.shutdown(ctx)
+	})
+	return m.err
+}
+
+func (m *Manager) shutdown(ctx context.Context) error {
+	errs := make([]string, 0)
+
+	m.logger.Println("marking service not ready")
+	m.setState(StateNotReady)
+	for _, fn := range m.notReady {
+		fn()
+	}
+	select {
+	case <-time.After(m.opts.Delay):
+	case <-ctx.Done():
+	}
+
+	m.setState(StateDraining)
+	for _, h := range m.drain {
+		m.logger.Printf("stopping %s\n", h.name)
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("can't stop %s: %s", h.name, err.Error()))
+		}
+	}
+	select {
+	case <-m.idle:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Sprintf("can't drain %d requests: %s", m.Stats().InFlight, ctx.Err().Error()))
+	}
+
+	for _, h := range m.flush {
+		m.logger.Printf("flushing %s\n", h.name)
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("can't flush %s: %s", h.name, err.Error()))
+		}
+	}
+	m.setState(StateStopped)
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// healthPrefix is the health service, it keeps answering while draining.
+const healthPrefix = "/grpc.health.v1.Health/"
+
+// UnaryServerInterceptor counts calls as in-flight requests.
+func (m *Manager) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasPrefix(info.FullMethod, healthPrefix) {
+			return handler(ctx, req)
+		}
+		end, err := m.Begin()
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		defer end()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor counts open streams as in-flight requests.
+func (m *Manager) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, healthPrefix) {
+			return handler(srv, ss)
+		}
+		end, err := m.Begin()
+		if err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		defer end()
+		return handler(srv, ss)
+	}
+}
+
+// StopGRPC stops server gracefully, or at once when ctx is done first.
+func StopGRPC(server *grpc.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			server.Stop()
+			return ctx.Err()
+		}
+	}
+}
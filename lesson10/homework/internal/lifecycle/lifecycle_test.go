@@ -0,0 +1,94 @@
+package lifecycle_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/lifecycle"
+)
+
+func newManager(delay time.Duration) *lifecycle.Manager {
+	return lifecycle.NewManager(log.New(io.Discard, "", 0), lifecycle.Options{Delay: delay})
+}
+
+func TestShutdown(t *testing.T) {
+	m := newManager(200 * time.Millisecond)
+	assert.Equal(t, lifecycle.StateReady, m.State())
+
+	var (
+		mu     sync.Mutex
+		stages []string
+	)
+	record := func(stage string) {
+		mu.Lock()
+		defer mu.Unlock()
+		stages = append(stages, stage)
+	}
+	m.OnNotReady(func() { record("not ready") })
+	m.OnDrain("http", func(context.Context) error {
+		record("drain http")
+		return nil
+	})
+	m.OnDrain("grpc", func(context.Context) error {
+		record("drain grpc")
+		return nil
+	})
+	m.OnFlush("repo", func() error {
+		record("flush")
+		return nil
+	})
+
+	end, err := m.Begin()
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		done <- m.Shutdown(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool { return m.State() == lifecycle.StateNotReady }, time.Second, time.Millisecond)
+	second, err := m.Begin()
+	assert.NoError(t, err, "requests are served until draining")
+	second()
+
+	assert.Eventually(t, func() bool { return m.State() == lifecycle.StateDraining }, time.Second, time.Millisecond)
+	_, err = m.Begin()
+	assert.ErrorIs(t, err, lifecycle.ErrDraining)
+	assert.Equal(t, 1, m.Stats().InFlight)
+	select {
+	case <-done:
+		t.Fatal("shutdown doesn't wait for in-flight requests")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	end()
+	end()
+	assert.NoError(t, <-done)
+	assert.Equal(t, lifecycle.StateStopped, m.State())
+	assert.Equal(t, 0, m.Stats().InFlight, "end counts a request out once")
+	assert.Equal(t, []string{"not ready", "drain http", "drain grpc", "flush"}, stages)
+	assert.NoError(t, m.Shutdown(context.Background()), "shutdown runs once")
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	m := newManager(0)
+	flushed := false
+	m.OnFlush("repo", func() error {
+		flushed = true
+		return nil
+	})
+
+	_, err := m.Begin()
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = m.Shutdown(ctx)
+	assert.ErrorContains(t, err, "can't drain 1 requests")
+	assert.True(t, flushed, "persistence is flushed whatever happens")
+	assert.Equal(t, lifecycle.StateStopped, m.State())
+}
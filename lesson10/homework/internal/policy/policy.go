@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"errors"
+
+	"homework10/internal/ads"
+)
+
+var (
+	ErrForbidden = errors.New("operation is forbidden")
+	ErrBlocked   = errors.New("user is blocked")
+)
+
+type Action string
+
+const (
+	UpdateUser     Action = "update_user"
+	DeleteUser     Action = "delete_user"
+	BlockUser      Action = "block_user"
+	SetUserRole    Action = "set_user_role"
+	CreateAd       Action = "create_ad"
+	UpdateAd       Action = "update_ad"
+	ChangeAdStatus Action = "change_ad_status"
+	UnpublishAd    Action = "unpublish_ad"
+	DeleteAd       Action = "delete_ad"
+)
+
+// Scope tells whose resources a rule is about.
+type Scope int
+
+const (
+	Own Scope = iota
+	Any
+)
+
+// Rule allows users with Role or a role above it to perform Action on
+// resources in Scope.
+type Rule struct {
+	Role   ads.Role
+	Action Action
+	Scope  Scope
+}
+
+// Policy allows what one of its rules allows and forbids everything else.
+type Policy []Rule
+
+var Default = Policy{
+	{Role: ads.RoleUser, Action: UpdateUser, Scope: Own},
+	{Role: ads.RoleUser, Action: DeleteUser, Scope: Own},
+	{Role: ads.RoleUser, Action: CreateAd, Scope: Own},
+	{Role: ads.RoleUser, Action: UpdateAd, Scope: Own},
+	{Role: ads.RoleUser, Action: ChangeAdStatus, Scope: Own},
+	{Role: ads.RoleUser, Action: DeleteAd, Scope: Own},
+
+	{Role: ads.RoleModerator, Action: UnpublishAd, Scope: Any},
+
+	{Role: ads.RoleAdmin, Action: UpdateUser, Scope: Any},
+	{Role: ads.RoleAdmin, Action: DeleteUser, Scope: Any},
+	{Role: ads.RoleAdmin, Action: BlockUser, Scope: Any},
+	{Role: ads.RoleAdmin, Action: SetUserRole, Scope: Any},
+	{Role: ads.RoleAdmin, Action: DeleteAd, Scope: Any},
+}
+
+// Check tells whether actor may perform action on a resource of the user
+// with ownerID.
+func (p Policy) Check(actor *ads.User, action Action, ownerID int64) error {
+	if actor.Blocked {
+		return ErrBlocked
+	}
+	for _, rule := range p {
+		if rule.Action != action || actor.Role < rule.Role {
+			continue
+		}
+		if rule.Scope == Any || ownerID == actor.ID {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/ads"
+)
+
+func TestDefault(t *testing.T) {
+	const self, other = 1, 2
+	user := &ads.User{RepoEntity: ads.RepoEntity{ID: self}, Role: ads.RoleUser}
+	moderator := &ads.User{RepoEntity: ads.RepoEntity{ID: self}, Role: ads.RoleModerator}
+	admin := &ads.User{RepoEntity: ads.RepoEntity{ID: self}, Role: ads.RoleAdmin}
+	blockedAdmin := &ads.User{RepoEntity: ads.RepoEntity{ID: self}, Role: ads.RoleAdmin, Blocked: true}
+
+	tests := []struct {
+		Actor  *ads.User
+		Action Action
+		Owner  int64
+		Err    error
+	}{
+		{Actor: user, Action: CreateAd, Owner: self},
+		{Actor: user, Action: UpdateAd, Owner: self},
+		{Actor: user, Action: UpdateAd, Owner: other, Err: ErrForbidden},
+		{Actor: user, Action: ChangeAdStatus, Owner: self},
+		{Actor: user, Action: ChangeAdStatus, Owner: other, Err: ErrForbidden},
+		{Actor: user, Action: DeleteAd, Owner: self},
+		{Actor: user, Action: DeleteAd, Owner: other, Err: ErrForbidden},
+		{Actor: user, Action: UpdateUser, Owner: self},
+		{Actor: user, Action: UpdateUser, Owner: other, Err: ErrForbidden},
+		{Actor: user, Action: DeleteUser, Owner: self},
+		{Actor: user, Action: DeleteUser, Owner: other, Err: ErrForbidden},
+		{Actor: user, Action: UnpublishAd, Owner: other, Err: ErrForbidden},
+		{Actor: user, Action: BlockUser, Owner: other, Err: ErrForbidden},
+		{Actor: user, Action: SetUserRole, Owner: self, Err: ErrForbidden},
+
+		{Actor: moderator, Action: UpdateAd, Owner: self},
+		{Actor: moderator, Action: UpdateAd, Owner: other, Err: ErrForbidden},
+		{Actor: moderator, Action: UnpublishAd, Owner: other},
+		{Actor: moderator, Action: DeleteAd, Owner: other, Err: ErrForbidden},
+		{Actor: moderator, Action: BlockUser, Owner: other, Err: ErrForbidden},
+		{Actor: moderator, Action: UpdateUser, Owner: other, Err: ErrForbidden},
+
+		{Actor: admin, Action: UpdateAd, Owner: other, Err: ErrForbidden},
+		{Actor: admin, Action: UnpublishAd, Owner: other},
+		{Actor: admin, Action: DeleteAd, Owner: other},
+		{Actor: admin, Action: UpdateUser, Owner: other},
+		{Actor: admin, Action: DeleteUser, Owner: other},
+		{Actor: admin, Action: BlockUser, Owner: other},
+		{Actor: admin, Action: SetUserRole, Owner: other},
+
+		{Actor: blockedAdmin, Action: CreateAd, Owner: self, Err: ErrBlocked},
+		{Actor: blockedAdmin, Action: BlockUser, Owner: other, Err: ErrBlocked},
+	}
+
+	for _, test := range tests {
+		err := Default.Check(test.Actor, test.Action, test.Owner)
+		name := test.Actor.Role.String() + " " + string(test.Action)
+		if test.Err != nil {
+			assert.ErrorIs(t, err, test.Err, name)
+			continue
+		}
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestCustomPolicy(t *testing.T) {
+	p := Policy{{Role: ads.RoleModerator, Action: CreateAd, Scope: Own}}
+	user := &ads.User{Role: ads.RoleUser}
+	admin := &ads.User{Role: ads.RoleAdmin}
+
+	assert.ErrorIs(t, p.Check(user, CreateAd, 0), ErrForbidden)
+	assert.NoError(t, p.Check(admin, CreateAd, 0), "roles above the rule one are allowed too")
+	assert.ErrorIs(t, p.Check(admin, DeleteAd, 0), ErrForbidden, "nothing is allowed without a rule")
+}
@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	grpcPort "homework10/internal/ports/grpc"
+	"homework10/internal/tenant"
+)
+
+const OpenAPIPath = "/api/v2/openapi.json"
+
+type Server struct {
+	server *http.Server
+}
+
+// NewHTTPServer serves the REST mapping from service.proto and proxies
+// every call to the gRPC service behind conn.
+func NewHTTPServer(ctx context.Context, port string, conn *grpc.ClientConn) (Server, error) {
+	handler, err := NewHandler(ctx, conn)
+	if err != nil {
+		return Server{}, err
+	}
+	return Server{
+		server: &http.Server{
+			Addr:    port,
+			Handler: handler,
+		},
+	}, nil
+}
+
+func NewHandler(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	// proto field names keep the JSON in line with the gin API
+	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			UseProtoNames:   true,
+			EmitUnpopulated: true,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
+	}), runtime.WithIncomingHeaderMatcher(headerMatcher))
+	err := mux.HandlePath(http.MethodGet, OpenAPIPath, func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(grpcPort.OpenAPISpec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = grpcPort.RegisterAdServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// headerMatcher passes the tenant header on as GRPC metadata, the host is
+// passed by the gateway itself as x-forwarded-host and the Authorization
+// header as authorization.
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, tenant.Header) {
+		return tenant.MetadataKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+func (s *Server) Listen() error {
+	return s.server.ListenAndServe()
+}
+
+// ListenTLS serves HTTPS with certificates from config.
+func (s *Server) ListenTLS(config *tls.Config) error {
+	s.server.TLSConfig = config
+	return s.server.ListenAndServeTLS("", "")
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,38 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"homework10/internal/auth"
+	"homework10/internal/tenant"
+)
+
+// authorizationKey carries the bearer token of the user who makes a call,
+// the gateway passes the Authorization header in it.
+const authorizationKey = "authorization"
+
+// AuthUnaryInterceptor puts the user of the bearer token of a call into the
+// context. Calls without a token keep the subject they have, the service
+// IdentityUnaryInterceptor found or an anonymous one, so a service acts on
+// its own unless it passes the token of a user. Tokens are issued per
+// tenant, so it runs after TenantUnaryInterceptor.
+func AuthUnaryInterceptor(tokens *auth.Tokens) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		authorization := first(md, authorizationKey)
+		if authorization == "" {
+			return handler(ctx, req)
+		}
+		id, _ := tenant.IDFromContext(ctx)
+		subject, err := tokens.Authenticate(id, authorization)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(auth.WithSubject(ctx, subject), req)
+	}
+}
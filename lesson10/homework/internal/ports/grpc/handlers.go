@@ -5,129 +5,287 @@ import (
 	"errors"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"homework10/internal/ads"
 	"homework10/internal/app"
+	"homework10/internal/auth"
+	"homework10/internal/policy"
+	"homework10/internal/tenant"
+	"time"
 )
 
 type Server struct {
 	UnimplementedAdServiceServer
-	a app.App
+	tenants *tenant.Registry
 }
 
 func NewService(a app.App) *Server {
+	return NewTenantService(tenant.Single(a))
+}
+
+// NewTenantService serves every tenant of tenants with its own App, the
+// tenant of a call is put into the context by TenantUnaryInterceptor.
+func NewTenantService(tenants *tenant.Registry) *Server {
 	return &Server{
-		a: a,
+		tenants: tenants,
+	}
+}
+
+func (s *Server) app(ctx context.Context) (app.App, error) {
+	a, err := s.tenants.App(ctx)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	return a, nil
 }
 
 func adToAdResponse(ad *ads.Ad) *AdResponse {
 	return &AdResponse{
-		Id:        ad.ID,
-		Title:     ad.Title,
-		Text:      ad.Text,
-		AuthorId:  ad.AuthorID,
-		Published: ad.Published,
+		Id:             ad.ID,
+		Title:          ad.Title,
+		Text:           ad.Text,
+		AuthorId:       ad.AuthorID,
+		Published:      ad.Published,
+		CreationTime:   timestamppb.New(ad.CreationTime),
+		LastUpdateTime: timestamppb.New(ad.LastUpdateTime),
 	}
 }
 
+// timeOf keeps an unset bound zero, as AdsQuery expects it.
+func timeOf(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
 func userToUserResponse(user *ads.User) *UserResponse {
 	return &UserResponse{
-		Id:    user.ID,
-		Name:  user.Nickname,
-		Email: user.Email,
+		Id:       user.ID,
+		Nickname: user.Nickname,
+		Email:    user.Email,
+		Role:     user.Role.String(),
+		Blocked:  user.Blocked,
+	}
+}
+
+func (s *Server) CreateUser(ctx context.Context, req *CreateUserRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.CreateUser(req.Nickname, req.Email)
+	if err != nil {
+		return nil, status.Error(getStatusByError(err), err.Error())
 	}
+	return userToUserResponse(user), nil
 }
 
-func (s *Server) CreateUser(_ context.Context, req *CreateUserRequest) (*UserResponse, error) {
-	user, err := s.a.CreateUser(req.Name, req.Email)
+func (s *Server) GetUser(ctx context.Context, req *GetUserRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.GetUser(req.Id)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return userToUserResponse(user), nil
 }
 
-func (s *Server) GetUser(_ context.Context, req *GetUserRequest) (*UserResponse, error) {
-	user, err := s.a.GetUser(req.Id)
+func (s *Server) UpdateUser(ctx context.Context, req *UpdateUserRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.UpdateUser(req.Id, auth.FromContext(ctx), req.Nickname, req.Email)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return userToUserResponse(user), nil
 }
 
-func (s *Server) UpdateUser(_ context.Context, req *UpdateUserRequest) (*UserResponse, error) {
-	user, err := s.a.UpdateUser(req.Id, req.Name, req.Email)
+func (s *Server) PatchUser(ctx context.Context, req *PatchUserRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := userPatch(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	user, err := a.PatchUser(req.Id, auth.FromContext(ctx), patch)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return userToUserResponse(user), nil
 }
 
-func (s *Server) FindUser(_ context.Context, req *FindUserRequest) (*UserResponse, error) {
-	user, err := s.a.FindUser(req.Query)
+func (s *Server) FindUser(ctx context.Context, req *FindUserRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.FindUser(req.Query)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return userToUserResponse(user), nil
 }
 
-func (s *Server) DeleteUser(_ context.Context, req *DeleteUserRequest) (*UserResponse, error) {
-	user, err := s.a.DeleteUser(req.Id)
+func (s *Server) DeleteUser(ctx context.Context, req *DeleteUserRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.DeleteUser(req.Id, auth.FromContext(ctx))
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return userToUserResponse(user), nil
 }
 
-func (s *Server) ListAds(_ context.Context, req *ListAdsRequest) (*ListAdResponse, error) {
+func (s *Server) ListAds(ctx context.Context, req *ListAdsRequest) (*ListAdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
 	result := make([]*AdResponse, 0)
-	for _, ad := range s.a.ListAds(req.Bitmask) {
+	query := app.AdsQuery{
+		Bitmask:     req.Bitmask,
+		CreatedFrom: timeOf(req.CreatedFrom),
+		CreatedTo:   timeOf(req.CreatedTo),
+		UpdatedFrom: timeOf(req.UpdatedFrom),
+		UpdatedTo:   timeOf(req.UpdatedTo),
+	}
+	for _, ad := range a.SearchAds(query) {
 		result = append(result, adToAdResponse(ad))
 	}
 	return &ListAdResponse{List: result}, nil
 }
 
-func (s *Server) CreateAd(_ context.Context, req *CreateAdRequest) (*AdResponse, error) {
-	ad, err := s.a.CreateAd(req.Title, req.Text, req.UserId)
+func (s *Server) CreateAd(ctx context.Context, req *CreateAdRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := a.CreateAd(req.Title, req.Text, auth.FromContext(ctx))
+	if err != nil {
+		return nil, status.Error(getStatusByError(err), err.Error())
+	}
+	return adToAdResponse(ad), nil
+}
+
+func (s *Server) GetAd(ctx context.Context, req *GetAdRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := a.GetAd(req.Id)
+	if err != nil {
+		return nil, status.Error(getStatusByError(err), err.Error())
+	}
+	return adToAdResponse(ad), nil
+}
+
+func (s *Server) UpdateAd(ctx context.Context, req *UpdateAdRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := a.UpdateAd(req.AdId, auth.FromContext(ctx), req.Title, req.Text)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return adToAdResponse(ad), nil
 }
 
-func (s *Server) GetAd(_ context.Context, req *GetAdRequest) (*AdResponse, error) {
-	ad, err := s.a.GetAd(req.Id)
+func (s *Server) PatchAd(ctx context.Context, req *PatchAdRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := adPatch(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ad, err := a.PatchAd(req.AdId, auth.FromContext(ctx), patch)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return adToAdResponse(ad), nil
 }
 
-func (s *Server) UpdateAd(_ context.Context, req *UpdateAdRequest) (*AdResponse, error) {
-	ad, err := s.a.UpdateAd(req.AdId, req.UserId, req.Title, req.Text)
+func (s *Server) ChangeAdStatus(ctx context.Context, req *ChangeAdStatusRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := a.ChangeAdStatus(req.AdId, auth.FromContext(ctx), req.Published)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return adToAdResponse(ad), nil
 }
 
-func (s *Server) ChangeAdStatus(_ context.Context, req *ChangeAdStatusRequest) (*AdResponse, error) {
-	ad, err := s.a.ChangeAdStatus(req.AdId, req.UserId, req.Published)
+func (s *Server) FindAd(ctx context.Context, req *FindAdRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := a.FindAd(req.Query)
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return adToAdResponse(ad), nil
 }
 
-func (s *Server) FindAd(_ context.Context, req *FindAdRequest) (*AdResponse, error) {
-	ad, err := s.a.FindAd(req.Query)
+func (s *Server) DeleteAd(ctx context.Context, req *DeleteAdRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := a.DeleteAd(req.AdId, auth.FromContext(ctx))
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
 	return adToAdResponse(ad), nil
 }
 
-func (s *Server) DeleteAd(_ context.Context, req *DeleteAdRequest) (*AdResponse, error) {
-	ad, err := s.a.DeleteAd(req.AdId, req.AuthorId)
+func (s *Server) BlockUser(ctx context.Context, req *BlockUserRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.BlockUser(req.Id, auth.FromContext(ctx), req.Blocked)
+	if err != nil {
+		return nil, status.Error(getStatusByError(err), err.Error())
+	}
+	return userToUserResponse(user), nil
+}
+
+func (s *Server) SetUserRole(ctx context.Context, req *SetUserRoleRequest) (*UserResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	role, err := ads.ParseRole(req.Role)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	user, err := a.SetUserRole(req.Id, auth.FromContext(ctx), role)
+	if err != nil {
+		return nil, status.Error(getStatusByError(err), err.Error())
+	}
+	return userToUserResponse(user), nil
+}
+
+func (s *Server) UnpublishAd(ctx context.Context, req *UnpublishAdRequest) (*AdResponse, error) {
+	a, err := s.app(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := a.UnpublishAd(req.AdId, auth.FromContext(ctx))
 	if err != nil {
 		return nil, status.Error(getStatusByError(err), err.Error())
 	}
@@ -136,7 +294,9 @@ func (s *Server) DeleteAd(_ context.Context, req *DeleteAdRequest) (*AdResponse,
 
 func getStatusByError(err error) codes.Code {
 	switch {
-	case errors.Is(err, app.ErrNotUsersAd):
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return codes.Unauthenticated
+	case errors.Is(err, app.ErrNotUsersAd), errors.Is(err, policy.ErrForbidden), errors.Is(err, policy.ErrBlocked):
 		return codes.PermissionDenied
 	case errors.Is(err, app.ErrValidation):
 		return codes.InvalidArgument
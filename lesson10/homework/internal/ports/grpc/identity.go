@@ -0,0 +1,86 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"homework10/internal/auth"
+)
+
+// ParseIdentities parses a comma separated list of
+// "<certificate common name>=<service identity>" pairs.
+func ParseIdentities(s string) (map[string]string, error) {
+	identities := make(map[string]string)
+	if s == "" {
+		return identities, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, identity, ok := strings.Cut(pair, "=")
+		name, identity = strings.TrimSpace(name), strings.TrimSpace(identity)
+		if !ok || name == "" || identity == "" {
+			return nil, fmt.Errorf("invalid identity mapping: %q", pair)
+		}
+		identities[name] = identity
+	}
+	return identities, nil
+}
+
+// IdentityUnaryInterceptor maps the verified client certificate of the
+// caller to its service identity, puts the service into the context as the
+// subject of the call and rejects callers without one. It is meant for
+// servers that require client certificates, what a service may do is up to
+// the roles the app gives services.
+func IdentityUnaryInterceptor(identities map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := identify(ctx, identities)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// IdentityStreamInterceptor is IdentityUnaryInterceptor for streams.
+func IdentityStreamInterceptor(identities map[string]string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := identify(ss.Context(), identities)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identifiedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func identify(ctx context.Context, identities map[string]string) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no peer")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no verified client certificate")
+	}
+	name := info.State.VerifiedChains[0][0].Subject.CommonName
+	identity, ok := identities[name]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "unknown client certificate: %s", name)
+	}
+	return auth.WithSubject(ctx, auth.Service(identity)), nil
+}
+
+// identifiedStream is a stream with the context of its caller.
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identifiedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,10 @@
+package grpc
+
+import _ "embed"
+
+//go:generate protoc -I . -I third_party --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative --grpc-gateway_out=. --grpc-gateway_opt=paths=source_relative --openapiv2_out=. --openapiv2_opt=json_names_for_fields=false service.proto
+
+// OpenAPISpec describes the REST API served by the generated gateway.
+//
+//go:embed service.swagger.json
+var OpenAPISpec []byte
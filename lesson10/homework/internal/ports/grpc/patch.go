@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+
+	"homework10/internal/app"
+)
+
+// maskedFields returns names of the fields of msg in mask, or of the
+// non-empty ones if mask is empty.
+func maskedFields(msg proto.Message, mask *fieldmaskpb.FieldMask) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	if len(mask.GetPaths()) == 0 {
+		msg.ProtoReflect().Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			fields[string(field.Name())] = true
+			return true
+		})
+		return fields, nil
+	}
+	if !mask.IsValid(msg) {
+		return nil, fmt.Errorf("invalid update mask %v", mask.GetPaths())
+	}
+	for _, path := range mask.GetPaths() {
+		fields[path] = true
+	}
+	return fields, nil
+}
+
+func userPatch(req *PatchUserRequest) (app.UserPatch, error) {
+	user := req.GetUser()
+	if user == nil {
+		user = &UserPatch{}
+	}
+	fields, err := maskedFields(user, req.GetUpdateMask())
+	if err != nil {
+		return app.UserPatch{}, err
+	}
+	var patch app.UserPatch
+	if fields["nickname"] {
+		patch.Nickname = &user.Nickname
+	}
+	if fields["email"] {
+		patch.Email = &user.Email
+	}
+	return patch, nil
+}
+
+func adPatch(req *PatchAdRequest) (app.AdPatch, error) {
+	ad := req.GetAd()
+	if ad == nil {
+		ad = &AdPatch{}
+	}
+	fields, err := maskedFields(ad, req.GetUpdateMask())
+	if err != nil {
+		return app.AdPatch{}, err
+	}
+	var patch app.AdPatch
+	if fields["title"] {
+		patch.Title = &ad.Title
+	}
+	if fields["text"] {
+		patch.Text = &ad.Text
+	}
+	return patch, nil
+}
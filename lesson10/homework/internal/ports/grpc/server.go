@@ -6,12 +6,20 @@ import (
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
 	"google.golang.org/grpc"
 	"homework10/internal/app"
+	"homework10/internal/tenant"
 	"log"
 )
 
-func NewGRPCServer(logger *log.Logger, a app.App) *grpc.Server {
+// NewGRPCServer accepts extra options, e.g. credentials; interceptors passed
+// there run after the logger and panic ones.
+func NewGRPCServer(logger *log.Logger, a app.App, opts ...grpc.ServerOption) *grpc.Server {
+	return NewTenantGRPCServer(logger, tenant.Single(a), opts...)
+}
+
+// NewTenantGRPCServer serves every tenant of tenants with its own App.
+func NewTenantGRPCServer(logger *log.Logger, tenants *tenant.Registry, opts ...grpc.ServerOption) *grpc.Server {
 	// logger и panic interceptor
-	server := grpc.NewServer(
+	opts = append([]grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(
 			logging.UnaryServerInterceptor(
 				logging.LoggerFunc(func(_ context.Context, _ logging.Level, msg string, fields ...any) {
@@ -22,8 +30,10 @@ func NewGRPCServer(logger *log.Logger, a app.App) *grpc.Server {
 				logger.Printf("panic: %v\n", p)
 				return
 			})),
+			TenantUnaryInterceptor(tenants),
 		),
-	)
-	RegisterAdServiceServer(server, NewService(a))
+	}, opts...)
+	server := grpc.NewServer(opts...)
+	RegisterAdServiceServer(server, NewTenantService(tenants))
 	return server
 }
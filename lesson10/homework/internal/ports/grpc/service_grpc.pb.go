@@ -25,15 +25,24 @@ type AdServiceClient interface {
 	CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
+	// only fields in update_mask are changed, the gateway fills it with the
+	// fields of the JSON body
+	PatchUser(ctx context.Context, in *PatchUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 	FindUser(ctx context.Context, in *FindUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 	DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 	ListAds(ctx context.Context, in *ListAdsRequest, opts ...grpc.CallOption) (*ListAdResponse, error)
 	CreateAd(ctx context.Context, in *CreateAdRequest, opts ...grpc.CallOption) (*AdResponse, error)
 	GetAd(ctx context.Context, in *GetAdRequest, opts ...grpc.CallOption) (*AdResponse, error)
 	UpdateAd(ctx context.Context, in *UpdateAdRequest, opts ...grpc.CallOption) (*AdResponse, error)
+	// only fields in update_mask are changed and validated
+	PatchAd(ctx context.Context, in *PatchAdRequest, opts ...grpc.CallOption) (*AdResponse, error)
 	ChangeAdStatus(ctx context.Context, in *ChangeAdStatusRequest, opts ...grpc.CallOption) (*AdResponse, error)
 	FindAd(ctx context.Context, in *FindAdRequest, opts ...grpc.CallOption) (*AdResponse, error)
 	DeleteAd(ctx context.Context, in *DeleteAdRequest, opts ...grpc.CallOption) (*AdResponse, error)
+	// admin operations, the policy of the service decides who may call them
+	BlockUser(ctx context.Context, in *BlockUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
+	SetUserRole(ctx context.Context, in *SetUserRoleRequest, opts ...grpc.CallOption) (*UserResponse, error)
+	UnpublishAd(ctx context.Context, in *UnpublishAdRequest, opts ...grpc.CallOption) (*AdResponse, error)
 }
 
 type adServiceClient struct {
@@ -71,6 +80,15 @@ func (c *adServiceClient) UpdateUser(ctx context.Context, in *UpdateUserRequest,
 	return out, nil
 }
 
+func (c *adServiceClient) PatchUser(ctx context.Context, in *PatchUserRequest, opts ...grpc.CallOption) (*UserResponse, error) {
+	out := new(UserResponse)
+	err := c.cc.Invoke(ctx, "/ad.AdService/PatchUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *adServiceClient) FindUser(ctx context.Context, in *FindUserRequest, opts ...grpc.CallOption) (*UserResponse, error) {
 	out := new(UserResponse)
 	err := c.cc.Invoke(ctx, "/ad.AdService/FindUser", in, out, opts...)
@@ -125,6 +143,15 @@ func (c *adServiceClient) UpdateAd(ctx context.Context, in *UpdateAdRequest, opt
 	return out, nil
 }
 
+func (c *adServiceClient) PatchAd(ctx context.Context, in *PatchAdRequest, opts ...grpc.CallOption) (*AdResponse, error) {
+	out := new(AdResponse)
+	err := c.cc.Invoke(ctx, "/ad.AdService/PatchAd", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *adServiceClient) ChangeAdStatus(ctx context.Context, in *ChangeAdStatusRequest, opts ...grpc.CallOption) (*AdResponse, error) {
 	out := new(AdResponse)
 	err := c.cc.Invoke(ctx, "/ad.AdService/ChangeAdStatus", in, out, opts...)
@@ -152,6 +179,33 @@ func (c *adServiceClient) DeleteAd(ctx context.Context, in *DeleteAdRequest, opt
 	return out, nil
 }
 
+func (c *adServiceClient) BlockUser(ctx context.Context, in *BlockUserRequest, opts ...grpc.CallOption) (*UserResponse, error) {
+	out := new(UserResponse)
+	err := c.cc.Invoke(ctx, "/ad.AdService/BlockUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) SetUserRole(ctx context.Context, in *SetUserRoleRequest, opts ...grpc.CallOption) (*UserResponse, error) {
+	out := new(UserResponse)
+	err := c.cc.Invoke(ctx, "/ad.AdService/SetUserRole", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) UnpublishAd(ctx context.Context, in *UnpublishAdRequest, opts ...grpc.CallOption) (*AdResponse, error) {
+	out := new(AdResponse)
+	err := c.cc.Invoke(ctx, "/ad.AdService/UnpublishAd", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AdServiceServer is the server API for AdService service.
 // All implementations must embed UnimplementedAdServiceServer
 // for forward compatibility
@@ -159,15 +213,24 @@ type AdServiceServer interface {
 	CreateUser(context.Context, *CreateUserRequest) (*UserResponse, error)
 	GetUser(context.Context, *GetUserRequest) (*UserResponse, error)
 	UpdateUser(context.Context, *UpdateUserRequest) (*UserResponse, error)
+	// only fields in update_mask are changed, the gateway fills it with the
+	// fields of the JSON body
+	PatchUser(context.Context, *PatchUserRequest) (*UserResponse, error)
 	FindUser(context.Context, *FindUserRequest) (*UserResponse, error)
 	DeleteUser(context.Context, *DeleteUserRequest) (*UserResponse, error)
 	ListAds(context.Context, *ListAdsRequest) (*ListAdResponse, error)
 	CreateAd(context.Context, *CreateAdRequest) (*AdResponse, error)
 	GetAd(context.Context, *GetAdRequest) (*AdResponse, error)
 	UpdateAd(context.Context, *UpdateAdRequest) (*AdResponse, error)
+	// only fields in update_mask are changed and validated
+	PatchAd(context.Context, *PatchAdRequest) (*AdResponse, error)
 	ChangeAdStatus(context.Context, *ChangeAdStatusRequest) (*AdResponse, error)
 	FindAd(context.Context, *FindAdRequest) (*AdResponse, error)
 	DeleteAd(context.Context, *DeleteAdRequest) (*AdResponse, error)
+	// admin operations, the policy of the service decides who may call them
+	BlockUser(context.Context, *BlockUserRequest) (*UserResponse, error)
+	SetUserRole(context.Context, *SetUserRoleRequest) (*UserResponse, error)
+	UnpublishAd(context.Context, *UnpublishAdRequest) (*AdResponse, error)
 	mustEmbedUnimplementedAdServiceServer()
 }
 
@@ -184,6 +247,9 @@ func (UnimplementedAdServiceServer) GetUser(context.Context, *GetUserRequest) (*
 func (UnimplementedAdServiceServer) UpdateUser(context.Context, *UpdateUserRequest) (*UserResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
 }
+func (UnimplementedAdServiceServer) PatchUser(context.Context, *PatchUserRequest) (*UserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PatchUser not implemented")
+}
 func (UnimplementedAdServiceServer) FindUser(context.Context, *FindUserRequest) (*UserResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method FindUser not implemented")
 }
@@ -202,6 +268,9 @@ func (UnimplementedAdServiceServer) GetAd(context.Context, *GetAdRequest) (*AdRe
 func (UnimplementedAdServiceServer) UpdateAd(context.Context, *UpdateAdRequest) (*AdResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateAd not implemented")
 }
+func (UnimplementedAdServiceServer) PatchAd(context.Context, *PatchAdRequest) (*AdResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PatchAd not implemented")
+}
 func (UnimplementedAdServiceServer) ChangeAdStatus(context.Context, *ChangeAdStatusRequest) (*AdResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ChangeAdStatus not implemented")
 }
@@ -211,6 +280,15 @@ func (UnimplementedAdServiceServer) FindAd(context.Context, *FindAdRequest) (*Ad
 func (UnimplementedAdServiceServer) DeleteAd(context.Context, *DeleteAdRequest) (*AdResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteAd not implemented")
 }
+func (UnimplementedAdServiceServer) BlockUser(context.Context, *BlockUserRequest) (*UserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BlockUser not implemented")
+}
+func (UnimplementedAdServiceServer) SetUserRole(context.Context, *SetUserRoleRequest) (*UserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUserRole not implemented")
+}
+func (UnimplementedAdServiceServer) UnpublishAd(context.Context, *UnpublishAdRequest) (*AdResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnpublishAd not implemented")
+}
 func (UnimplementedAdServiceServer) mustEmbedUnimplementedAdServiceServer() {}
 
 // UnsafeAdServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -278,6 +356,24 @@ func _AdService_UpdateUser_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AdService_PatchUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).PatchUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ad.AdService/PatchUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).PatchUser(ctx, req.(*PatchUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _AdService_FindUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(FindUserRequest)
 	if err := dec(in); err != nil {
@@ -386,6 +482,24 @@ func _AdService_UpdateAd_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AdService_PatchAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchAdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).PatchAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ad.AdService/PatchAd",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).PatchAd(ctx, req.(*PatchAdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _AdService_ChangeAdStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ChangeAdStatusRequest)
 	if err := dec(in); err != nil {
@@ -440,6 +554,60 @@ func _AdService_DeleteAd_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AdService_BlockUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).BlockUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ad.AdService/BlockUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).BlockUser(ctx, req.(*BlockUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_SetUserRole_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetUserRoleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).SetUserRole(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ad.AdService/SetUserRole",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).SetUserRole(ctx, req.(*SetUserRoleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_UnpublishAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnpublishAdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).UnpublishAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ad.AdService/UnpublishAd",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).UnpublishAd(ctx, req.(*UnpublishAdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AdService_ServiceDesc is the grpc.ServiceDesc for AdService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -459,6 +627,10 @@ var AdService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateUser",
 			Handler:    _AdService_UpdateUser_Handler,
 		},
+		{
+			MethodName: "PatchUser",
+			Handler:    _AdService_PatchUser_Handler,
+		},
 		{
 			MethodName: "FindUser",
 			Handler:    _AdService_FindUser_Handler,
@@ -483,6 +655,10 @@ var AdService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateAd",
 			Handler:    _AdService_UpdateAd_Handler,
 		},
+		{
+			MethodName: "PatchAd",
+			Handler:    _AdService_PatchAd_Handler,
+		},
 		{
 			MethodName: "ChangeAdStatus",
 			Handler:    _AdService_ChangeAdStatus_Handler,
@@ -495,6 +671,18 @@ var AdService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteAd",
 			Handler:    _AdService_DeleteAd_Handler,
 		},
+		{
+			MethodName: "BlockUser",
+			Handler:    _AdService_BlockUser_Handler,
+		},
+		{
+			MethodName: "SetUserRole",
+			Handler:    _AdService_SetUserRole_Handler,
+		},
+		{
+			MethodName: "UnpublishAd",
+			Handler:    _AdService_UnpublishAd_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "service.proto",
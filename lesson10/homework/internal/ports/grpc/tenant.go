@@ -0,0 +1,40 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"homework10/internal/tenant"
+)
+
+// forwardedHostKey is set by the gateway to the host the HTTP request was
+// made to.
+const forwardedHostKey = "x-forwarded-host"
+
+// TenantUnaryInterceptor resolves the tenant of a call from the tenant
+// metadata or the host and puts it into the context.
+func TenantUnaryInterceptor(tenants *tenant.Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		host := first(md, forwardedHostKey)
+		if host == "" {
+			host = first(md, ":authority")
+		}
+		id, err := tenants.Resolve(first(md, tenant.MetadataKey), host)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return handler(tenant.WithID(ctx, id), req)
+	}
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
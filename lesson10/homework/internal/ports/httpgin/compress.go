@@ -0,0 +1,179 @@
+package httpgin
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultCompressMinSize is the size of a response in bytes it's
+	// compressed from, smaller ones don't get any shorter.
+	DefaultCompressMinSize = 1024
+	// MaxRequestBodySize limits decompressed request bodies.
+	MaxRequestBodySize = 4 << 20
+)
+
+// encodings are content codings of responses in the order of preference.
+var encodings = []string{"br", "gzip"}
+
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "br" {
+		return brotli.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+// compressMiddleware compresses responses of at least minSize bytes with the
+// coding Accept-Encoding prefers.
+func compressMiddleware(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		header := c.GetHeader("Accept-Encoding")
+		if header == "" || c.Request.Method == http.MethodHead {
+			return
+		}
+		encoding := negotiate(header, encodings, matchEncoding)
+		if encoding == "" {
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: minSize}
+		c.Writer = w
+		defer func() {
+			if err := w.Close(); err != nil {
+				_ = c.Error(err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+func matchEncoding(value string, offer string) int {
+	switch value {
+	case "*":
+		return 0
+	case offer:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// compressWriter buffers a response until it has minSize bytes, then
+// compresses it. Responses that stay smaller are written as is on Close.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+	buf      []byte
+	encoder  io.WriteCloser
+	// plain is set once the response is written as is
+	plain bool
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	switch {
+	case w.encoder != nil:
+		return w.encoder.Write(data)
+	case w.plain:
+		return w.ResponseWriter.Write(data)
+	}
+	if w.ResponseWriter.Written() || w.Header().Get("Content-Encoding") != "" {
+		// the header is out or the handler encoded the body itself
+		if err := w.writePlain(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) < w.minSize {
+		return len(data), nil
+	}
+	if err := w.startEncoder(); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) startEncoder() error {
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.encoder = newEncoder(w.encoding, w.ResponseWriter)
+	_, err := w.encoder.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *compressWriter) writePlain() error {
+	w.plain = true
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Flush sends what is buffered, a response flushed before minSize bytes
+// isn't compressed.
+func (w *compressWriter) Flush() {
+	if w.encoder == nil && !w.plain {
+		if err := w.writePlain(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Close() error {
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return w.writePlain()
+}
+
+// decompressMiddleware decodes request bodies sent with Content-Encoding.
+func decompressMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			body io.ReadCloser
+			err  error
+		)
+		switch encoding := c.GetHeader("Content-Encoding"); encoding {
+		case "", "identity":
+			return
+		case "gzip":
+			body, err = gzip.NewReader(c.Request.Body)
+		case "br":
+			body = io.NopCloser(brotli.NewReader(c.Request.Body))
+		default:
+			err = fmt.Errorf("unsupported content encoding %q, expected gzip or br", encoding)
+			abort(c, http.StatusUnsupportedMediaType, errorResponse(err))
+			return
+		}
+		if err != nil {
+			abort(c, http.StatusBadRequest, errorResponse(fmt.Errorf("can't decompress body: %w", err)))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, body, MaxRequestBodySize)
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.ContentLength = -1
+	}
+}
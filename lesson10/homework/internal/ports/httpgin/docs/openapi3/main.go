@@ -0,0 +1,57 @@
+// Command openapi3 converts the Swagger 2.0 spec produced by swag into
+// an OpenAPI 3 spec.
+//
+// usage: openapi3 <swagger.json> <openapi.json>
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func convert(in []byte) ([]byte, error) {
+	var doc2 openapi2.T
+	if err := json.Unmarshal(in, &doc2); err != nil {
+		return nil, fmt.Errorf("can't parse swagger spec: %w", err)
+	}
+	doc3, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("can't convert swagger spec: %w", err)
+	}
+	// swag leaves the host out, and without it the converter drops the base path
+	if len(doc3.Servers) == 0 && doc2.BasePath != "" {
+		doc3.AddServer(&openapi3.Server{URL: doc2.BasePath})
+	}
+	if err = doc3.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	out, err := json.MarshalIndent(doc3, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatalf("usage: %s <swagger.json> <openapi.json>\n", os.Args[0])
+	}
+	in, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		log.Fatalf("can't read spec: %s\n", err.Error())
+	}
+	out, err := convert(in)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	if err = os.WriteFile(os.Args[2], out, 0o644); err != nil {
+		log.Fatalf("can't write spec: %s\n", err.Error())
+	}
+}
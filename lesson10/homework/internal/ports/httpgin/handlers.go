@@ -2,260 +2,654 @@ package httpgin
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"net/http"
 	"strconv"
+	"time"
 
+	"homework10/internal/ads"
 	"homework10/internal/app"
+	"homework10/internal/auth"
+	"homework10/internal/policy"
 )
 
 // Метод для создания пользователя (user)
+//
+//	@Summary	Create a user
+//	@Tags		users
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Param		request	body		createUserRequest	true	"User to create"
+//	@Success	200		{object}	response{data=userResponse}
+//	@Failure	400		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/users [post]
 func createUser(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var reqBody createUserRequest
 		err := c.BindJSON(&reqBody)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
 		user, err := a.CreateUser(reqBody.Nickname, reqBody.Email)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, userSuccessResponse(user))
+		respond(c, http.StatusOK, userSuccessResponse(user))
 	}
 }
 
 // Метод для получения пользователя (user)
+//
+//	@Summary	Get a user
+//	@Tags		users
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Param		user_id	path		int	true	"User ID"
+//	@Success	200		{object}	response{data=userResponse}
+//	@Failure	400		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/users/{user_id} [get]
 func getUser(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
 		user, err := a.GetUser(userID)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, userSuccessResponse(user))
+		respond(c, http.StatusOK, userSuccessResponse(user))
 	}
 }
 
 // Метод для обновления пользователя (user)
+//
+//	@Summary	Update a user
+//	@Tags		users
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		user_id	path		int					true	"User ID"
+//	@Param		request	body		updateUserRequest	true	"New nickname and email"
+//	@Success	200		{object}	response{data=userResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/users/{user_id} [put]
 func updateUser(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var reqBody updateUserRequest
 		if err := c.BindJSON(&reqBody); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
 		userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		user, err := a.UpdateUser(userID, reqBody.Nickname, reqBody.Email)
+		user, err := a.UpdateUser(userID, auth.FromContext(c.Request.Context()), reqBody.Nickname, reqBody.Email)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, userSuccessResponse(user))
+		respond(c, http.StatusOK, userSuccessResponse(user))
+	}
+}
+
+// Метод для частичного обновления пользователя (user)
+//
+//	@Summary	Update some fields of a user
+//	@Tags		users
+//	@Accept		application/merge-patch+json,json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		user_id	path		int					true	"User ID"
+//	@Param		request	body		patchUserRequest	true	"JSON Merge Patch, missing fields are kept"
+//	@Success	200		{object}	response{data=userResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	415		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/users/{user_id} [patch]
+func patchUser(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reqBody patchUserRequest
+		if !bindMergePatch(c, &reqBody) {
+			return
+		}
+
+		userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+		if err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		var patch app.UserPatch
+		if patch.Nickname, err = reqBody.Nickname.get("nickname"); err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if patch.Email, err = reqBody.Email.get("email"); err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		user, err := a.PatchUser(userID, auth.FromContext(c.Request.Context()), patch)
+		if err != nil {
+			respond(c, getStatusByError(err), errorResponse(err))
+			return
+		}
+
+		respond(c, http.StatusOK, userSuccessResponse(user))
 	}
 }
 
 // Метод для поиска пользователя (user)
+//
+//	@Summary	Find a user by nickname
+//	@Tags		users
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Param		search_query	query		string	true	"Nickname"
+//	@Success	200				{object}	response{data=userResponse}
+//	@Failure	400				{object}	response
+//	@Failure	500				{object}	response
+//	@Router		/users/find [get]
 func findUser(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		searchQuery := c.Query("search_query")
 		if searchQuery == "" {
-			c.JSON(http.StatusBadRequest, errorResponse(errors.New("search_query parameter is empty")))
+			respond(c, http.StatusBadRequest, errorResponse(errors.New("search_query parameter is empty")))
 			return
 		}
 
 		user, err := a.FindUser(searchQuery)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, userSuccessResponse(user))
+		respond(c, http.StatusOK, userSuccessResponse(user))
 	}
 }
 
 // Метод для удаления пользователя (user)
+//
+//	@Summary	Delete a user
+//	@Tags		users
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		request	body		deleteUserRequest	true	"User to delete"
+//	@Success	200		{object}	response{data=userResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/users/delete [delete]
 func deleteUser(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var reqBody deleteUserRequest
 		if err := c.BindJSON(&reqBody); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		user, err := a.DeleteUser(reqBody.UserID)
+		user, err := a.DeleteUser(reqBody.UserID, auth.FromContext(c.Request.Context()))
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, userSuccessResponse(user))
+		respond(c, http.StatusOK, userSuccessResponse(user))
 	}
 }
 
 // Метод получения объявлений (ads)
+//
+//	@Summary	List ads
+//	@Tags		ads
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Param		filters				query		int		true	"Bitmask of filters, 0 lists published ads only"
+//	@Param		created_from		query		string	false	"Created at or after, RFC 3339"		format(date-time)
+//	@Param		created_to			query		string	false	"Created before, RFC 3339"			format(date-time)
+//	@Param		updated_from		query		string	false	"Updated at or after, RFC 3339"		format(date-time)
+//	@Param		updated_to			query		string	false	"Updated before, RFC 3339"			format(date-time)
+//	@Param		Accept-Timezone		header		string	false	"IANA time zone of times in the response, UTC by default"
+//	@Success	200					{object}	adsResponse
+//	@Failure	400					{object}	response
+//	@Router		/ads [get]
 func listAds(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// С фронта приходит битовая маска фильтров
 		filters := c.Query("filters")
 		bitmask, err := strconv.ParseInt(filters, 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, adsSuccessResponse(a.ListAds(bitmask)))
+		query := app.AdsQuery{Bitmask: bitmask}
+		bounds := map[string]*time.Time{
+			"created_from": &query.CreatedFrom,
+			"created_to":   &query.CreatedTo,
+			"updated_from": &query.UpdatedFrom,
+			"updated_to":   &query.UpdatedTo,
+		}
+		for name, bound := range bounds {
+			value, ok := c.GetQuery(name)
+			if !ok {
+				continue
+			}
+			if *bound, err = time.Parse(time.RFC3339, value); err != nil {
+				respond(c, http.StatusBadRequest, errorResponse(fmt.Errorf("can't parse %s: %w", name, err)))
+				return
+			}
+		}
+
+		respond(c, http.StatusOK, adsSuccessResponse(a.SearchAds(query), location(c)))
 	}
 }
 
 // Метод для создания объявления (ad)
+//
+//	@Summary	Create an ad
+//	@Tags		ads
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		request	body		createAdRequest	true	"Ad to create"
+//	@Success	200		{object}	response{data=adResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/ads [post]
 func createAd(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var reqBody createAdRequest
 		err := c.BindJSON(&reqBody)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		ad, err := a.CreateAd(reqBody.Title, reqBody.Text, reqBody.UserID)
+		ad, err := a.CreateAd(reqBody.Title, reqBody.Text, auth.FromContext(c.Request.Context()))
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, adSuccessResponse(ad))
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
 	}
 }
 
 // Метод для получения объявления (ad)
+//
+//	@Summary	Get an ad
+//	@Tags		ads
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Param		ad_id	path		int	true	"Ad ID"
+//	@Success	200		{object}	response{data=adResponse}
+//	@Failure	400		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/ads/{ad_id} [get]
 func getAd(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		adID, err := strconv.ParseInt(c.Param("ad_id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
 		ad, err := a.GetAd(adID)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, adSuccessResponse(ad))
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
 	}
 }
 
 // Метод для обновления текста(Text) или заголовка(Title) объявления
+//
+//	@Summary	Update title and text of an ad
+//	@Tags		ads
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		ad_id	path		int				true	"Ad ID"
+//	@Param		request	body		updateAdRequest	true	"New title and text"
+//	@Success	200		{object}	response{data=adResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/ads/{ad_id} [put]
 func updateAd(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var reqBody updateAdRequest
 		if err := c.BindJSON(&reqBody); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		adID, err := strconv.ParseInt(c.Param("ad_id"), 10, 64)
+		if err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		ad, err := a.UpdateAd(adID, auth.FromContext(c.Request.Context()), reqBody.Title, reqBody.Text)
+		if err != nil {
+			respond(c, getStatusByError(err), errorResponse(err))
+			return
+		}
+
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
+	}
+}
+
+// Метод для частичного обновления объявления (ad)
+//
+//	@Summary	Update title or text of an ad
+//	@Tags		ads
+//	@Accept		application/merge-patch+json,json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		ad_id	path		int				true	"Ad ID"
+//	@Param		request	body		patchAdRequest	true	"JSON Merge Patch, missing fields are kept and not validated"
+//	@Success	200		{object}	response{data=adResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	415		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/ads/{ad_id} [patch]
+func patchAd(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reqBody patchAdRequest
+		if !bindMergePatch(c, &reqBody) {
 			return
 		}
 
 		adID, err := strconv.ParseInt(c.Param("ad_id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		var patch app.AdPatch
+		if patch.Title, err = reqBody.Title.get("title"); err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if patch.Text, err = reqBody.Text.get("text"); err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		ad, err := a.UpdateAd(adID, reqBody.UserID, reqBody.Title, reqBody.Text)
+		ad, err := a.PatchAd(adID, auth.FromContext(c.Request.Context()), patch)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, adSuccessResponse(ad))
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
 	}
 }
 
 // Метод для изменения статуса объявления (опубликовано - Published = true или снято с публикации Published = false)
+//
+//	@Summary	Publish or unpublish an ad
+//	@Tags		ads
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		ad_id	path		int						true	"Ad ID"
+//	@Param		request	body		changeAdStatusRequest	true	"New status"
+//	@Success	200		{object}	response{data=adResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/ads/{ad_id}/status [put]
 func changeAdStatus(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var reqBody changeAdStatusRequest
 		if err := c.BindJSON(&reqBody); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
 		adID, err := strconv.ParseInt(c.Param("ad_id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		ad, err := a.ChangeAdStatus(adID, reqBody.UserID, reqBody.Published)
+		ad, err := a.ChangeAdStatus(adID, auth.FromContext(c.Request.Context()), reqBody.Published)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, adSuccessResponse(ad))
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
 	}
 }
 
 // Метод для поиска объявления (ad)
+//
+//	@Summary	Find an ad by title
+//	@Tags		ads
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Param		search_query	query		string	true	"Title prefix"
+//	@Success	200				{object}	response{data=adResponse}
+//	@Failure	400				{object}	response
+//	@Failure	500				{object}	response
+//	@Router		/ads/find [get]
 func findAd(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		searchQuery := c.Query("search_query")
 		if searchQuery == "" {
-			c.JSON(http.StatusBadRequest, errorResponse(errors.New("search_query parameter is empty")))
+			respond(c, http.StatusBadRequest, errorResponse(errors.New("search_query parameter is empty")))
 			return
 		}
 
 		ad, err := a.FindAd(searchQuery)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, getStatusByError(err), errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, adSuccessResponse(ad))
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
 	}
 }
 
 // Метод для удаления объявления (ad)
+//
+//	@Summary	Delete an ad
+//	@Tags		ads
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		request	body		deleteAdRequest	true	"Ad to delete"
+//	@Success	200		{object}	response{data=adResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/ads/delete [delete]
 func deleteAd(a app.App) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var reqBody deleteAdRequest
 		if err := c.BindJSON(&reqBody); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		ad, err := a.DeleteAd(reqBody.AdID, auth.FromContext(c.Request.Context()))
+		if err != nil {
+			respond(c, getStatusByError(err), errorResponse(err))
+			return
+		}
+
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
+	}
+}
+
+// Метод для блокировки пользователя (user) администратором
+//
+//	@Summary	Block or unblock a user
+//	@Tags		admin
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		user_id	path		int					true	"User ID"
+//	@Param		request	body		blockUserRequest	true	"New state"
+//	@Success	200		{object}	response{data=userResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/admin/users/{user_id}/block [put]
+func blockUser(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reqBody blockUserRequest
+		if err := c.BindJSON(&reqBody); err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+		if err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		user, err := a.BlockUser(userID, auth.FromContext(c.Request.Context()), reqBody.Blocked)
+		if err != nil {
+			respond(c, getStatusByError(err), errorResponse(err))
+			return
+		}
+
+		respond(c, http.StatusOK, userSuccessResponse(user))
+	}
+}
+
+// Метод для изменения роли пользователя (user) администратором
+//
+//	@Summary	Set the role of a user
+//	@Tags		admin
+//	@Accept		json
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		user_id	path		int					true	"User ID"
+//	@Param		request	body		setUserRoleRequest	true	"New role"
+//	@Success	200		{object}	response{data=userResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/admin/users/{user_id}/role [put]
+func setUserRole(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reqBody setUserRoleRequest
+		if err := c.BindJSON(&reqBody); err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+		if err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		ad, err := a.DeleteAd(reqBody.AdID, reqBody.UserID)
+		role, err := ads.ParseRole(reqBody.Role)
 		if err != nil {
-			c.JSON(getStatusByError(err), errorResponse(err))
+			respond(c, http.StatusBadRequest, errorResponse(err))
 			return
 		}
 
-		c.JSON(http.StatusOK, adSuccessResponse(ad))
+		user, err := a.SetUserRole(userID, auth.FromContext(c.Request.Context()), role)
+		if err != nil {
+			respond(c, getStatusByError(err), errorResponse(err))
+			return
+		}
+
+		respond(c, http.StatusOK, userSuccessResponse(user))
+	}
+}
+
+// Метод для снятия объявления (ad) с публикации модератором
+//
+//	@Summary	Unpublish an ad of any author
+//	@Tags		admin
+//	@Produce	json,application/msgpack,application/x-protobuf
+//	@Security	BearerAuth
+//	@Param		ad_id	path		int					true	"Ad ID"
+//	@Success	200		{object}	response{data=adResponse}
+//	@Failure	400		{object}	response
+//	@Failure	401		{object}	response
+//	@Failure	403		{object}	response
+//	@Failure	500		{object}	response
+//	@Router		/admin/ads/{ad_id}/unpublish [put]
+func unpublishAd(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adID, err := strconv.ParseInt(c.Param("ad_id"), 10, 64)
+		if err != nil {
+			respond(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+
+		ad, err := a.UnpublishAd(adID, auth.FromContext(c.Request.Context()))
+		if err != nil {
+			respond(c, getStatusByError(err), errorResponse(err))
+			return
+		}
+
+		respond(c, http.StatusOK, adSuccessResponse(ad, location(c)))
+	}
+}
+
+// bindMergePatch decodes a merge patch body into obj and writes the error
+// response if it can't.
+func bindMergePatch(c *gin.Context, obj any) bool {
+	if contentType := c.ContentType(); contentType != MergePatchContentType && contentType != binding.MIMEJSON {
+		err := fmt.Errorf("unsupported content type %q, expected %s", contentType, MergePatchContentType)
+		respond(c, http.StatusUnsupportedMediaType, errorResponse(err))
+		return false
+	}
+	if err := c.ShouldBindWith(obj, binding.JSON); err != nil {
+		respond(c, http.StatusBadRequest, errorResponse(err))
+		return false
 	}
+	return true
 }
 
 func getStatusByError(err error) int {
 	switch {
-	case errors.Is(err, app.ErrNotUsersAd):
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, app.ErrNotUsersAd), errors.Is(err, policy.ErrForbidden), errors.Is(err, policy.ErrBlocked):
 		return http.StatusForbidden
 	case errors.Is(err, app.ErrValidation):
 		return http.StatusBadRequest
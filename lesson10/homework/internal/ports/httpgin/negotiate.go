@@ -0,0 +1,160 @@
+package httpgin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// Media types of responses besides JSON. Protobuf responses are the messages
+// of service.proto, errors are google.rpc.Status.
+const (
+	MIMEMsgPack  = binding.MIMEMSGPACK2
+	MIMEProtobuf = binding.MIMEPROTOBUF
+)
+
+// offeredTypes are the media types of responses, the first one is served to
+// requests without Accept.
+var offeredTypes = []string{binding.MIMEJSON, MIMEMsgPack, binding.MIMEMSGPACK, MIMEProtobuf}
+
+const formatKey = "format"
+
+// negotiateMiddleware picks the media type of the response from the Accept
+// header for respond.
+func negotiateMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+		format := negotiate(c.GetHeader("Accept"), offeredTypes, matchMediaType)
+		if format == "" {
+			err := fmt.Errorf("none of %s is accepted", strings.Join(offeredTypes, ", "))
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, errorResponse(err))
+			return
+		}
+		c.Set(formatKey, format)
+	}
+}
+
+// respond renders obj in the media type negotiateMiddleware picked.
+func respond(c *gin.Context, code int, obj any) {
+	switch c.GetString(formatKey) {
+	case MIMEMsgPack, binding.MIMEMSGPACK:
+		c.Render(code, render.MsgPack{Data: obj})
+	case MIMEProtobuf:
+		c.ProtoBuf(code, protoMessage(code, obj))
+	default:
+		c.JSON(code, obj)
+	}
+}
+
+// abort is respond for middlewares, handlers after them aren't called.
+func abort(c *gin.Context, code int, obj any) {
+	c.Abort()
+	respond(c, code, obj)
+}
+
+// protoPresenter is a response with a message in service.proto.
+type protoPresenter interface {
+	toProto() proto.Message
+}
+
+func protoMessage(code int, obj any) proto.Message {
+	if resp, ok := obj.(response); ok {
+		if resp.Error != "" {
+			return &status.Status{Code: int32(grpcCode(code)), Message: resp.Error}
+		}
+		obj = resp.Data
+	}
+	return obj.(protoPresenter).toProto()
+}
+
+func grpcCode(code int) codes.Code {
+	switch code {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	default:
+		return codes.Internal
+	}
+}
+
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQuality parses a header of comma separated values with optional
+// q parameters, like Accept or Accept-Encoding.
+func parseQuality(header string) []qualityValue {
+	result := make([]qualityValue, 0)
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := qualityValue{value: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		if value.value == "" {
+			continue
+		}
+		for _, param := range params[1:] {
+			name, q, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(name) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			value.q = parsed
+		}
+		result = append(result, value)
+	}
+	return result
+}
+
+// negotiate picks the offer header prefers, the most specific value matching
+// an offer sets its quality. Ties go to the earlier offer, "" means header
+// accepts none of them.
+func negotiate(header string, offered []string, match func(value string, offer string) int) string {
+	if strings.TrimSpace(header) == "" {
+		return offered[0]
+	}
+	accepted := parseQuality(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		q, specificity := 0.0, -1
+		for _, value := range accepted {
+			if s := match(value.value, offer); s > specificity {
+				q, specificity = value.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// matchMediaType returns the specificity of a media range matching offer,
+// -1 if it doesn't.
+func matchMediaType(value string, offer string) int {
+	switch {
+	case value == "*/*":
+		return 0
+	case strings.HasSuffix(value, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(value, "*")):
+		return 1
+	case value == offer:
+		return 2
+	default:
+		return -1
+	}
+}
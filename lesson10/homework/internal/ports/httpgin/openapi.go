@@ -0,0 +1,11 @@
+package httpgin
+
+import _ "embed"
+
+//go:generate swag init -g server.go -o docs --outputTypes json
+//go:generate go run ./docs/openapi3 docs/swagger.json docs/openapi.json
+
+// OpenAPISpec describes the REST API served under /api/v1.
+//
+//go:embed docs/openapi.json
+var OpenAPISpec []byte
@@ -1,9 +1,21 @@
 package httpgin
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
 	"homework10/internal/ads"
+	grpcPort "homework10/internal/ports/grpc"
 )
 
+// MergePatchContentType is the media type of JSON Merge Patch (RFC 7396)
+// bodies of PATCH routes, plain JSON is accepted too.
+const MergePatchContentType = "application/merge-patch+json"
+
 type response struct {
 	Data  any    `json:"data"`
 	Error string `json:"error"`
@@ -13,6 +25,8 @@ type userResponse struct {
 	ID       int64  `json:"id"`
 	Nickname string `json:"nickname"`
 	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Blocked  bool   `json:"blocked"`
 }
 
 type createUserRequest struct {
@@ -25,22 +39,67 @@ type updateUserRequest struct {
 	Email    string `json:"email"`
 }
 
+// patchField is a member of a merge patch, Set tells a missing member from
+// a member with the zero value.
+type patchField[T any] struct {
+	Value T
+	Set   bool
+	Null  bool
+}
+
+func (f *patchField[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if string(data) == "null" {
+		f.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &f.Value)
+}
+
+// get returns nil for a missing member. Members here can't be removed, so
+// null is an error.
+func (f patchField[T]) get(name string) (*T, error) {
+	if !f.Set {
+		return nil, nil
+	}
+	if f.Null {
+		return nil, fmt.Errorf("%s can't be null", name)
+	}
+	return &f.Value, nil
+}
+
+type patchUserRequest struct {
+	Nickname patchField[string] `json:"nickname" swaggertype:"string"`
+	Email    patchField[string] `json:"email" swaggertype:"string"`
+}
+
 type deleteUserRequest struct {
 	UserID int64 `json:"user_id"`
 }
 
+type blockUserRequest struct {
+	Blocked bool `json:"blocked"`
+}
+
+type setUserRoleRequest struct {
+	Role string `json:"role" enums:"user,moderator,admin"`
+}
+
 type createAdRequest struct {
-	Title  string `json:"title"`
-	Text   string `json:"text"`
-	UserID int64  `json:"user_id"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
 }
 
+// adResponse renders times in RFC 3339 in the time zone of the request,
+// see timezoneMiddleware.
 type adResponse struct {
-	ID        int64  `json:"id"`
-	Title     string `json:"title"`
-	Text      string `json:"text"`
-	AuthorID  int64  `json:"author_id"`
-	Published bool   `json:"published"`
+	ID             int64  `json:"id"`
+	Title          string `json:"title"`
+	Text           string `json:"text"`
+	AuthorID       int64  `json:"author_id"`
+	Published      bool   `json:"published"`
+	CreationTime   string `json:"creation_time" format:"date-time"`
+	LastUpdateTime string `json:"last_update_time" format:"date-time"`
 }
 
 type adsResponse struct {
@@ -48,19 +107,21 @@ type adsResponse struct {
 }
 
 type changeAdStatusRequest struct {
-	Published bool  `json:"published"`
-	UserID    int64 `json:"user_id"`
+	Published bool `json:"published"`
 }
 
 type deleteAdRequest struct {
-	AdID   int64 `json:"ad_id"`
-	UserID int64 `json:"user_id"`
+	AdID int64 `json:"ad_id"`
+}
+
+type patchAdRequest struct {
+	Title patchField[string] `json:"title" swaggertype:"string"`
+	Text  patchField[string] `json:"text" swaggertype:"string"`
 }
 
 type updateAdRequest struct {
-	Title  string `json:"title"`
-	Text   string `json:"text"`
-	UserID int64  `json:"user_id"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
 }
 
 func userSuccessResponse(user *ads.User) response {
@@ -69,22 +130,24 @@ func userSuccessResponse(user *ads.User) response {
 			ID:       user.ID,
 			Nickname: user.Nickname,
 			Email:    user.Email,
+			Role:     user.Role.String(),
+			Blocked:  user.Blocked,
 		},
 	}
 }
 
-func adSuccessResponse(ad *ads.Ad) response {
+func adSuccessResponse(ad *ads.Ad, loc *time.Location) response {
 	return response{
-		Data: adToAdResponse(*ad),
+		Data: adToAdResponse(*ad, loc),
 	}
 }
 
-func adsSuccessResponse(ads []*ads.Ad) adsResponse {
+func adsSuccessResponse(ads []*ads.Ad, loc *time.Location) adsResponse {
 	result := adsResponse{
 		Data: make([]adResponse, len(ads)),
 	}
 	for i, ad := range ads {
-		result.Data[i] = adToAdResponse(*ad)
+		result.Data[i] = adToAdResponse(*ad, loc)
 	}
 	return result
 }
@@ -95,12 +158,57 @@ func errorResponse(err error) response {
 	}
 }
 
-func adToAdResponse(ad ads.Ad) adResponse {
+func adToAdResponse(ad ads.Ad, loc *time.Location) adResponse {
 	return adResponse{
-		ID:        ad.ID,
-		Title:     ad.Title,
-		Text:      ad.Text,
-		AuthorID:  ad.AuthorID,
-		Published: ad.Published,
+		ID:             ad.ID,
+		Title:          ad.Title,
+		Text:           ad.Text,
+		AuthorID:       ad.AuthorID,
+		Published:      ad.Published,
+		CreationTime:   ad.CreationTime.In(loc).Format(time.RFC3339Nano),
+		LastUpdateTime: ad.LastUpdateTime.In(loc).Format(time.RFC3339Nano),
+	}
+}
+
+func (r userResponse) toProto() proto.Message {
+	return &grpcPort.UserResponse{
+		Id:       r.ID,
+		Nickname: r.Nickname,
+		Email:    r.Email,
+		Role:     r.Role,
+		Blocked:  r.Blocked,
+	}
+}
+
+func (r adResponse) toProto() proto.Message {
+	return r.adResponse()
+}
+
+func (r adResponse) adResponse() *grpcPort.AdResponse {
+	return &grpcPort.AdResponse{
+		Id:             r.ID,
+		Title:          r.Title,
+		Text:           r.Text,
+		AuthorId:       r.AuthorID,
+		Published:      r.Published,
+		CreationTime:   timestamp(r.CreationTime),
+		LastUpdateTime: timestamp(r.LastUpdateTime),
+	}
+}
+
+func (r adsResponse) toProto() proto.Message {
+	result := &grpcPort.ListAdResponse{List: make([]*grpcPort.AdResponse, len(r.Data))}
+	for i, ad := range r.Data {
+		result.List[i] = ad.adResponse()
+	}
+	return result
+}
+
+// timestamp parses times formatted by adToAdResponse back.
+func timestamp(value string) *timestamppb.Timestamp {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil
 	}
+	return timestamppb.New(t)
 }
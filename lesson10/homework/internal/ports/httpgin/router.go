@@ -1,21 +1,150 @@
 package httpgin
 
 import (
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	httpSwagger "github.com/swaggo/http-swagger"
+
 	"homework10/internal/app"
+	"homework10/internal/auth"
+	"homework10/internal/lifecycle"
+	"homework10/internal/tenant"
 )
 
-func AppRouter(r gin.IRouter, a app.App) {
-	r.POST("/users", createUser(a))                // Метод для создания пользователя (user)
-	r.GET("/users/:user_id", getUser(a))           // Метод для получения пользователя (user)
-	r.PUT("/users/:user_id", updateUser(a))        // Метод для обновления пользователя (user)
-	r.GET("/users/find", findUser(a))              // Метод для поиска пользователя (user)
-	r.DELETE("/users/delete", deleteUser(a))       // Метод для удаления пользователя (user)
-	r.GET("/ads", listAds(a))                      // Метод для получения объявлений (ads)
-	r.POST("/ads", createAd(a))                    // Метод для создания объявления (ad)
-	r.GET("/ads/:ad_id", getAd(a))                 // Метод для получения объявления (ad)
-	r.PUT("/ads/:ad_id", updateAd(a))              // Метод для обновления текста(Text) или заголовка(Title) объявления
-	r.PUT("/ads/:ad_id/status", changeAdStatus(a)) // Метод для изменения статуса объявления (опубликовано - Published = true или снято с публикации Published = false)
-	r.GET("/ads/find", findAd(a))                  // Метод для поиска объявления (ad)
-	r.DELETE("/ads/delete", deleteAd(a))           // Метод для удаления объявления (ad)
+// AppRouter authenticates users by tokens, requests are anonymous if tokens
+// is nil.
+func AppRouter(r gin.IRouter, tenants *tenant.Registry, tokens *auth.Tokens) {
+	middlewares := []gin.HandlerFunc{negotiateMiddleware(), decompressMiddleware(), tenantMiddleware(tenants), timezoneMiddleware()}
+	if tokens != nil {
+		middlewares = append(middlewares, authMiddleware(tokens))
+	}
+	r = r.Group("", middlewares...)
+	r.POST("/users", perTenant(tenants, createUser))                // Метод для создания пользователя (user)
+	r.GET("/users/:user_id", perTenant(tenants, getUser))           // Метод для получения пользователя (user)
+	r.PUT("/users/:user_id", perTenant(tenants, updateUser))        // Метод для обновления пользователя (user)
+	r.PATCH("/users/:user_id", perTenant(tenants, patchUser))       // Метод для частичного обновления пользователя (user)
+	r.GET("/users/find", perTenant(tenants, findUser))              // Метод для поиска пользователя (user)
+	r.DELETE("/users/delete", perTenant(tenants, deleteUser))       // Метод для удаления пользователя (user)
+	r.GET("/ads", perTenant(tenants, listAds))                      // Метод для получения объявлений (ads)
+	r.POST("/ads", perTenant(tenants, createAd))                    // Метод для создания объявления (ad)
+	r.GET("/ads/:ad_id", perTenant(tenants, getAd))                 // Метод для получения объявления (ad)
+	r.PUT("/ads/:ad_id", perTenant(tenants, updateAd))              // Метод для обновления текста(Text) или заголовка(Title) объявления
+	r.PATCH("/ads/:ad_id", perTenant(tenants, patchAd))             // Метод для частичного обновления объявления (ad)
+	r.PUT("/ads/:ad_id/status", perTenant(tenants, changeAdStatus)) // Метод для изменения статуса объявления (опубликовано - Published = true или снято с публикации Published = false)
+	r.GET("/ads/find", perTenant(tenants, findAd))                  // Метод для поиска объявления (ad)
+	r.DELETE("/ads/delete", perTenant(tenants, deleteAd))           // Метод для удаления объявления (ad)
+
+	admin := r.Group("/admin")
+	admin.PUT("/users/:user_id/block", perTenant(tenants, blockUser))   // Метод для блокировки пользователя (user)
+	admin.PUT("/users/:user_id/role", perTenant(tenants, setUserRole))  // Метод для изменения роли пользователя (user)
+	admin.PUT("/ads/:ad_id/unpublish", perTenant(tenants, unpublishAd)) // Метод для снятия объявления (ad) с публикации
+}
+
+// DocsRouter serves the OpenAPI spec and Swagger UI on top of it. The routes
+// are expected to be mounted under /api/v1.
+func DocsRouter(r gin.IRouter) {
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", OpenAPISpec)
+	})
+	r.GET("/docs/*any", gin.WrapH(httpSwagger.Handler(httpSwagger.URL(OpenAPIPath))))
+}
+
+// tenantMiddleware resolves the tenant of a request from the tenant header
+// or the host and puts it into the request context.
+func tenantMiddleware(tenants *tenant.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := tenants.Resolve(c.GetHeader(tenant.Header), c.Request.Host)
+		if err != nil {
+			abort(c, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), id))
+	}
+}
+
+// authMiddleware puts the user of the bearer token of a request into the
+// request context, requests without a token are anonymous. Tokens are
+// issued per tenant, so it runs after tenantMiddleware.
+func authMiddleware(tokens *auth.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, _ := tenant.IDFromContext(c.Request.Context())
+		subject, err := tokens.Authenticate(id, c.GetHeader("Authorization"))
+		if err != nil {
+			c.Header("WWW-Authenticate", "Bearer")
+			abort(c, http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithSubject(c.Request.Context(), subject))
+	}
+}
+
+// TimezoneHeader names an IANA time zone, e.g. Asia/Almaty, to render the
+// times of a response in.
+const TimezoneHeader = "Accept-Timezone"
+
+const locationKey = "location"
+
+// timezoneMiddleware loads the time zone of TimezoneHeader for location.
+func timezoneMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", TimezoneHeader)
+		name := c.GetHeader(TimezoneHeader)
+		if name == "" {
+			return
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			abort(c, http.StatusBadRequest, errorResponse(fmt.Errorf("can't load time zone: %w", err)))
+			return
+		}
+		c.Set(locationKey, loc)
+	}
+}
+
+// location is the time zone the request asked for, UTC by default.
+func location(c *gin.Context) *time.Location {
+	if loc, ok := c.Value(locationKey).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// lifecycleMiddleware counts requests in-flight until they are handled.
+func lifecycleMiddleware(m *lifecycle.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		end, err := m.Begin()
+		if err != nil {
+			c.Header("Connection", "close")
+			abort(c, http.StatusServiceUnavailable, errorResponse(err))
+			return
+		}
+		defer end()
+		c.Next()
+	}
+}
+
+func readyHandler(m *lifecycle.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := http.StatusOK
+		if m.State() != lifecycle.StateReady {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, response{Data: m.Stats()})
+	}
+}
+
+// perTenant builds handler for the App of every tenant and calls the one of
+// the tenant tenantMiddleware resolved.
+func perTenant(tenants *tenant.Registry, handler func(app.App) gin.HandlerFunc) gin.HandlerFunc {
+	handlers := make(map[string]gin.HandlerFunc)
+	tenants.Range(func(id string, a app.App) {
+		handlers[id] = handler(a)
+	})
+	return func(c *gin.Context) {
+		id, _ := tenant.IDFromContext(c.Request.Context())
+		handlers[id](c)
+	}
 }
@@ -2,21 +2,80 @@ package httpgin
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
 	"homework10/internal/app"
+	"homework10/internal/auth"
+	"homework10/internal/lifecycle"
+	"homework10/internal/tenant"
+)
+
+const (
+	OpenAPIPath = "/api/v1/openapi.json"
+	DocsPath    = "/api/v1/docs"
+	// ReadyPath answers 200 while the service is ready, 503 once it's
+	// shutting down. It's served with WithLifecycle only.
+	ReadyPath = "/readyz"
 )
 
 type Server struct {
-	a      app.App
-	server *http.Server
+	tenants         *tenant.Registry
+	server          *http.Server
+	compressMinSize int
+	lifecycle       *lifecycle.Manager
+	tokens          *auth.Tokens
+}
+
+type Option func(*Server)
+
+// WithCompressMinSize replaces DefaultCompressMinSize, a negative size turns
+// compression off.
+func WithCompressMinSize(size int) Option {
+	return func(s *Server) {
+		s.compressMinSize = size
+	}
+}
+
+// General API info for swag, see openapi.go.
+//
+//	@title			Ads API
+//	@version		1.0
+//	@description	Users and their ads.
+//	@BasePath		/api/v1
+//
+//	@securityDefinitions.apikey	BearerAuth
+//	@in							header
+//	@name						Authorization
+//	@description				Bearer followed by a token issued with adsctl token.
+func NewHTTPServer(port string, a app.App, opts ...Option) Server {
+	return NewTenantHTTPServer(port, tenant.Single(a), opts...)
 }
 
-func NewHTTPServer(port string, a app.App) Server {
+// WithLifecycle counts requests as in-flight ones of m and serves ReadyPath.
+func WithLifecycle(m *lifecycle.Manager) Option {
+	return func(s *Server) {
+		s.lifecycle = m
+	}
+}
+
+// WithTokens authenticates users by tokens, without it requests are
+// anonymous and can't perform operations the policy checks.
+func WithTokens(tokens *auth.Tokens) Option {
+	return func(s *Server) {
+		s.tokens = tokens
+	}
+}
+
+// NewTenantHTTPServer serves every tenant of tenants with its own App.
+func NewTenantHTTPServer(port string, tenants *tenant.Registry, opts ...Option) Server {
 	gin.SetMode(gin.ReleaseMode)
-	s := Server{a: a}
+	s := Server{tenants: tenants, compressMinSize: DefaultCompressMinSize}
+	for _, opt := range opts {
+		opt(&s)
+	}
 	s.server = &http.Server{
 		Addr:    port,
 		Handler: s.Handler(),
@@ -28,6 +87,12 @@ func (s *Server) Listen() error {
 	return s.server.ListenAndServe()
 }
 
+// ListenTLS serves HTTPS with certificates from config.
+func (s *Server) ListenTLS(config *tls.Config) error {
+	s.server.TLSConfig = config
+	return s.server.ListenAndServeTLS("", "")
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
@@ -37,6 +102,14 @@ func (s *Server) Handler() http.Handler {
 	api := a.Group("/api/v1")
 	api.Use(gin.Logger())
 	api.Use(gin.Recovery())
-	AppRouter(api, s.a)
+	if s.lifecycle != nil {
+		a.GET(ReadyPath, readyHandler(s.lifecycle))
+		api.Use(lifecycleMiddleware(s.lifecycle))
+	}
+	if s.compressMinSize >= 0 {
+		api.Use(compressMiddleware(s.compressMinSize))
+	}
+	AppRouter(api, s.tenants, s.tokens)
+	DocsRouter(api)
 	return a
 }
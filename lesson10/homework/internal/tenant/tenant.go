@@ -0,0 +1,208 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"homework10/internal/app"
+)
+
+const (
+	// Header names the tenant of an HTTP request.
+	Header = "X-Tenant-ID"
+	// MetadataKey names the tenant of a GRPC call.
+	MetadataKey = "x-tenant-id"
+)
+
+var (
+	ErrNoTenant      = errors.New("tenant is not specified")
+	ErrUnknownTenant = errors.New("unknown tenant")
+	ErrHostMismatch  = errors.New("tenant doesn't match the host")
+)
+
+type ctxKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func IDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok
+}
+
+type Tenant struct {
+	// Hosts are the hostnames requests to which belong to the tenant.
+	Hosts []string `yaml:"hosts"`
+	// Limits override app.DefaultLimits, rules left empty are the default.
+	Limits app.Limits `yaml:"limits"`
+	// Admins are IDs of users that are admins of the tenant whatever their
+	// role is.
+	Admins []int64 `yaml:"admins"`
+}
+
+type Config struct {
+	// Default serves requests that name no tenant, they are rejected if
+	// it is empty.
+	Default string            `yaml:"default"`
+	Tenants map[string]Tenant `yaml:"tenants"`
+}
+
+// LoadConfig reads a YAML config and checks it.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("can't read tenants config: %w", err)
+	}
+	var config Config
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("can't parse tenants config: %w", err)
+	}
+	config = config.withDefaults()
+	return config, config.Validate()
+}
+
+func (c Config) withDefaults() Config {
+	tenants := make(map[string]Tenant, len(c.Tenants))
+	for id, t := range c.Tenants {
+		if t.Limits.Title == "" {
+			t.Limits.Title = app.DefaultLimits.Title
+		}
+		if t.Limits.Text == "" {
+			t.Limits.Text = app.DefaultLimits.Text
+		}
+		tenants[id] = t
+	}
+	c.Tenants = tenants
+	return c
+}
+
+func (c Config) Validate() error {
+	if len(c.Tenants) == 0 {
+		return errors.New("no tenants")
+	}
+	if _, ok := c.Tenants[c.Default]; c.Default != "" && !ok {
+		return fmt.Errorf("default: %w %q", ErrUnknownTenant, c.Default)
+	}
+	hosts := make(map[string]string)
+	for id, t := range c.Tenants {
+		if id == "" {
+			return errors.New("empty tenant ID")
+		}
+		if err := t.Limits.Validate(); err != nil {
+			return fmt.Errorf("tenant %q: %w", id, err)
+		}
+		for _, host := range t.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok {
+				return fmt.Errorf("host %q belongs to tenants %q and %q", host, other, id)
+			}
+			hosts[host] = id
+		}
+	}
+	return nil
+}
+
+// Registry keeps an App for every tenant, each on top of its own
+// repositories, so a tenant can't reach data of another one whatever it
+// queries.
+type Registry struct {
+	apps  map[string]app.App
+	hosts map[string]string
+	def   string
+	// single registries serve everything with one App and ignore tenant IDs
+	single bool
+}
+
+// NewRegistry creates an App for every tenant of config with newApp, empty
+// limits are filled with the default ones first.
+func NewRegistry(config Config, newApp func(id string, t Tenant) (app.App, error)) (*Registry, error) {
+	config = config.withDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		apps:  make(map[string]app.App, len(config.Tenants)),
+		hosts: make(map[string]string),
+		def:   config.Default,
+	}
+	for id, t := range config.Tenants {
+		a, err := newApp(id, t)
+		if err != nil {
+			return nil, fmt.Errorf("can't create tenant %q: %w", id, err)
+		}
+		r.apps[id] = a
+		for _, host := range t.Hosts {
+			r.hosts[strings.ToLower(host)] = id
+		}
+	}
+	return r, nil
+}
+
+// Single serves every request with a, the way the service works without
+// tenants. Its only tenant has an empty ID.
+func Single(a app.App) *Registry {
+	return &Registry{apps: map[string]app.App{"": a}, single: true}
+}
+
+// Resolve picks the tenant named by id, then the one of host and then the
+// default one. A host that belongs to a tenant can't be used to reach
+// another one by naming it.
+func (r *Registry) Resolve(id string, host string) (string, error) {
+	if r.single {
+		return "", nil
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	hostID, hosted := r.hosts[strings.ToLower(host)]
+	if id != "" {
+		if _, ok := r.apps[id]; !ok {
+			return "", fmt.Errorf("%w %q", ErrUnknownTenant, id)
+		}
+		if hosted && id != hostID {
+			return "", fmt.Errorf("%w: %q belongs to %q", ErrHostMismatch, host, hostID)
+		}
+		return id, nil
+	}
+	if hosted {
+		return hostID, nil
+	}
+	if r.def != "" {
+		return r.def, nil
+	}
+	return "", ErrNoTenant
+}
+
+// App returns the App of the tenant in ctx, or of the default one if there
+// is none.
+func (r *Registry) App(ctx context.Context) (app.App, error) {
+	id, ok := IDFromContext(ctx)
+	if !ok {
+		var err error
+		if id, err = r.Resolve("", ""); err != nil {
+			return nil, err
+		}
+	}
+	if r.single {
+		id = ""
+	}
+	a, ok := r.apps[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTenant, id)
+	}
+	return a, nil
+}
+
+// Range calls fn for every tenant.
+func (r *Registry) Range(fn func(id string, a app.App)) {
+	for id, a := range r.apps {
+		fn(id, a)
+	}
+}
@@ -0,0 +1,120 @@
+package tenant_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/app"
+	"homework10/internal/tenant"
+)
+
+func newRegistry(t *testing.T, config tenant.Config) *tenant.Registry {
+	registry, err := tenant.NewRegistry(config, func(string, tenant.Tenant) (app.App, error) {
+		return app.NewApp(adrepo.New(), userrepo.New()), nil
+	})
+	assert.NoError(t, err)
+	return registry
+}
+
+func TestResolve(t *testing.T) {
+	tenants := map[string]tenant.Tenant{
+		"ru": {Hosts: []string{"ru.ads.test", "ads.test"}},
+		"kz": {Hosts: []string{"kz.ads.test"}},
+	}
+	withDefault := newRegistry(t, tenant.Config{Default: "ru", Tenants: tenants})
+	withoutDefault := newRegistry(t, tenant.Config{Tenants: tenants})
+	single := tenant.Single(app.NewApp(adrepo.New(), userrepo.New()))
+
+	tests := []struct {
+		Name     string
+		Registry *tenant.Registry
+		ID       string
+		Host     string
+		Expect   string
+		Err      error
+	}{
+		{Name: "id", Registry: withDefault, ID: "kz", Host: "localhost", Expect: "kz"},
+		{Name: "id of the host", Registry: withDefault, ID: "kz", Host: "kz.ads.test:443", Expect: "kz"},
+		{Name: "id of another host", Registry: withDefault, ID: "kz", Host: "ru.ads.test", Err: tenant.ErrHostMismatch},
+		{Name: "unknown id", Registry: withDefault, ID: "by", Err: tenant.ErrUnknownTenant},
+		{Name: "host", Registry: withDefault, Host: "kz.ads.test", Expect: "kz"},
+		{Name: "host with port", Registry: withDefault, Host: "Ads.Test:443", Expect: "ru"},
+		{Name: "default", Registry: withDefault, Host: "localhost", Expect: "ru"},
+		{Name: "no default", Registry: withoutDefault, Host: "localhost", Err: tenant.ErrNoTenant},
+		{Name: "single", Registry: single, ID: "kz", Expect: ""},
+	}
+
+	for _, test := range tests {
+		id, err := test.Registry.Resolve(test.ID, test.Host)
+		if test.Err != nil {
+			assert.ErrorIs(t, err, test.Err, test.Name)
+			continue
+		}
+		assert.NoError(t, err, test.Name)
+		assert.Equal(t, test.Expect, id, test.Name)
+	}
+}
+
+func TestApp(t *testing.T) {
+	registry := newRegistry(t, tenant.Config{Tenants: map[string]tenant.Tenant{"ru": {}, "kz": {}}})
+
+	ru, err := registry.App(tenant.WithID(context.Background(), "ru"))
+	assert.NoError(t, err)
+	kz, err := registry.App(tenant.WithID(context.Background(), "kz"))
+	assert.NoError(t, err)
+	_, err = ru.CreateUser("Oleg", "test@gmail.com")
+	assert.NoError(t, err)
+	_, err = kz.GetUser(0)
+	assert.Error(t, err, "tenants don't share users")
+
+	_, err = registry.App(tenant.WithID(context.Background(), "by"))
+	assert.ErrorIs(t, err, tenant.ErrUnknownTenant)
+	_, err = registry.App(context.Background())
+	assert.ErrorIs(t, err, tenant.ErrNoTenant)
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Config string
+		Err    bool
+	}{
+		{
+			Name: "valid",
+			Config: `
+default: ru
+tenants:
+  ru:
+    hosts: [ru.ads.test]
+  kz:
+    hosts: [kz.ads.test]
+    limits:
+      title: "min:1;max:50"
+`,
+		},
+		{Name: "no tenants", Config: `default: ru`, Err: true},
+		{Name: "unknown default", Config: "default: by\ntenants:\n  ru: {}\n", Err: true},
+		{Name: "shared host", Config: "tenants:\n  ru: {hosts: [ads.test]}\n  kz: {hosts: [ADS.test]}\n", Err: true},
+		{Name: "invalid limits", Config: "tenants:\n  ru: {limits: {title: \"max\"}}\n", Err: true},
+		{Name: "not yaml", Config: "tenants: [", Err: true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "tenants.yaml")
+		assert.NoError(t, os.WriteFile(path, []byte(test.Config), 0o600))
+		config, err := tenant.LoadConfig(path)
+		if test.Err {
+			assert.Error(t, err, test.Name)
+			continue
+		}
+		assert.NoError(t, err, test.Name)
+		assert.Equal(t, app.DefaultLimits, config.Tenants["ru"].Limits, "empty limits are the default")
+		assert.Equal(t, app.Limits{Title: "min:1;max:50", Text: app.DefaultLimits.Text}, config.Tenants["kz"].Limits)
+	}
+}
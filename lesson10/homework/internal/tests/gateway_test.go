@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/app"
+	"homework10/internal/ports/gateway"
+	grpcPort "homework10/internal/ports/grpc"
+	"homework10/internal/ports/httpgin"
+)
+
+type GatewaySuite struct {
+	suite.Suite
+	Cancel  context.CancelFunc
+	Srv     *grpc.Server
+	Conn    *grpc.ClientConn
+	V1      *httptest.Server
+	Gateway *httptest.Server
+}
+
+func (s *GatewaySuite) SetupTest() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	s.Cancel = cancel
+
+	// both transports get their own app, so the same scenario can be
+	// replayed against each of them independently, and the same clock, so
+	// the times of ads match too
+	now := time.Date(2023, 3, 8, 12, 30, 0, 0, time.UTC)
+	clock := app.WithClock(func() time.Time { return now })
+	server := httpgin.NewHTTPServer(":18080", app.NewApp(adrepo.New(), userrepo.New(), clock), httpgin.WithTokens(testTokens))
+	s.V1 = httptest.NewServer(server.Handler())
+
+	lis := bufconn.Listen(1024 * 1024)
+	s.Srv = grpcPort.NewGRPCServer(log.Default(), app.NewApp(adrepo.New(), userrepo.New(), clock),
+		grpc.ChainUnaryInterceptor(grpcPort.AuthUnaryInterceptor(testTokens)))
+	go func() {
+		_ = s.Srv.Serve(lis)
+	}()
+
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	s.Require().NoError(err, "grpc.DialContext")
+	s.Conn = conn
+
+	handler, err := gateway.NewHandler(ctx, conn)
+	s.Require().NoError(err, "gateway.NewHandler")
+	s.Gateway = httptest.NewServer(handler)
+}
+
+func (s *GatewaySuite) TearDownTest() {
+	s.Gateway.Close()
+	s.V1.Close()
+	s.Conn.Close()
+	s.Srv.Stop()
+	s.Cancel()
+}
+
+func TestGatewaySuite(t *testing.T) {
+	suite.Run(t, new(GatewaySuite))
+}
+
+type call struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+type compatStep struct {
+	Name string
+	V1   call
+	V2   call
+	// Message is the proto the data of both responses is decoded into
+	Message func() proto.Message
+	// List marks responses where the v1 data is a list and v2 wraps it
+	List bool
+	// User is the user whose token both calls carry
+	User int64
+}
+
+func (s *GatewaySuite) do(baseURL string, c call, userID int64) (int, []byte) {
+	var body io.Reader
+	if c.Body != "" {
+		body = bytes.NewBufferString(c.Body)
+	}
+	req, err := http.NewRequest(c.Method, baseURL+c.Path, body)
+	s.Require().NoError(err)
+	req.Header.Add("Content-Type", "application/json")
+	// the gateway passes the token on
+	req.Header.Add("Authorization", bearer(userID))
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	return resp.StatusCode, data
+}
+
+func (s *GatewaySuite) TestCompatibility() {
+	user := func() proto.Message { return &grpcPort.UserResponse{} }
+	ad := func() proto.Message { return &grpcPort.AdResponse{} }
+	ads := func() proto.Message { return &grpcPort.ListAdResponse{} }
+
+	steps := []compatStep{
+		{
+			Name:    "create user",
+			V1:      call{http.MethodPost, "/api/v1/users", `{"nickname":"Oleg","email":"test@gmail.com"}`},
+			V2:      call{http.MethodPost, "/api/v2/users", `{"nickname":"Oleg","email":"test@gmail.com"}`},
+			Message: user,
+		},
+		{
+			Name:    "create second user",
+			V1:      call{http.MethodPost, "/api/v1/users", `{"nickname":"Ivan","email":"ivan@gmail.com"}`},
+			V2:      call{http.MethodPost, "/api/v2/users", `{"nickname":"Ivan","email":"ivan@gmail.com"}`},
+			Message: user,
+		},
+		{
+			Name:    "get user",
+			V1:      call{http.MethodGet, "/api/v1/users/0", ""},
+			V2:      call{http.MethodGet, "/api/v2/users/0", ""},
+			Message: user,
+		},
+		{
+			Name:    "update user",
+			V1:      call{http.MethodPut, "/api/v1/users/0", `{"nickname":"Oleg1","email":"test1@gmail.com"}`},
+			V2:      call{http.MethodPut, "/api/v2/users/0", `{"nickname":"Oleg1","email":"test1@gmail.com"}`},
+			Message: user,
+		},
+		{
+			Name:    "find user",
+			V1:      call{http.MethodGet, "/api/v1/users/find?search_query=Oleg1", ""},
+			V2:      call{http.MethodGet, "/api/v2/users:find?query=Oleg1", ""},
+			Message: user,
+		},
+		{
+			Name:    "patch user",
+			V1:      call{http.MethodPatch, "/api/v1/users/0", `{"nickname":"Oleg2"}`},
+			V2:      call{http.MethodPatch, "/api/v2/users/0", `{"nickname":"Oleg2"}`},
+			Message: user,
+		},
+		{
+			Name:    "patch user back",
+			V1:      call{http.MethodPatch, "/api/v1/users/0", `{"nickname":"Oleg1"}`},
+			V2:      call{http.MethodPatch, "/api/v2/users/0", `{"nickname":"Oleg1"}`},
+			Message: user,
+		},
+		{
+			Name:    "create ad",
+			V1:      call{http.MethodPost, "/api/v1/ads", `{"title":"title","text":"text"}`},
+			V2:      call{http.MethodPost, "/api/v2/ads", `{"title":"title","text":"text"}`},
+			Message: ad,
+		},
+		{
+			Name: "create invalid ad",
+			V1:   call{http.MethodPost, "/api/v1/ads", `{"title":"","text":"text"}`},
+			V2:   call{http.MethodPost, "/api/v2/ads", `{"title":"","text":"text"}`},
+		},
+		{
+			Name:    "update ad",
+			V1:      call{http.MethodPut, "/api/v1/ads/0", `{"title":"title1","text":"text1"}`},
+			V2:      call{http.MethodPut, "/api/v2/ads/0", `{"title":"title1","text":"text1"}`},
+			Message: ad,
+		},
+		{
+			Name:    "patch ad",
+			V1:      call{http.MethodPatch, "/api/v1/ads/0", `{"text":"text2"}`},
+			V2:      call{http.MethodPatch, "/api/v2/ads/0", `{"text":"text2"}`},
+			Message: ad,
+		},
+		{
+			Name: "patch ad with empty title",
+			V1:   call{http.MethodPatch, "/api/v1/ads/0", `{"title":""}`},
+			V2:   call{http.MethodPatch, "/api/v2/ads/0", `{"title":""}`},
+		},
+		{
+			Name: "update someone else's ad",
+			V1:   call{http.MethodPut, "/api/v1/ads/0", `{"title":"title2","text":"text2"}`},
+			V2:   call{http.MethodPut, "/api/v2/ads/0", `{"title":"title2","text":"text2"}`},
+			User: 1,
+		},
+		{
+			Name:    "list no published ads",
+			V1:      call{http.MethodGet, "/api/v1/ads?filters=0", ""},
+			V2:      call{http.MethodGet, "/api/v2/ads?bitmask=0", ""},
+			Message: ads,
+			List:    true,
+		},
+		{
+			Name:    "publish ad",
+			V1:      call{http.MethodPut, "/api/v1/ads/0/status", `{"published":true}`},
+			V2:      call{http.MethodPut, "/api/v2/ads/0/status", `{"published":true}`},
+			Message: ad,
+		},
+		{
+			Name:    "list published ads",
+			V1:      call{http.MethodGet, "/api/v1/ads?filters=0", ""},
+			V2:      call{http.MethodGet, "/api/v2/ads?bitmask=0", ""},
+			Message: ads,
+			List:    true,
+		},
+		{
+			Name:    "find ad",
+			V1:      call{http.MethodGet, "/api/v1/ads/find?search_query=tit", ""},
+			V2:      call{http.MethodGet, "/api/v2/ads:find?query=tit", ""},
+			Message: ad,
+		},
+		{
+			Name:    "get ad",
+			V1:      call{http.MethodGet, "/api/v1/ads/0", ""},
+			V2:      call{http.MethodGet, "/api/v2/ads/0", ""},
+			Message: ad,
+		},
+		{
+			Name:    "delete ad",
+			V1:      call{http.MethodDelete, "/api/v1/ads/delete", `{"ad_id":0}`},
+			V2:      call{http.MethodDelete, "/api/v2/ads/0", ""},
+			Message: ad,
+		},
+		{
+			Name: "get deleted ad",
+			V1:   call{http.MethodGet, "/api/v1/ads/0", ""},
+			V2:   call{http.MethodGet, "/api/v2/ads/0", ""},
+		},
+		{
+			Name:    "delete user",
+			V1:      call{http.MethodDelete, "/api/v1/users/delete", `{"user_id":0}`},
+			V2:      call{http.MethodDelete, "/api/v2/users/0", ""},
+			Message: user,
+		},
+		{
+			Name: "get deleted user",
+			V1:   call{http.MethodGet, "/api/v1/users/0", ""},
+			V2:   call{http.MethodGet, "/api/v2/users/0", ""},
+		},
+	}
+
+	for _, step := range steps {
+		v1Status, v1Body := s.do(s.V1.URL, step.V1, step.User)
+		v2Status, v2Body := s.do(s.Gateway.URL, step.V2, step.User)
+		s.Equal(v1Status, v2Status, step.Name)
+		if step.Message == nil {
+			s.NotEqual(http.StatusOK, v1Status, step.Name)
+			continue
+		}
+		s.Equal(http.StatusOK, v1Status, step.Name)
+
+		var v1Response struct {
+			Data json.RawMessage `json:"data"`
+		}
+		s.NoError(json.Unmarshal(v1Body, &v1Response), step.Name)
+		v1Data := []byte(v1Response.Data)
+		if step.List {
+			v1Data = append(append([]byte(`{"list":`), v1Data...), '}')
+		}
+
+		// protojson is strict about unknown fields, so any drift in field
+		// names between the transports fails here
+		expected, actual := step.Message(), step.Message()
+		s.NoError(protojson.Unmarshal(v1Data, expected), step.Name)
+		s.NoError(protojson.Unmarshal(v2Body, actual), step.Name)
+		s.True(proto.Equal(expected, actual), "%s: %v != %v", step.Name, expected, actual)
+	}
+}
+
+func (s *GatewaySuite) TestOpenAPISpec() {
+	status, body := s.do(s.Gateway.URL, call{http.MethodGet, gateway.OpenAPIPath, ""}, 0)
+	s.Equal(http.StatusOK, status)
+
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	s.NoError(json.Unmarshal(body, &spec))
+	s.Contains(spec.Paths, "/api/v2/users/{id}")
+	s.Contains(spec.Paths["/api/v2/ads/{ad_id}/status"], "put")
+}
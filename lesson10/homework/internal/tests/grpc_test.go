@@ -11,7 +11,14 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"homework10/internal/adapters/adrepo"
 	"homework10/internal/app"
 	grpcPort "homework10/internal/ports/grpc"
@@ -44,7 +51,8 @@ func (s *GRPCSuite) SetupTest() {
 	lis := bufconn.Listen(1024 * 1024)
 	s.Lis = lis
 
-	srv := grpcPort.NewGRPCServer(logger, app.NewApp(adrepo.New(), userrepo.New()))
+	srv := grpcPort.NewGRPCServer(logger, app.NewApp(adrepo.New(), userrepo.New(), app.WithAdmins(0)),
+		grpc.ChainUnaryInterceptor(grpcPort.AuthUnaryInterceptor(testTokens)))
 	s.Srv = srv
 
 	go func() {
@@ -62,85 +70,158 @@ func (s *GRPCSuite) SetupTest() {
 	s.Client = grpcPort.NewAdServiceClient(conn)
 }
 
+// as makes the calls with ctx on behalf of the user with userID.
+func as(ctx context.Context, userID int64) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", bearer(userID))
+}
+
 func (s *GRPCSuite) TestGRPCCreateUser() {
 	ctx, client := s.Ctx, s.Client
 
-	res, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	res, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 	s.Equal(int64(0), res.Id)
-	s.Equal("Oleg", res.Name)
+	s.Equal("Oleg", res.Nickname)
 	s.Equal("test@gmail.com", res.Email)
 }
 
 func (s *GRPCSuite) TestGRPCGetUser() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
 	res, err := client.GetUser(ctx, &grpcPort.GetUserRequest{Id: 0})
 	s.NoError(err, "client.GetUser")
 	s.Equal(int64(0), res.Id)
-	s.Equal("Oleg", res.Name)
+	s.Equal("Oleg", res.Nickname)
 	s.Equal("test@gmail.com", res.Email)
 }
 
 func (s *GRPCSuite) TestGRPCUpdateUser() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	res, err := client.UpdateUser(ctx, &grpcPort.UpdateUserRequest{Id: 0, Name: "Oleg1", Email: "test1@gmail.com"})
+	_, err = client.UpdateUser(ctx, &grpcPort.UpdateUserRequest{Id: 0, Nickname: "Oleg1", Email: "test1@gmail.com"})
+	s.Equal(codes.Unauthenticated, status.Code(err))
+
+	res, err := client.UpdateUser(as(ctx, 0), &grpcPort.UpdateUserRequest{Id: 0, Nickname: "Oleg1", Email: "test1@gmail.com"})
 	s.NoError(err, "client.UpdateUser")
 	s.Equal(int64(0), res.Id)
-	s.Equal("Oleg1", res.Name)
+	s.Equal("Oleg1", res.Nickname)
 	s.Equal("test1@gmail.com", res.Email)
 }
 
 func (s *GRPCSuite) TestGRPCFindUser() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
 	res, err := client.FindUser(ctx, &grpcPort.FindUserRequest{Query: "Oleg"})
 	s.NoError(err, "client.FindUser")
 	s.Equal(int64(0), res.Id)
-	s.Equal("Oleg", res.Name)
+	s.Equal("Oleg", res.Nickname)
 	s.Equal("test@gmail.com", res.Email)
 }
 
 func (s *GRPCSuite) TestGRPCDeleteUser() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	res, err := client.DeleteUser(ctx, &grpcPort.DeleteUserRequest{Id: 0})
+	res, err := client.DeleteUser(as(ctx, 0), &grpcPort.DeleteUserRequest{Id: 0})
 	s.NoError(err, "client.DeleteUser")
 	s.Equal(int64(0), res.Id)
-	s.Equal("Oleg", res.Name)
+	s.Equal("Oleg", res.Nickname)
 	s.Equal("test@gmail.com", res.Email)
 
 	_, err = client.GetUser(ctx, &grpcPort.GetUserRequest{Id: 0})
 	s.Error(err, "client.GetUser")
 }
 
+func (s *GRPCSuite) TestGRPCPatchAd() {
+	ctx, client := s.Ctx, s.Client
+
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
+	s.NoError(err, "client.CreateUser")
+	_, err = client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "hello", Text: "world"})
+	s.NoError(err, "client.CreateAd")
+
+	res, err := client.PatchAd(as(ctx, 0), &grpcPort.PatchAdRequest{
+		AdId:       0,
+		Ad:         &grpcPort.AdPatch{Title: "ignored", Text: "text"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"text"}},
+	})
+	s.NoError(err, "client.PatchAd")
+	s.Equal("hello", res.Title, "fields out of the mask are kept")
+	s.Equal("text", res.Text)
+
+	_, err = client.PatchAd(as(ctx, 0), &grpcPort.PatchAdRequest{
+		Ad:         &grpcPort.AdPatch{},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title"}},
+	})
+	s.Equal(codes.InvalidArgument, status.Code(err), "empty title in the mask is validated")
+
+	_, err = client.PatchAd(as(ctx, 0), &grpcPort.PatchAdRequest{UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"author_id"}}})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+
+	res, err = client.PatchAd(as(ctx, 0), &grpcPort.PatchAdRequest{Ad: &grpcPort.AdPatch{Title: "title"}})
+	s.NoError(err, "client.PatchAd")
+	s.Equal("title", res.Title, "without a mask non-empty fields are changed")
+	s.Equal("text", res.Text)
+}
+
+func (s *GRPCSuite) TestGRPCAdmin() {
+	ctx, client := s.Ctx, s.Client
+
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "admin", Email: "admin@gmail.com"})
+	s.NoError(err, "client.CreateUser")
+	_, err = client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
+	s.NoError(err, "client.CreateUser")
+	_, err = client.CreateAd(as(ctx, 1), &grpcPort.CreateAdRequest{Title: "hello", Text: "world"})
+	s.NoError(err, "client.CreateAd")
+
+	_, err = client.BlockUser(ctx, &grpcPort.BlockUserRequest{Id: 0, Blocked: true})
+	s.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = client.BlockUser(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer forged"), &grpcPort.BlockUserRequest{Id: 0, Blocked: true})
+	s.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = client.BlockUser(as(ctx, 1), &grpcPort.BlockUserRequest{Id: 0, Blocked: true})
+	s.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = client.SetUserRole(as(ctx, 0), &grpcPort.SetUserRoleRequest{Id: 1, Role: "superuser"})
+	s.Equal(codes.InvalidArgument, status.Code(err))
+
+	user, err := client.SetUserRole(as(ctx, 0), &grpcPort.SetUserRoleRequest{Id: 1, Role: "moderator"})
+	s.NoError(err, "client.SetUserRole")
+	s.Equal("moderator", user.Role)
+	user, err = client.BlockUser(as(ctx, 0), &grpcPort.BlockUserRequest{Id: 1, Blocked: true})
+	s.NoError(err, "client.BlockUser")
+	s.True(user.Blocked)
+
+	_, err = client.UnpublishAd(as(ctx, 1), &grpcPort.UnpublishAdRequest{AdId: 0})
+	s.Equal(codes.PermissionDenied, status.Code(err), "blocked moderators can't unpublish")
+	ad, err := client.UnpublishAd(as(ctx, 0), &grpcPort.UnpublishAdRequest{AdId: 0})
+	s.NoError(err, "client.UnpublishAd")
+	s.False(ad.Published)
+}
+
 func (s *GRPCSuite) TestGRPCListAds() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	_, err = client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "title", Text: "text", UserId: 0})
+	_, err = client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
 	s.NoError(err, "client.CreateAd")
 
 	res, err := client.ListAds(ctx, &grpcPort.ListAdsRequest{Bitmask: 0})
 	s.NoError(err, "client.ListAds")
 	s.Equal(0, len(res.List))
 
-	_, err = client.ChangeAdStatus(ctx, &grpcPort.ChangeAdStatusRequest{AdId: 0, UserId: 0, Published: true})
+	_, err = client.ChangeAdStatus(as(ctx, 0), &grpcPort.ChangeAdStatusRequest{AdId: 0, Published: true})
 	s.NoError(err, "client.ChangeAdStatus")
 
 	res, err = client.ListAds(ctx, &grpcPort.ListAdsRequest{Bitmask: 0})
@@ -149,13 +230,43 @@ func (s *GRPCSuite) TestGRPCListAds() {
 	s.Equal(int64(0), res.List[0].Id)
 }
 
+func (s *GRPCSuite) TestGRPCListAdsByTime() {
+	ctx, client := s.Ctx, s.Client
+
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
+	s.NoError(err, "client.CreateUser")
+
+	ad, err := client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
+	s.NoError(err, "client.CreateAd")
+	s.NotNil(ad.CreationTime)
+	s.True(proto.Equal(ad.CreationTime, ad.LastUpdateTime))
+
+	created := ad.CreationTime.AsTime()
+	res, err := client.ListAds(ctx, &grpcPort.ListAdsRequest{Bitmask: app.NonPublished, CreatedFrom: ad.CreationTime})
+	s.NoError(err, "client.ListAds")
+	s.Equal(1, len(res.List))
+	s.True(proto.Equal(ad.CreationTime, res.List[0].CreationTime))
+
+	res, err = client.ListAds(ctx, &grpcPort.ListAdsRequest{Bitmask: app.NonPublished, CreatedTo: ad.CreationTime})
+	s.NoError(err, "client.ListAds")
+	s.Equal(0, len(res.List))
+
+	res, err = client.ListAds(ctx, &grpcPort.ListAdsRequest{
+		Bitmask:     app.NonPublished,
+		UpdatedFrom: timestamppb.New(created.Add(-time.Minute)),
+		UpdatedTo:   timestamppb.New(created.Add(time.Minute)),
+	})
+	s.NoError(err, "client.ListAds")
+	s.Equal(1, len(res.List))
+}
+
 func (s *GRPCSuite) TestGRPCCreateAd() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	res, err := client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "title", Text: "text", UserId: 0})
+	res, err := client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
 	s.NoError(err, "client.CreateAd")
 	s.Equal(int64(0), res.Id)
 	s.Equal("title", res.Title)
@@ -166,10 +277,10 @@ func (s *GRPCSuite) TestGRPCCreateAd() {
 func (s *GRPCSuite) TestGRPCGetAd() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	_, err = client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "title", Text: "text", UserId: 0})
+	_, err = client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
 	s.NoError(err, "client.CreateAd")
 
 	res, err := client.GetAd(ctx, &grpcPort.GetAdRequest{Id: 0})
@@ -183,13 +294,13 @@ func (s *GRPCSuite) TestGRPCGetAd() {
 func (s *GRPCSuite) TestGRPCUpdateAd() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	_, err = client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "title", Text: "text", UserId: 0})
+	_, err = client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
 	s.NoError(err, "client.CreateAd")
 
-	res, err := client.UpdateAd(ctx, &grpcPort.UpdateAdRequest{Title: "title1", Text: "text1", UserId: 0})
+	res, err := client.UpdateAd(as(ctx, 0), &grpcPort.UpdateAdRequest{Title: "title1", Text: "text1"})
 	s.NoError(err, "client.UpdateAd")
 	s.Equal(int64(0), res.Id)
 	s.Equal("title1", res.Title)
@@ -200,13 +311,13 @@ func (s *GRPCSuite) TestGRPCUpdateAd() {
 func (s *GRPCSuite) TestGRPCChangeAdStatus() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	_, err = client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "title", Text: "text", UserId: 0})
+	_, err = client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
 	s.NoError(err, "client.CreateAd")
 
-	res, err := client.ChangeAdStatus(ctx, &grpcPort.ChangeAdStatusRequest{AdId: 0, UserId: 0, Published: true})
+	res, err := client.ChangeAdStatus(as(ctx, 0), &grpcPort.ChangeAdStatusRequest{AdId: 0, Published: true})
 	s.NoError(err, "client.UpdateAd")
 	s.Equal(int64(0), res.Id)
 	s.Equal("title", res.Title)
@@ -217,10 +328,10 @@ func (s *GRPCSuite) TestGRPCChangeAdStatus() {
 func (s *GRPCSuite) TestGRPCFindAd() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	_, err = client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "title", Text: "text", UserId: 0})
+	_, err = client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
 	s.NoError(err, "client.CreateAd")
 
 	res, err := client.FindAd(ctx, &grpcPort.FindAdRequest{Query: "title"})
@@ -234,13 +345,13 @@ func (s *GRPCSuite) TestGRPCFindAd() {
 func (s *GRPCSuite) TestGRPCDeleteAd() {
 	ctx, client := s.Ctx, s.Client
 
-	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg", Email: "test@gmail.com"})
+	_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
 	s.NoError(err, "client.CreateUser")
 
-	_, err = client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "title", Text: "text", UserId: 0})
+	_, err = client.CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "title", Text: "text"})
 	s.NoError(err, "client.CreateAd")
 
-	res, err := client.DeleteAd(ctx, &grpcPort.DeleteAdRequest{AdId: 0, AuthorId: 0})
+	res, err := client.DeleteAd(as(ctx, 0), &grpcPort.DeleteAdRequest{AdId: 0})
 	s.NoError(err, "client.DeleteAd")
 	s.Equal(int64(0), res.Id)
 	s.Equal("title", res.Title)
@@ -251,6 +362,31 @@ func (s *GRPCSuite) TestGRPCDeleteAd() {
 	s.Error(err, "client.GetAd")
 }
 
+func (s *GRPCSuite) TestGRPCForgedActor() {
+	ctx, client := s.Ctx, s.Client
+
+	for _, nickname := range []string{"admin", "author", "test"} {
+		_, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: nickname, Email: "test@gmail.com"})
+		s.NoError(err, "client.CreateUser")
+	}
+	_, err := client.CreateAd(as(ctx, 1), &grpcPort.CreateAdRequest{Title: "hello", Text: "world"})
+	s.NoError(err, "client.CreateAd")
+
+	// clients built against the old proto still send author_id, which names
+	// the admin here, but the actor is the user of the token
+	req := &grpcPort.DeleteAdRequest{AdId: 0}
+	req.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), 0))
+
+	_, err = client.DeleteAd(ctx, req)
+	s.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = client.DeleteAd(as(ctx, 2), req)
+	s.Equal(codes.PermissionDenied, status.Code(err))
+
+	ad, err := client.GetAd(ctx, &grpcPort.GetAdRequest{Id: 0})
+	s.NoError(err, "client.GetAd")
+	s.Equal(int64(1), ad.AuthorId)
+}
+
 func TestGRPCSuite(t *testing.T) {
 	suite.Run(t, new(GRPCSuite))
 }
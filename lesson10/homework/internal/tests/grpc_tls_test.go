@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/ads"
+	"homework10/internal/app"
+	"homework10/internal/auth"
+	grpcPort "homework10/internal/ports/grpc"
+	"homework10/internal/tlsconfig"
+	"homework10/internal/tlsconfig/tlstest"
+)
+
+func TestGRPCMutualTLS(t *testing.T) {
+	ca := tlstest.NewCA(t, "ca")
+	serverFiles := ca.Issue(t, t.TempDir(), "ads")
+	reloader, err := tlsconfig.NewReloader(serverFiles)
+	assert.NoError(t, err)
+
+	identities, err := grpcPort.ParseIdentities("gateway=ads-gateway, adsctl=ads-cli, moderation=ads-moderation")
+	assert.NoError(t, err)
+
+	mutex := &sync.Mutex{}
+	callers := make([]string, 0)
+	recordCaller := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		identity, _ := auth.FromContext(ctx).Service()
+		mutex.Lock()
+		callers = append(callers, identity)
+		mutex.Unlock()
+		return handler(ctx, req)
+	}
+
+	services := map[string]ads.Role{"ads-moderation": ads.RoleModerator}
+	srv := grpcPort.NewGRPCServer(log.Default(), app.NewApp(adrepo.New(), userrepo.New(), app.WithServices(services)),
+		grpc.Creds(credentials.NewTLS(reloader.ServerConfig(true))),
+		grpc.ChainUnaryInterceptor(grpcPort.IdentityUnaryInterceptor(identities), recordCaller, grpcPort.AuthUnaryInterceptor(testTokens)),
+	)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	tests := []struct {
+		Name   string
+		Client tlsconfig.Files
+		Code   codes.Code
+	}{
+		{
+			Name:   "known service",
+			Client: ca.Issue(t, t.TempDir(), "gateway"),
+			Code:   codes.OK,
+		},
+		{
+			Name:   "unknown service",
+			Client: ca.Issue(t, t.TempDir(), "stranger"),
+			Code:   codes.PermissionDenied,
+		},
+		{
+			Name:   "no client certificate",
+			Client: tlsconfig.Files{CAFile: serverFiles.CAFile},
+			Code:   codes.Unavailable,
+		},
+	}
+
+	dial := func(ctx context.Context, files tlsconfig.Files) *grpc.ClientConn {
+		client, err := tlsconfig.NewReloader(files)
+		assert.NoError(t, err)
+		conn, err := grpc.DialContext(ctx, lis.Addr().String(), grpc.WithTransportCredentials(client.ClientCredentials()))
+		assert.NoError(t, err)
+		return conn
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn := dial(ctx, test.Client)
+
+		_, err = grpcPort.NewAdServiceClient(conn).CreateUser(ctx, &grpcPort.CreateUserRequest{Nickname: "Oleg", Email: "test@gmail.com"})
+		assert.Equal(t, test.Code, status.Code(err), "%s: %v", test.Name, err)
+
+		conn.Close()
+		cancel()
+	}
+
+	assert.Equal(t, []string{"ads-gateway"}, callers)
+
+	// what a service may do is up to its role in the app
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	gateway := dial(ctx, ca.Issue(t, t.TempDir(), "gateway"))
+	defer gateway.Close()
+	_, err = grpcPort.NewAdServiceClient(gateway).CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "hello", Text: "world"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "services don't author ads")
+	ad, err := grpcPort.NewAdServiceClient(gateway).CreateAd(as(ctx, 0), &grpcPort.CreateAdRequest{Title: "hello", Text: "world"})
+	assert.NoError(t, err, "the gateway relays the token of the user")
+	_, err = grpcPort.NewAdServiceClient(gateway).UnpublishAd(ctx, &grpcPort.UnpublishAdRequest{AdId: ad.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "service without a role")
+
+	moderation := dial(ctx, ca.Issue(t, t.TempDir(), "moderation"))
+	defer moderation.Close()
+	_, err = grpcPort.NewAdServiceClient(moderation).UnpublishAd(ctx, &grpcPort.UnpublishAdRequest{AdId: ad.Id})
+	assert.NoError(t, err, "service with the moderator role")
+}
+
+func TestParseIdentities(t *testing.T) {
+	tests := []struct {
+		In     string
+		Expect map[string]string
+		Err    bool
+	}{
+		{In: "", Expect: map[string]string{}},
+		{In: "gateway=ads-gateway", Expect: map[string]string{"gateway": "ads-gateway"}},
+		{In: "a=b, c=d", Expect: map[string]string{"a": "b", "c": "d"}},
+		{In: "gateway", Err: true},
+		{In: "=identity", Err: true},
+		{In: "a=b,", Err: true},
+	}
+
+	for _, test := range tests {
+		identities, err := grpcPort.ParseIdentities(test.In)
+		if test.Err {
+			assert.Error(t, err, test.In)
+			continue
+		}
+		assert.NoError(t, err, test.In)
+		assert.Equal(t, test.Expect, identities)
+	}
+}
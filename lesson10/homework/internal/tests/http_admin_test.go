@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+)
+
+func (s *HTTPSuite) TestDeleteAnotherUser() {
+	client := s.Client
+
+	_, err := client.createUser("admin", "admin")
+	s.NoError(err)
+
+	_, err = client.createUser("test", "user")
+	s.NoError(err)
+
+	_, err = client.deleteUser(0, 1)
+	s.ErrorIs(err, ErrForbidden)
+
+	resp, err := client.deleteUser(1, 0)
+	s.NoError(err)
+	s.Equal(int64(1), resp.Data.ID)
+}
+
+func (s *HTTPSuite) TestBlockUser() {
+	client := s.Client
+
+	_, err := client.createUser("admin", "admin")
+	s.NoError(err)
+
+	_, err = client.createUser("test", "user")
+	s.NoError(err)
+
+	_, err = client.blockUser(0, 1, true)
+	s.ErrorIs(err, ErrForbidden)
+
+	resp, err := client.blockUser(1, 0, true)
+	s.NoError(err)
+	s.True(resp.Data.Blocked)
+
+	_, err = client.createAd(1, "hello", "world")
+	s.ErrorIs(err, ErrForbidden)
+
+	_, err = client.blockUser(1, 0, false)
+	s.NoError(err)
+
+	_, err = client.createAd(1, "hello", "world")
+	s.NoError(err)
+}
+
+func (s *HTTPSuite) TestModeratorUnpublishesAd() {
+	client := s.Client
+
+	_, err := client.createUser("admin", "admin")
+	s.NoError(err)
+
+	_, err = client.createUser("moderator", "moderator")
+	s.NoError(err)
+
+	_, err = client.createUser("test", "user")
+	s.NoError(err)
+
+	ad, err := client.createAd(2, "hello", "world")
+	s.NoError(err)
+
+	_, err = client.changeAdStatus(2, ad.Data.ID, true)
+	s.NoError(err)
+
+	_, err = client.unpublishAd(ad.Data.ID, 1)
+	s.ErrorIs(err, ErrForbidden)
+
+	_, err = client.setUserRole(1, 1, "moderator")
+	s.ErrorIs(err, ErrForbidden)
+
+	_, err = client.setUserRole(1, 0, "superuser")
+	s.ErrorIs(err, ErrBadRequest)
+
+	user, err := client.setUserRole(1, 0, "moderator")
+	s.NoError(err)
+	s.Equal("moderator", user.Data.Role)
+
+	resp, err := client.unpublishAd(ad.Data.ID, 1)
+	s.NoError(err)
+	s.False(resp.Data.Published)
+
+	ads, err := client.listAds(0)
+	s.NoError(err)
+	s.Empty(ads.Data)
+}
+
+func (s *HTTPSuite) TestActorIsAuthenticated() {
+	client := s.Client
+
+	_, err := client.createUser("admin", "admin")
+	s.NoError(err)
+
+	_, err = client.createUser("test", "user")
+	s.NoError(err)
+
+	_, err = client.blockUser(1, anonymous, true)
+	s.ErrorIs(err, ErrUnauthorized)
+
+	resp, _, err := client.do(http.MethodPut, "/api/v1/admin/users/1/block",
+		http.Header{"Content-Type": {"application/json"}}, strings.NewReader(`{"blocked":true,"actor_id":0}`))
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode, "the actor of the body is ignored")
+
+	resp, _, err = client.do(http.MethodPut, "/api/v1/admin/users/1/block",
+		http.Header{"Content-Type": {"application/json"}, "Authorization": {"Bearer forged"}}, strings.NewReader(`{"blocked":true}`))
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Equal("Bearer", resp.Header.Get("WWW-Authenticate"))
+
+	_, err = client.deleteUser(0, anonymous)
+	s.ErrorIs(err, ErrUnauthorized)
+
+	user, err := client.getUser(1)
+	s.NoError(err)
+	s.False(user.Data.Blocked)
+}
+
+func (s *HTTPSuite) TestAdActorIsAuthenticated() {
+	client := s.Client
+
+	_, err := client.createUser("admin", "admin")
+	s.NoError(err)
+
+	_, err = client.createUser("author", "author")
+	s.NoError(err)
+
+	_, err = client.createUser("test", "user")
+	s.NoError(err)
+
+	ad, err := client.createAd(1, "hello", "world")
+	s.NoError(err)
+
+	// the user_id of the body names the admin, but the actor is the user
+	// of the token
+	requests := []struct {
+		Name   string
+		Method string
+		Path   string
+		Body   string
+	}{
+		{Name: "delete", Method: http.MethodDelete, Path: "/api/v1/ads/delete", Body: `{"ad_id":0,"user_id":0}`},
+		{Name: "publish", Method: http.MethodPut, Path: "/api/v1/ads/0/status", Body: `{"published":true,"user_id":0}`},
+		{Name: "update", Method: http.MethodPut, Path: "/api/v1/ads/0", Body: `{"title":"title","text":"text","user_id":0}`},
+	}
+	for _, req := range requests {
+		resp, _, err := client.do(req.Method, req.Path,
+			http.Header{"Content-Type": {"application/json"}}, strings.NewReader(req.Body))
+		s.NoError(err)
+		s.Equal(http.StatusUnauthorized, resp.StatusCode, req.Name)
+
+		resp, _, err = client.do(req.Method, req.Path,
+			http.Header{"Content-Type": {"application/json"}, "Authorization": {bearer(2)}}, strings.NewReader(req.Body))
+		s.NoError(err)
+		s.Equal(http.StatusForbidden, resp.StatusCode, req.Name)
+	}
+
+	resp, err := client.getAd(ad.Data.ID)
+	s.NoError(err)
+	s.Equal("hello", resp.Data.Title)
+	s.False(resp.Data.Published)
+
+	_, body, err := client.do(http.MethodPost, "/api/v1/ads",
+		http.Header{"Content-Type": {"application/json"}, "Authorization": {bearer(2)}}, strings.NewReader(`{"title":"title","text":"text","user_id":0}`))
+	s.NoError(err)
+	s.Contains(string(body), `"author_id":2`)
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/app"
+	"homework10/internal/ports/httpgin"
+)
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+func newDocsServer(t *testing.T) (*gin.Engine, *httptest.Server) {
+	server := httpgin.NewHTTPServer(":18080", app.NewApp(adrepo.New(), userrepo.New()))
+	engine, ok := server.Handler().(*gin.Engine)
+	assert.True(t, ok)
+	testServer := httptest.NewServer(engine)
+	t.Cleanup(testServer.Close)
+	return engine, testServer
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, []byte) {
+	resp, err := client.Get(url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, body
+}
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	engine, testServer := newDocsServer(t)
+
+	resp, body := get(t, testServer.Client(), testServer.URL+httpgin.OpenAPIPath)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &spec))
+	assert.True(t, strings.HasPrefix(spec.OpenAPI, "3."), "spec version %s", spec.OpenAPI)
+	assert.Len(t, spec.Servers, 1)
+
+	documented := make([]string, 0)
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+spec.Servers[0].URL+path)
+		}
+	}
+
+	registered := make([]string, 0)
+	for _, route := range engine.Routes() {
+		if route.Path == httpgin.OpenAPIPath || strings.HasPrefix(route.Path, httpgin.DocsPath) {
+			continue
+		}
+		registered = append(registered, route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}"))
+	}
+
+	sort.Strings(documented)
+	sort.Strings(registered)
+	assert.Equal(t, registered, documented, "run go generate ./internal/ports/httpgin after changing the routes")
+}
+
+func TestSwaggerUI(t *testing.T) {
+	_, testServer := newDocsServer(t)
+
+	resp, body := get(t, testServer.Client(), testServer.URL+httpgin.DocsPath)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, httpgin.DocsPath+"/index.html", resp.Request.URL.Path)
+	assert.Contains(t, string(body), "openapi.json")
+
+	resp, _ = get(t, testServer.Client(), testServer.URL+httpgin.DocsPath+"/swagger-ui-bundle.js")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/app"
+	grpcPort "homework10/internal/ports/grpc"
+	"homework10/internal/ports/httpgin"
+)
+
+func (s *HTTPSuite) TestNegotiation() {
+	client := s.Client
+
+	_, err := client.createUser("test", "user")
+	s.NoError(err)
+
+	tests := []struct {
+		Name        string
+		Accept      string
+		Status      int
+		ContentType string
+	}{
+		{Name: "no accept", Status: http.StatusOK, ContentType: "application/json"},
+		{Name: "any", Accept: "*/*", Status: http.StatusOK, ContentType: "application/json"},
+		{Name: "msgpack", Accept: httpgin.MIMEMsgPack, Status: http.StatusOK, ContentType: httpgin.MIMEMsgPack},
+		{Name: "x-msgpack", Accept: "application/x-msgpack", Status: http.StatusOK, ContentType: httpgin.MIMEMsgPack},
+		{Name: "protobuf", Accept: httpgin.MIMEProtobuf, Status: http.StatusOK, ContentType: httpgin.MIMEProtobuf},
+		{Name: "quality", Accept: "application/json;q=0.5, application/x-protobuf", Status: http.StatusOK, ContentType: httpgin.MIMEProtobuf},
+		{Name: "browser", Accept: "text/html,application/xhtml+xml,*/*;q=0.8", Status: http.StatusOK, ContentType: "application/json"},
+		{Name: "not acceptable", Accept: "text/html", Status: http.StatusNotAcceptable, ContentType: "application/json"},
+		{Name: "refused", Accept: "application/json;q=0, */*", Status: http.StatusOK, ContentType: httpgin.MIMEMsgPack},
+	}
+
+	for _, test := range tests {
+		resp, body, err := client.do(http.MethodGet, "/api/v1/users/0", http.Header{"Accept": {test.Accept}}, nil)
+		s.NoError(err, test.Name)
+		s.Equal(test.Status, resp.StatusCode, test.Name)
+		s.True(strings.HasPrefix(resp.Header.Get("Content-Type"), test.ContentType), test.Name)
+		s.Contains(resp.Header.Values("Vary"), "Accept", test.Name)
+		if test.Status != http.StatusOK {
+			continue
+		}
+
+		var user userData
+		switch test.ContentType {
+		case httpgin.MIMEMsgPack:
+			var data userResponse
+			s.NoError(codec.NewDecoderBytes(body, new(codec.MsgpackHandle)).Decode(&data), test.Name)
+			user = data.Data
+		case httpgin.MIMEProtobuf:
+			var message grpcPort.UserResponse
+			s.NoError(proto.Unmarshal(body, &message), test.Name)
+			user = userData{ID: message.Id, Nickname: message.Nickname, Email: message.Email}
+		default:
+			var data userResponse
+			s.NoError(json.Unmarshal(body, &data), test.Name)
+			user = data.Data
+		}
+		s.Equal("test", user.Nickname, test.Name)
+		s.Equal("user", user.Email, test.Name)
+	}
+}
+
+func (s *HTTPSuite) TestProtobufError() {
+	resp, body, err := s.Client.do(http.MethodGet, "/api/v1/users/1", http.Header{"Accept": {httpgin.MIMEProtobuf}}, nil)
+	s.NoError(err)
+	s.Equal(http.StatusInternalServerError, resp.StatusCode)
+
+	var message status.Status
+	s.NoError(proto.Unmarshal(body, &message))
+	s.Equal(int32(codes.Internal), message.Code)
+	s.NotEmpty(message.Message)
+}
+
+func createAds(client *testClient, count int) error {
+	if _, err := client.createUser("test", "user"); err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		if _, err := client.createAd(0, fmt.Sprintf("ad number %d", i), strings.Repeat("text of the ad ", 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decompress(encoding string, body []byte) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(body)
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case "br":
+		r = brotli.NewReader(r)
+	}
+	return io.ReadAll(r)
+}
+
+func (s *HTTPSuite) TestCompression() {
+	client := s.Client
+	s.NoError(createAds(client, 20))
+	list := fmt.Sprintf("/api/v1/ads?filters=%d", app.NonPublished)
+
+	tests := []struct {
+		Name           string
+		Path           string
+		AcceptEncoding string
+		Encoding       string
+	}{
+		{Name: "gzip", Path: list, AcceptEncoding: "gzip", Encoding: "gzip"},
+		{Name: "brotli", Path: list, AcceptEncoding: "gzip, br", Encoding: "br"},
+		{Name: "quality", Path: list, AcceptEncoding: "br;q=0.1, gzip", Encoding: "gzip"},
+		{Name: "any", Path: list, AcceptEncoding: "*", Encoding: "br"},
+		{Name: "identity", Path: list, AcceptEncoding: "identity"},
+		{Name: "small", Path: "/api/v1/ads/0", AcceptEncoding: "gzip, br"},
+	}
+
+	for _, test := range tests {
+		resp, body, err := client.do(http.MethodGet, test.Path, http.Header{"Accept-Encoding": {test.AcceptEncoding}}, nil)
+		s.NoError(err, test.Name)
+		s.Equal(http.StatusOK, resp.StatusCode, test.Name)
+		s.Equal(test.Encoding, resp.Header.Get("Content-Encoding"), test.Name)
+		s.Contains(resp.Header.Values("Vary"), "Accept-Encoding", test.Name)
+
+		body, err = decompress(test.Encoding, body)
+		s.NoError(err, test.Name)
+		s.Contains(string(body), `"title":"ad number`, test.Name)
+	}
+}
+
+func (s *HTTPSuite) TestRequestDecompression() {
+	client := s.Client
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	_, err := gz.Write([]byte(`{"nickname":"test","email":"user"}`))
+	s.NoError(err)
+	s.NoError(gz.Close())
+
+	header := http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}}
+	resp, _, err := client.do(http.MethodPost, "/api/v1/users", header, bytes.NewReader(body.Bytes()))
+	s.NoError(err)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	user, err := client.getUser(0)
+	s.NoError(err)
+	s.Equal("test", user.Data.Nickname)
+
+	resp, _, err = client.do(http.MethodPost, "/api/v1/users", header, strings.NewReader(`{"nickname":"test"}`))
+	s.NoError(err)
+	s.Equal(http.StatusBadRequest, resp.StatusCode, "body isn't gzip")
+
+	header.Set("Content-Encoding", "compress")
+	resp, _, err = client.do(http.MethodPost, "/api/v1/users", header, bytes.NewReader(body.Bytes()))
+	s.NoError(err)
+	s.Equal(http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+// BenchmarkListAdsPayload reports the size of a large list of ads in every
+// format and encoding.
+func BenchmarkListAdsPayload(b *testing.B) {
+	server := httpgin.NewHTTPServer(":18080", app.NewApp(adrepo.New(), userrepo.New()))
+	testServer := httptest.NewServer(server.Handler())
+	defer testServer.Close()
+	client := &testClient{client: testServer.Client(), baseURL: testServer.URL}
+	if err := createAds(client, 1000); err != nil {
+		b.Fatal(err)
+	}
+	list := fmt.Sprintf("/api/v1/ads?filters=%d", app.NonPublished)
+
+	for _, accept := range []string{"application/json", httpgin.MIMEMsgPack, httpgin.MIMEProtobuf} {
+		for _, encoding := range []string{"identity", "gzip", "br"} {
+			header := http.Header{"Accept": {accept}, "Accept-Encoding": {encoding}}
+			b.Run(accept+"/"+encoding, func(b *testing.B) {
+				var size int
+				for i := 0; i < b.N; i++ {
+					_, body, err := client.do(http.MethodGet, list, header, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					size = len(body)
+				}
+				b.ReportMetric(float64(size), "payload-bytes")
+			})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import "homework10/internal/ports/httpgin"
+
+func (s *HTTPSuite) TestPatchUser() {
+	client := s.Client
+
+	_, err := client.createUser("test", "user")
+	s.NoError(err)
+
+	_, err = client.createUser("other", "user")
+	s.NoError(err)
+
+	var resp userResponse
+	err = client.patch("/api/v1/users/0", httpgin.MergePatchContentType, `{"nickname":"test1"}`, &resp)
+	s.ErrorIs(err, ErrUnauthorized)
+
+	err = client.patchAs(1, "/api/v1/users/0", httpgin.MergePatchContentType, `{"nickname":"test1"}`, &resp)
+	s.ErrorIs(err, ErrForbidden, "users patch themselves only")
+
+	err = client.patchAs(0, "/api/v1/users/0", httpgin.MergePatchContentType, `{"nickname":"test1"}`, &resp)
+	s.NoError(err)
+	s.Equal("test1", resp.Data.Nickname)
+	s.Equal("user", resp.Data.Email, "missing members are kept")
+
+	err = client.patchAs(0, "/api/v1/users/0", httpgin.MergePatchContentType, `{"email":""}`, &resp)
+	s.NoError(err)
+	s.Equal("test1", resp.Data.Nickname)
+	s.Equal("", resp.Data.Email, "empty members are set")
+
+	err = client.patchAs(0, "/api/v1/users/0", httpgin.MergePatchContentType, `{"email":null}`, &resp)
+	s.ErrorIs(err, ErrBadRequest)
+
+	err = client.patchAs(0, "/api/v1/users/0", "text/plain", `{"email":"user"}`, &resp)
+	s.ErrorIs(err, ErrMediaType)
+}
+
+func (s *HTTPSuite) TestPatchAd() {
+	client := s.Client
+
+	_, err := client.createUser("test", "user")
+	s.NoError(err)
+
+	_, err = client.createUser("test", "user")
+	s.NoError(err)
+
+	_, err = client.createAd(0, "hello", "world")
+	s.NoError(err)
+
+	var resp adResponse
+	err = client.patch("/api/v1/ads/0", httpgin.MergePatchContentType, `{"text":"text"}`, &resp)
+	s.ErrorIs(err, ErrUnauthorized)
+
+	err = client.patchAs(0, "/api/v1/ads/0", httpgin.MergePatchContentType, `{"text":"text"}`, &resp)
+	s.NoError(err)
+	s.Equal("hello", resp.Data.Title)
+	s.Equal("text", resp.Data.Text)
+
+	err = client.patchAs(0, "/api/v1/ads/0", httpgin.MergePatchContentType, `{"title":""}`, &resp)
+	s.ErrorIs(err, ErrBadRequest, "empty title is validated")
+
+	err = client.patchAs(1, "/api/v1/ads/0", httpgin.MergePatchContentType, `{"text":"text1"}`, &resp)
+	s.ErrorIs(err, ErrForbidden)
+
+	err = client.patchAs(0, "/api/v1/ads/0", "application/json", `{}`, &resp)
+	s.NoError(err)
+	s.Equal("text", resp.Data.Text, "empty patch changes nothing")
+}
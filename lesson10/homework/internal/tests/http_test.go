@@ -58,13 +58,13 @@ func (s *HTTPSuite) TestHTTPFindUser() {
 func (s *HTTPSuite) TestHTTPDeleteUser() {
 	client := s.Client
 
-	_, err := client.deleteUser(0)
+	_, err := client.deleteUser(0, 0)
 	s.Error(err)
 
 	_, err = client.createUser("test", "user")
 	s.NoError(err)
 
-	userResponse, err := client.deleteUser(0)
+	userResponse, err := client.deleteUser(0, 0)
 	s.NoError(err)
 	s.Zero(userResponse.Data.ID)
 	s.Equal(userResponse.Data.Nickname, "test")
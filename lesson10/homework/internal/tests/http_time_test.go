@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"net/url"
+	"time"
+)
+
+func (s *HTTPSuite) TestAdTimes() {
+	client := s.Client
+
+	_, err := client.createUser("test", "user")
+	s.NoError(err)
+
+	created, err := client.createAd(0, "hello", "world")
+	s.NoError(err)
+	creationTime, err := time.Parse(time.RFC3339, created.Data.CreationTime)
+	s.NoError(err, "creation time is RFC 3339")
+	s.Equal(time.UTC, creationTime.Location(), "times are in UTC by default")
+	s.Equal(created.Data.CreationTime, created.Data.LastUpdateTime)
+
+	updated, err := client.updateAd(0, 0, "hello", "go")
+	s.NoError(err)
+	s.Equal(created.Data.CreationTime, updated.Data.CreationTime)
+	lastUpdateTime, err := time.Parse(time.RFC3339, updated.Data.LastUpdateTime)
+	s.NoError(err, "last update time is RFC 3339")
+	s.False(lastUpdateTime.Before(creationTime))
+
+	query := url.Values{"filters": {"0"}}
+	_, err = client.changeAdStatus(0, 0, true)
+	s.NoError(err)
+	resp, err := client.searchAds(query, "Asia/Tokyo")
+	s.NoError(err)
+	s.Len(resp.Data, 1)
+	localTime, err := time.Parse(time.RFC3339, resp.Data[0].CreationTime)
+	s.NoError(err)
+	_, offset := localTime.Zone()
+	s.Equal(9*60*60, offset, "times are in the requested time zone")
+	s.True(creationTime.Equal(localTime))
+
+	_, err = client.searchAds(query, "Mars/Olympus_Mons")
+	s.ErrorIs(err, ErrBadRequest)
+}
+
+func (s *HTTPSuite) TestSearchAdsByTime() {
+	client := s.Client
+
+	_, err := client.createUser("test", "user")
+	s.NoError(err)
+
+	ad, err := client.createAd(0, "hello", "world")
+	s.NoError(err)
+	_, err = client.changeAdStatus(0, 0, true)
+	s.NoError(err)
+	creationTime, err := time.Parse(time.RFC3339, ad.Data.CreationTime)
+	s.NoError(err)
+
+	tests := []struct {
+		Name   string
+		Query  url.Values
+		Expect int
+		Err    error
+	}{
+		{Name: "from creation", Query: url.Values{"created_from": {ad.Data.CreationTime}}, Expect: 1},
+		{Name: "after creation", Query: url.Values{"created_from": {creationTime.Add(time.Nanosecond).Format(time.RFC3339Nano)}}},
+		{Name: "to creation", Query: url.Values{"created_to": {ad.Data.CreationTime}}},
+		{Name: "local bounds", Query: url.Values{
+			"created_from": {creationTime.Add(-time.Hour).In(time.FixedZone("", 5*60*60)).Format(time.RFC3339Nano)},
+			"updated_to":   {creationTime.Add(time.Hour).In(time.FixedZone("", -3*60*60)).Format(time.RFC3339Nano)},
+		}, Expect: 1},
+		{Name: "not rfc 3339", Query: url.Values{"updated_from": {"08.03.2023"}}, Err: ErrBadRequest},
+	}
+
+	for _, test := range tests {
+		test.Query.Set("filters", "0")
+		resp, err := client.searchAds(test.Query, "")
+		if test.Err != nil {
+			s.ErrorIs(err, test.Err, test.Name)
+			continue
+		}
+		s.NoError(err, test.Name)
+		s.Len(resp.Data, test.Expect, test.Name)
+	}
+}
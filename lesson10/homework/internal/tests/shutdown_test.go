@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/baserepo"
+	"homework10/internal/adapters/filters"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/ads"
+	"homework10/internal/app"
+	"homework10/internal/auth"
+	"homework10/internal/lifecycle"
+	grpcPort "homework10/internal/ports/grpc"
+	"homework10/internal/ports/httpgin"
+)
+
+// slowAds makes listing ads take a while, so that requests are in-flight
+// when the service gets SIGTERM.
+type slowAds struct {
+	baserepo.Repository[*ads.Ad]
+	delay time.Duration
+}
+
+func (r slowAds) GetAll(f filters.Filters[*ads.Ad]) []*ads.Ad {
+	time.Sleep(r.delay)
+	return r.Repository.GetAll(f)
+}
+
+func TestShutdownUnderLoad(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	a := app.NewApp(slowAds{Repository: adrepo.New(), delay: 500 * time.Millisecond}, userrepo.New())
+	_, err := a.CreateUser("test", "user")
+	require.NoError(t, err)
+	_, err = a.CreateAd("hello", "world", auth.User(0))
+	require.NoError(t, err)
+	m := lifecycle.NewManager(logger, lifecycle.Options{Delay: 200 * time.Millisecond})
+
+	server := httpgin.NewHTTPServer(":18080", a, httpgin.WithLifecycle(m))
+	testServer := httptest.NewServer(server.Handler())
+	defer testServer.Close()
+	m.OnDrain("HTTP server", testServer.Config.Shutdown)
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpcPort.NewGRPCServer(logger, a, grpc.ChainUnaryInterceptor(m.UnaryServerInterceptor()))
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	m.OnDrain("GRPC server", lifecycle.StopGRPC(srv))
+	conn, err := grpc.Dial("", grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := grpcPort.NewAdServiceClient(conn)
+
+	var flushed atomic.Bool
+	m.OnFlush("repository", func() error {
+		assert.Zero(t, m.Stats().InFlight, "flushed after requests are drained")
+		flushed.Store(true)
+		return nil
+	})
+
+	// the same as in cmd/main
+	sigQuit := make(chan os.Signal, 1)
+	signal.Notify(sigQuit, syscall.SIGTERM)
+	defer signal.Stop(sigQuit)
+	shutdown := make(chan error)
+	go func() {
+		<-sigQuit
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- m.Shutdown(ctx)
+	}()
+
+	const clients = 4
+	listAds := fmt.Sprintf("%s/api/v1/ads?filters=%d", testServer.URL, app.NonPublished)
+	errs := make(chan error, 2*clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			resp, err := testServer.Client().Get(listAds)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					err = fmt.Errorf("unexpected status code: %s", resp.Status)
+				}
+			}
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := client.ListAds(context.Background(), &grpcPort.ListAdsRequest{Bitmask: app.NonPublished})
+			errs <- err
+		}()
+	}
+
+	require.Eventually(t, func() bool { return m.Stats().InFlight == 2*clients }, time.Second, time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	require.Eventually(t, func() bool { return m.State() == lifecycle.StateNotReady }, time.Second, time.Millisecond)
+	resp, err := testServer.Client().Get(testServer.URL + httpgin.ReadyPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "not ready while shutting down")
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err, "in-flight requests are finished")
+	}
+	assert.NoError(t, <-shutdown)
+	assert.True(t, flushed.Load())
+	assert.Equal(t, lifecycle.StateStopped, m.State())
+
+	_, err = client.ListAds(context.Background(), &grpcPort.ListAdsRequest{})
+	assert.Error(t, err, "no requests after shutdown")
+	_, err = testServer.Client().Get(listAds)
+	assert.Error(t, err, "no requests after shutdown")
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"homework10/internal/adapters/adrepo"
+	"homework10/internal/adapters/userrepo"
+	"homework10/internal/app"
+	"homework10/internal/ports/gateway"
+	grpcPort "homework10/internal/ports/grpc"
+	"homework10/internal/ports/httpgin"
+	"homework10/internal/tenant"
+)
+
+type TenantSuite struct {
+	suite.Suite
+	Cancel  context.CancelFunc
+	Srv     *grpc.Server
+	Conn    *grpc.ClientConn
+	V1      *httptest.Server
+	Gateway *httptest.Server
+}
+
+func (s *TenantSuite) SetupTest() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	s.Cancel = cancel
+
+	config := tenant.Config{
+		Default: "ru",
+		Tenants: map[string]tenant.Tenant{
+			"ru": {Hosts: []string{"ru.ads.test"}, Limits: app.DefaultLimits},
+			"kz": {Hosts: []string{"kz.ads.test"}, Limits: app.Limits{Title: "min:1;max:5", Text: "min:1;max:500"}},
+		},
+	}
+	tenants, err := tenant.NewRegistry(config, func(_ string, t tenant.Tenant) (app.App, error) {
+		return app.NewApp(adrepo.New(), userrepo.New(), app.WithLimits(t.Limits)), nil
+	})
+	s.Require().NoError(err)
+
+	// the GRPC server and the gin one share the tenants, so users created
+	// through one transport are seen through the other
+	server := httpgin.NewTenantHTTPServer(":18080", tenants, httpgin.WithTokens(testTokens))
+	s.V1 = httptest.NewServer(server.Handler())
+
+	lis := bufconn.Listen(1024 * 1024)
+	s.Srv = grpcPort.NewTenantGRPCServer(log.New(&bytes.Buffer{}, "", 0), tenants)
+	go func() {
+		_ = s.Srv.Serve(lis)
+	}()
+	dialer := func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	conn, err := grpc.DialContext(ctx, "", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	s.Require().NoError(err)
+	s.Conn = conn
+
+	handler, err := gateway.NewHandler(ctx, conn)
+	s.Require().NoError(err)
+	s.Gateway = httptest.NewServer(handler)
+
+	for _, id := range []string{"ru", "kz"} {
+		code, _ := s.do(s.V1.URL, id, "", call{http.MethodPost, "/api/v1/users", `{"nickname":"` + id + `","email":"test@gmail.com"}`})
+		s.Require().Equal(http.StatusOK, code)
+	}
+}
+
+func (s *TenantSuite) TearDownTest() {
+	s.Gateway.Close()
+	s.V1.Close()
+	s.Conn.Close()
+	s.Srv.Stop()
+	s.Cancel()
+}
+
+func TestTenantSuite(t *testing.T) {
+	suite.Run(t, new(TenantSuite))
+}
+
+func (s *TenantSuite) do(baseURL string, id string, host string, c call) (int, map[string]any) {
+	req, err := http.NewRequest(c.Method, baseURL+c.Path, bytes.NewBufferString(c.Body))
+	s.Require().NoError(err)
+	req.Header.Add("Content-Type", "application/json")
+	if id != "" {
+		req.Header.Add(tenant.Header, id)
+		// tokens are issued per tenant, the first user of the named one acts
+		token, err := testTokens.Issue(id, 0, time.Hour)
+		s.Require().NoError(err)
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	if host != "" {
+		req.Host = host
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	var body map[string]any
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func (s *TenantSuite) TestResolution() {
+	tests := []struct {
+		Name     string
+		ID       string
+		Host     string
+		Code     int
+		Nickname string
+	}{
+		{Name: "header", ID: "kz", Code: http.StatusOK, Nickname: "kz"},
+		{Name: "header of the host", ID: "kz", Host: "kz.ads.test", Code: http.StatusOK, Nickname: "kz"},
+		{Name: "header of another host", ID: "ru", Host: "kz.ads.test", Code: http.StatusBadRequest},
+		{Name: "host", Host: "KZ.ads.test:18080", Code: http.StatusOK, Nickname: "kz"},
+		{Name: "default", Code: http.StatusOK, Nickname: "ru"},
+		{Name: "unknown tenant", ID: "by", Code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		code, body := s.do(s.V1.URL, test.ID, test.Host, call{http.MethodGet, "/api/v1/users/0", ""})
+		s.Equal(test.Code, code, test.Name)
+		if test.Code == http.StatusOK {
+			s.Equal(test.Nickname, body["data"].(map[string]any)["nickname"], test.Name)
+		}
+
+		code, body = s.do(s.Gateway.URL, test.ID, test.Host, call{http.MethodGet, "/api/v2/users/0", ""})
+		s.Equal(test.Code, code, "gateway: "+test.Name)
+		if test.Code == http.StatusOK {
+			s.Equal(test.Nickname, body["nickname"], "gateway: "+test.Name)
+		}
+	}
+}
+
+func (s *TenantSuite) TestIsolation() {
+	code, _ := s.do(s.V1.URL, "kz", "", call{http.MethodPost, "/api/v1/ads", `{"title":"kz advert","text":"text"}`})
+	s.Require().NotEqual(http.StatusOK, code, "kz titles are up to 5 characters")
+	code, _ = s.do(s.V1.URL, "kz", "", call{http.MethodPost, "/api/v1/ads", `{"title":"kz","text":"text"}`})
+	s.Require().Equal(http.StatusOK, code)
+	code, _ = s.do(s.V1.URL, "kz", "", call{http.MethodPut, "/api/v1/ads/0/status", `{"published":true}`})
+	s.Require().Equal(http.StatusOK, code)
+
+	code, body := s.do(s.V1.URL, "kz", "", call{http.MethodGet, "/api/v1/ads?filters=0", ""})
+	s.Equal(http.StatusOK, code)
+	s.Len(body["data"], 1)
+
+	code, body = s.do(s.V1.URL, "ru", "", call{http.MethodGet, "/api/v1/ads?filters=0", ""})
+	s.Equal(http.StatusOK, code)
+	s.Len(body["data"], 0)
+	code, _ = s.do(s.V1.URL, "ru", "", call{http.MethodGet, "/api/v1/ads/0", ""})
+	s.NotEqual(http.StatusOK, code)
+	code, _ = s.do(s.V1.URL, "ru", "", call{http.MethodPost, "/api/v1/ads", `{"title":"ru ad is longer","text":"text"}`})
+	s.Equal(http.StatusOK, code)
+}
+
+func (s *TenantSuite) TestGRPCMetadata() {
+	client := grpcPort.NewAdServiceClient(s.Conn)
+
+	tests := []struct {
+		ID       string
+		Code     codes.Code
+		Nickname string
+	}{
+		{ID: "kz", Code: codes.OK, Nickname: "kz"},
+		{ID: "", Code: codes.OK, Nickname: "ru"},
+		{ID: "by", Code: codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.ID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, tenant.MetadataKey, test.ID)
+		}
+		user, err := client.GetUser(ctx, &grpcPort.GetUserRequest{Id: 0})
+		s.Equal(test.Code, status.Code(err), test.ID)
+		if test.Code == codes.OK {
+			s.Equal(test.Nickname, user.Nickname, test.ID)
+		}
+	}
+}
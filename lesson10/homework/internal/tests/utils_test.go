@@ -9,10 +9,13 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"homework10/internal/adapters/adrepo"
 	"homework10/internal/app"
+	"homework10/internal/auth"
 	"homework10/internal/ports/httpgin"
 )
 
@@ -20,6 +23,8 @@ type userData struct {
 	ID       int64  `json:"id"`
 	Nickname string `json:"nickname"`
 	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Blocked  bool   `json:"blocked"`
 }
 
 type userResponse struct {
@@ -27,11 +32,13 @@ type userResponse struct {
 }
 
 type adData struct {
-	ID        int64  `json:"id"`
-	Title     string `json:"title"`
-	Text      string `json:"text"`
-	AuthorID  int64  `json:"author_id"`
-	Published bool   `json:"published"`
+	ID             int64  `json:"id"`
+	Title          string `json:"title"`
+	Text           string `json:"text"`
+	AuthorID       int64  `json:"author_id"`
+	Published      bool   `json:"published"`
+	CreationTime   string `json:"creation_time"`
+	LastUpdateTime string `json:"last_update_time"`
 }
 
 type adResponse struct {
@@ -43,22 +50,53 @@ type adsResponse struct {
 }
 
 var (
-	ErrBadRequest = fmt.Errorf("bad request")
-	ErrForbidden  = fmt.Errorf("forbidden")
+	ErrBadRequest   = fmt.Errorf("bad request")
+	ErrUnauthorized = fmt.Errorf("unauthorized")
+	ErrForbidden    = fmt.Errorf("forbidden")
+	ErrMediaType    = fmt.Errorf("unsupported media type")
 )
 
+// testTokens are the tokens the servers of the tests accept.
+var testTokens = func() *auth.Tokens {
+	tokens, err := auth.NewTokens([]byte("secret of the tests, 32 bytes ok"))
+	if err != nil {
+		panic(err)
+	}
+	return tokens
+}()
+
+// bearer is the Authorization header of the user with userID.
+func bearer(userID int64) string {
+	token, err := testTokens.Issue("", userID, time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	return "Bearer " + token
+}
+
+// anonymous is the actor of requests without a token.
+const anonymous = -1
+
 type testClient struct {
 	client  *http.Client
 	baseURL string
 }
 
+// authorize makes req on behalf of the user with actorID.
+func authorize(req *http.Request, actorID int64) {
+	if actorID != anonymous {
+		req.Header.Set("Authorization", bearer(actorID))
+	}
+}
+
 type HTTPSuite struct {
 	suite.Suite
 	Client *testClient
 }
 
 func (s *HTTPSuite) SetupTest() {
-	server := httpgin.NewHTTPServer(":18080", app.NewApp(adrepo.New(), userrepo.New()))
+	server := httpgin.NewHTTPServer(":18080", app.NewApp(adrepo.New(), userrepo.New(), app.WithAdmins(0)),
+		httpgin.WithTokens(testTokens))
 	testServer := httptest.NewServer(server.Handler())
 
 	s.Client = &testClient{
@@ -81,9 +119,15 @@ func (tc *testClient) getResponse(req *http.Request, out any) error {
 		if resp.StatusCode == http.StatusBadRequest {
 			return ErrBadRequest
 		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			return ErrUnauthorized
+		}
 		if resp.StatusCode == http.StatusForbidden {
 			return ErrForbidden
 		}
+		if resp.StatusCode == http.StatusUnsupportedMediaType {
+			return ErrMediaType
+		}
 		return fmt.Errorf("unexpected status code: %s", resp.Status)
 	}
 
@@ -161,6 +205,7 @@ func (tc *testClient) updateUser(userID int64, nickname string, email string) (u
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, userID)
 
 	var response userResponse
 	err = tc.getResponse(req, &response)
@@ -188,7 +233,7 @@ func (tc *testClient) findUser(nickname string) (userResponse, error) {
 	return response, nil
 }
 
-func (tc *testClient) deleteUser(userID int64) (userResponse, error) {
+func (tc *testClient) deleteUser(userID int64, actorID int64) (userResponse, error) {
 	body := map[string]any{
 		"user_id": userID,
 	}
@@ -204,6 +249,7 @@ func (tc *testClient) deleteUser(userID int64) (userResponse, error) {
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, actorID)
 
 	var response userResponse
 	err = tc.getResponse(req, &response)
@@ -231,9 +277,8 @@ func (tc *testClient) listAds(filters int64) (adsResponse, error) {
 
 func (tc *testClient) createAd(userID int64, title string, text string) (adResponse, error) {
 	body := map[string]any{
-		"user_id": userID,
-		"title":   title,
-		"text":    text,
+		"title": title,
+		"text":  text,
 	}
 
 	data, err := json.Marshal(body)
@@ -247,6 +292,7 @@ func (tc *testClient) createAd(userID int64, title string, text string) (adRespo
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, userID)
 
 	var response adResponse
 	err = tc.getResponse(req, &response)
@@ -259,7 +305,6 @@ func (tc *testClient) createAd(userID int64, title string, text string) (adRespo
 
 func (tc *testClient) changeAdStatus(userID int64, adID int64, published bool) (adResponse, error) {
 	body := map[string]any{
-		"user_id":   userID,
 		"published": published,
 	}
 
@@ -274,6 +319,7 @@ func (tc *testClient) changeAdStatus(userID int64, adID int64, published bool) (
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, userID)
 
 	var response adResponse
 	err = tc.getResponse(req, &response)
@@ -303,9 +349,8 @@ func (tc *testClient) getAd(adID int64) (adResponse, error) {
 
 func (tc *testClient) updateAd(userID int64, adID int64, title string, text string) (adResponse, error) {
 	body := map[string]any{
-		"user_id": userID,
-		"title":   title,
-		"text":    text,
+		"title": title,
+		"text":  text,
 	}
 
 	data, err := json.Marshal(body)
@@ -319,6 +364,7 @@ func (tc *testClient) updateAd(userID int64, adID int64, title string, text stri
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, userID)
 
 	var response adResponse
 	err = tc.getResponse(req, &response)
@@ -348,8 +394,7 @@ func (tc *testClient) findAd(title string) (adResponse, error) {
 
 func (tc *testClient) deleteAd(adID int64, userID int64) (adResponse, error) {
 	body := map[string]any{
-		"ad_id":   adID,
-		"user_id": userID,
+		"ad_id": adID,
 	}
 
 	data, err := json.Marshal(body)
@@ -363,6 +408,78 @@ func (tc *testClient) deleteAd(adID int64, userID int64) (adResponse, error) {
 	}
 
 	req.Header.Add("Content-Type", "application/json")
+	authorize(req, userID)
+
+	var response adResponse
+	err = tc.getResponse(req, &response)
+	if err != nil {
+		return adResponse{}, err
+	}
+
+	return response, nil
+}
+
+func (tc *testClient) blockUser(userID int64, actorID int64, blocked bool) (userResponse, error) {
+	body := map[string]any{
+		"blocked": blocked,
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return userResponse{}, fmt.Errorf("unable to marshal: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(tc.baseURL+"/api/v1/admin/users/%d/block", userID), bytes.NewReader(data))
+	if err != nil {
+		return userResponse{}, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	authorize(req, actorID)
+
+	var response userResponse
+	err = tc.getResponse(req, &response)
+	if err != nil {
+		return userResponse{}, err
+	}
+
+	return response, nil
+}
+
+func (tc *testClient) setUserRole(userID int64, actorID int64, role string) (userResponse, error) {
+	body := map[string]any{
+		"role": role,
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return userResponse{}, fmt.Errorf("unable to marshal: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(tc.baseURL+"/api/v1/admin/users/%d/role", userID), bytes.NewReader(data))
+	if err != nil {
+		return userResponse{}, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	authorize(req, actorID)
+
+	var response userResponse
+	err = tc.getResponse(req, &response)
+	if err != nil {
+		return userResponse{}, err
+	}
+
+	return response, nil
+}
+
+func (tc *testClient) unpublishAd(adID int64, actorID int64) (adResponse, error) {
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(tc.baseURL+"/api/v1/admin/ads/%d/unpublish", adID), nil)
+	if err != nil {
+		return adResponse{}, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	authorize(req, actorID)
 
 	var response adResponse
 	err = tc.getResponse(req, &response)
@@ -372,3 +489,63 @@ func (tc *testClient) deleteAd(adID int64, userID int64) (adResponse, error) {
 
 	return response, nil
 }
+
+func (tc *testClient) patch(path string, contentType string, body string, out any) error {
+	return tc.patchAs(anonymous, path, contentType, body, out)
+}
+
+func (tc *testClient) patchAs(actorID int64, path string, contentType string, body string, out any) error {
+	req, err := http.NewRequest(http.MethodPatch, tc.baseURL+path, bytes.NewBufferString(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", contentType)
+	authorize(req, actorID)
+
+	return tc.getResponse(req, out)
+}
+
+func (tc *testClient) searchAds(query url.Values, timezone string) (adsResponse, error) {
+	req, err := http.NewRequest(http.MethodGet, tc.baseURL+"/api/v1/ads?"+query.Encode(), nil)
+	if err != nil {
+		return adsResponse{}, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	if timezone != "" {
+		req.Header.Add(httpgin.TimezoneHeader, timezone)
+	}
+
+	var response adsResponse
+	err = tc.getResponse(req, &response)
+	if err != nil {
+		return adsResponse{}, err
+	}
+
+	return response, nil
+}
+
+// do sends a request as is and reads the body as is, e.g. still compressed.
+func (tc *testClient) do(method string, path string, header http.Header, body io.Reader) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, tc.baseURL+path, body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := tc.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unexpected error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	return resp, respBody, nil
+}
@@ -0,0 +1,48 @@
+package tlsconfig
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ClientCredentials are GRPC credentials that build the client config per
+// connection, so that reconnects of a long-lived client conn verify the
+// server against the CA and present the certificate loaded at the time.
+func (r *Reloader) ClientCredentials() credentials.TransportCredentials {
+	return &clientCredentials{
+		TransportCredentials: credentials.NewTLS(r.ClientConfig()),
+		reloader:             r,
+	}
+}
+
+type clientCredentials struct {
+	credentials.TransportCredentials
+	reloader   *Reloader
+	serverName string
+}
+
+func (c *clientCredentials) current() credentials.TransportCredentials {
+	config := c.reloader.ClientConfig()
+	config.ServerName = c.serverName
+	return credentials.NewTLS(config)
+}
+
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ClientHandshake(ctx, authority, conn)
+}
+
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	return &clientCredentials{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		reloader:             c.reloader,
+		serverName:           c.serverName,
+	}
+}
+
+// OverrideServerName is deprecated in GRPC but still a part of the interface.
+func (c *clientCredentials) OverrideServerName(serverName string) error {
+	c.serverName = serverName
+	return c.TransportCredentials.OverrideServerName(serverName)
+}
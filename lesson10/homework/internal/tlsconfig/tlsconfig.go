@@ -0,0 +1,222 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificates = errors.New("no certificates in CA file")
+
+// Files are PEM encoded. CAFile verifies the other side of the connection:
+// client certificates on a server and the server certificate on a client.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader keeps the certificate and CA pool loaded from Files and swaps
+// them when the files change, so rotated certificates are picked up by new
+// connections without a restart. Established connections are not affected.
+type Reloader struct {
+	files Files
+	mutex *sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+	// pinned trusts only cert, clients use it when there is no CA file
+	pinned *x509.CertPool
+	stamps []fileStamp
+}
+
+func NewReloader(files Files) (*Reloader, error) {
+	r := &Reloader{
+		files: files,
+		mutex: &sync.RWMutex{},
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) paths() []string {
+	paths := make([]string, 0, 3)
+	for _, path := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (r *Reloader) stat() ([]fileStamp, error) {
+	stamps := make([]fileStamp, 0, 3)
+	for _, path := range r.paths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, fileStamp{modTime: info.ModTime(), size: info.Size()})
+	}
+	return stamps, nil
+}
+
+// Reload reads the files again. On error the previously loaded
+// certificate and pool stay in use.
+func (r *Reloader) Reload() error {
+	stamps, err := r.stat()
+	if err != nil {
+		return fmt.Errorf("can't stat certificates: %w", err)
+	}
+
+	var cert *tls.Certificate
+	var pinned *x509.CertPool
+	if r.files.CertFile != "" || r.files.KeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("can't load key pair: %w", err)
+		}
+		leaf, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("can't parse certificate: %w", err)
+		}
+		cert = &pair
+		pinned = x509.NewCertPool()
+		pinned.AddCert(leaf)
+	}
+
+	var pool *x509.CertPool
+	if r.files.CAFile != "" {
+		data, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return fmt.Errorf("can't read CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%w: %s", ErrNoCertificates, r.files.CAFile)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert = cert
+	r.pool = pool
+	r.pinned = pinned
+	r.stamps = stamps
+	return nil
+}
+
+func (r *Reloader) changed() bool {
+	stamps, err := r.stat()
+	if err != nil {
+		// a file is being replaced right now, look again on the next tick
+		return false
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if len(stamps) != len(r.stamps) {
+		return true
+	}
+	for i := range stamps {
+		if !stamps[i].modTime.Equal(r.stamps[i].modTime) || stamps[i].size != r.stamps[i].size {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the files every interval and reloads them when they change
+// until ctx is done. A failed reload, e.g. when the key is already rotated
+// but the certificate is not yet, is reported to onError and retried on the
+// next tick.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert
+}
+
+func (r *Reloader) CertPool() *x509.CertPool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.pool
+}
+
+// ServerConfig serves the current certificate. With requireClientCert the
+// client has to present a certificate signed by the CA from CAFile.
+func (r *Reloader) ServerConfig(requireClientCert bool) *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}
+	if !requireClientCert {
+		return base
+	}
+	// the pool is swapped on reload, so the config is built per handshake
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = r.CertPool()
+		return config, nil
+	}
+	return base
+}
+
+// ClientConfig presents the current certificate, if there is one, and
+// verifies the server against the CA from CAFile as loaded at the time of
+// the call. Without CAFile the server has to present the current
+// certificate itself, e.g. when a process calls its own listener, and
+// without a certificate either the system roots are used. Clients that
+// outlive a rotation build a config per connection, see ClientCredentials.
+func (r *Reloader) ClientConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    r.rootCAs(),
+	}
+	if r.Certificate() != nil {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		}
+	}
+	return config
+}
+
+func (r *Reloader) rootCAs() *x509.CertPool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.pool != nil || r.cert == nil {
+		return r.pool
+	}
+	return r.pinned
+}
@@ -0,0 +1,253 @@
+package tlsconfig_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework10/internal/tlsconfig"
+	"homework10/internal/tlsconfig/tlstest"
+)
+
+// handshake connects client to server over loopback and returns the common
+// name of the server certificate. Errors from both sides are reported,
+// since with TLS 1.3 a rejected client certificate fails only the server.
+func handshake(t *testing.T, server *tls.Config, client *tls.Config) (string, error) {
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	assert.NoError(t, err)
+	defer lis.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- conn.(*tls.Conn).Handshake()
+	}()
+
+	client = client.Clone()
+	client.ServerName = "localhost"
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err != nil {
+		<-serverErr
+		return "", err
+	}
+	defer conn.Close()
+	if err = <-serverErr; err != nil {
+		return "", err
+	}
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func newReloader(t *testing.T, files tlsconfig.Files) *tlsconfig.Reloader {
+	reloader, err := tlsconfig.NewReloader(files)
+	assert.NoError(t, err)
+	return reloader
+}
+
+// replace swaps dst for a copy of src the way rotation tools do: the new
+// file is written aside and renamed over the old one.
+func replace(t *testing.T, src string, dst string) {
+	data, err := os.ReadFile(src)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(dst+".tmp", data, 0o600))
+	assert.NoError(t, os.Rename(dst+".tmp", dst))
+}
+
+func TestServerConfig(t *testing.T) {
+	ca := tlstest.NewCA(t, "ca")
+	server := ca.Issue(t, t.TempDir(), "server")
+	other := tlstest.NewCA(t, "other").Issue(t, t.TempDir(), "client")
+
+	config := newReloader(t, server).ServerConfig(false)
+
+	name, err := handshake(t, config, newReloader(t, tlsconfig.Files{CAFile: server.CAFile}).ClientConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "server", name)
+
+	_, err = handshake(t, config, newReloader(t, tlsconfig.Files{CAFile: other.CAFile}).ClientConfig())
+	assert.Error(t, err, "server certificate from an unknown CA")
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := tlstest.NewCA(t, "ca")
+	server := ca.Issue(t, t.TempDir(), "server")
+	config := newReloader(t, server).ServerConfig(true)
+
+	tests := []struct {
+		Name   string
+		Client tlsconfig.Files
+		Err    bool
+	}{
+		{
+			Name:   "no client certificate",
+			Client: tlsconfig.Files{CAFile: server.CAFile},
+			Err:    true,
+		},
+		{
+			Name: "client certificate from an unknown CA",
+			Client: func() tlsconfig.Files {
+				files := tlstest.NewCA(t, "other").Issue(t, t.TempDir(), "client")
+				files.CAFile = server.CAFile
+				return files
+			}(),
+			Err: true,
+		},
+		{
+			Name:   "valid client certificate",
+			Client: ca.Issue(t, t.TempDir(), "client"),
+		},
+	}
+
+	for _, test := range tests {
+		_, err := handshake(t, config, newReloader(t, test.Client).ClientConfig())
+		if test.Err {
+			assert.Error(t, err, test.Name)
+		} else {
+			assert.NoError(t, err, test.Name)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	ca := tlstest.NewCA(t, "ca")
+	server := ca.Issue(t, t.TempDir(), "server")
+	reloader := newReloader(t, server)
+	config := reloader.ServerConfig(true)
+
+	client := ca.Issue(t, t.TempDir(), "client")
+	clientConfig := newReloader(t, client).ClientConfig()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var failures int64
+	done := make(chan struct{})
+	go func() {
+		reloader.Watch(ctx, 10*time.Millisecond, func(error) {
+			atomic.AddInt64(&failures, 1)
+		})
+		close(done)
+	}()
+
+	// a half-done rotation keeps the old certificate in use
+	assert.NoError(t, os.WriteFile(server.KeyFile, []byte("garbage"), 0o600))
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&failures) > 0 }, time.Second, 10*time.Millisecond)
+	name, err := handshake(t, config, clientConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "server", name)
+
+	rotated := ca.Issue(t, t.TempDir(), "rotated")
+	replace(t, rotated.CertFile, server.CertFile)
+	replace(t, rotated.KeyFile, server.KeyFile)
+	assert.Eventually(t, func() bool {
+		name, err := handshake(t, config, clientConfig)
+		return err == nil && name == "rotated"
+	}, time.Second, 10*time.Millisecond)
+
+	// clients of a new CA are accepted once the CA file is rotated, the
+	// old ones are not
+	newCA := tlstest.NewCA(t, "new ca")
+	newClient := newCA.Issue(t, t.TempDir(), "client")
+	// the server certificate is still signed by the old CA
+	newClient.CAFile = client.CAFile
+	newCAFile := filepath.Join(t.TempDir(), "ca.crt")
+	newCA.WriteCA(t, newCAFile)
+	replace(t, newCAFile, server.CAFile)
+	assert.Eventually(t, func() bool {
+		_, err := handshake(t, config, newReloader(t, newClient).ClientConfig())
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	_, err = handshake(t, config, clientConfig)
+	assert.Error(t, err)
+
+	cancel()
+	<-done
+}
+
+func TestClientConfigWithoutCA(t *testing.T) {
+	ca := tlstest.NewCA(t, "ca")
+	server := ca.Issue(t, t.TempDir(), "server")
+	config := newReloader(t, server).ServerConfig(false)
+
+	// a process calling its own listener trusts its own certificate
+	self := server
+	self.CAFile = ""
+	name, err := handshake(t, config, newReloader(t, self).ClientConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, "server", name)
+
+	// and only it, whoever the issuer is
+	other := ca.Issue(t, t.TempDir(), "other")
+	other.CAFile = ""
+	_, err = handshake(t, config, newReloader(t, other).ClientConfig())
+	assert.Error(t, err, "server certificate other than the own one")
+}
+
+func TestClientCredentials(t *testing.T) {
+	ca := tlstest.NewCA(t, "ca")
+	server := ca.Issue(t, t.TempDir(), "server")
+	serverReloader := newReloader(t, server)
+	config := serverReloader.ServerConfig(true)
+
+	client := ca.Issue(t, t.TempDir(), "client")
+	clientReloader := newReloader(t, client)
+	creds := clientReloader.ClientCredentials()
+
+	connect := func() error {
+		lis, err := tls.Listen("tcp", "127.0.0.1:0", config)
+		assert.NoError(t, err)
+		defer lis.Close()
+		serverErr := make(chan error, 1)
+		go func() {
+			conn, err := lis.Accept()
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			defer conn.Close()
+			serverErr <- conn.(*tls.Conn).Handshake()
+		}()
+
+		conn, err := net.Dial("tcp", lis.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		secure, _, err := creds.ClientHandshake(context.Background(), "localhost", conn)
+		if err != nil {
+			<-serverErr
+			return err
+		}
+		defer secure.Close()
+		return <-serverErr
+	}
+	assert.NoError(t, connect())
+
+	// both sides move to a new CA, the same credentials follow it
+	newCA := tlstest.NewCA(t, "new ca")
+	newServer := newCA.Issue(t, t.TempDir(), "server")
+	newClient := newCA.Issue(t, t.TempDir(), "client")
+	for _, rotation := range []struct{ Src, Dst string }{
+		{newServer.CertFile, server.CertFile},
+		{newServer.KeyFile, server.KeyFile},
+		{newServer.CAFile, server.CAFile},
+		{newClient.CertFile, client.CertFile},
+		{newClient.KeyFile, client.KeyFile},
+	} {
+		replace(t, rotation.Src, rotation.Dst)
+	}
+	assert.NoError(t, serverReloader.Reload())
+	assert.Error(t, connect(), "the client still trusts the old CA only")
+
+	replace(t, newClient.CAFile, client.CAFile)
+	assert.NoError(t, clientReloader.Reload())
+	assert.NoError(t, connect())
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// InvalidPolicy tells what to do with bytes that are invalid in the input
+// charset and runes that the output charset can't encode.
+type InvalidPolicy int
+
+const (
+	InvalidReplace InvalidPolicy = iota
+	InvalidSkip
+	InvalidFail
+)
+
+var invalidPolicies = map[string]InvalidPolicy{
+	"replace": InvalidReplace,
+	"skip":    InvalidSkip,
+	"fail":    InvalidFail,
+}
+
+func ParseInvalidPolicy(s string) (InvalidPolicy, error) {
+	policy, ok := invalidPolicies[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown invalid policy %q, expected replace, skip or fail", s)
+	}
+	return policy, nil
+}
+
+var ErrInvalidInput = errors.New("invalid input")
+
+type Charset interface {
+	// decode returns the first rune of bs and the number of its bytes.
+	// size 0 means bs is the beginning of a longer sequence.
+	decode(bs []byte) (r rune, size int, valid bool)
+	encode(bs []byte, r rune) ([]byte, bool)
+	// replacement is the rune invalid input is replaced with
+	replacement() rune
+}
+
+type utf8Charset struct{}
+
+func (utf8Charset) decode(bs []byte) (rune, int, bool) {
+	if !utf8.FullRune(bs) {
+		return 0, 0, true
+	}
+	r, size := utf8.DecodeRune(bs)
+	return r, size, r != utf8.RuneError || size > 1
+}
+
+func (utf8Charset) encode(bs []byte, r rune) ([]byte, bool) {
+	return utf8.AppendRune(bs, r), true
+}
+
+func (utf8Charset) replacement() rune {
+	return utf8.RuneError
+}
+
+type utf16Charset struct {
+	order binary.ByteOrder
+}
+
+func (c utf16Charset) decode(bs []byte) (rune, int, bool) {
+	if len(bs) < 2 {
+		return 0, 0, true
+	}
+	r := rune(c.order.Uint16(bs))
+	if !utf16.IsSurrogate(r) {
+		return r, 2, true
+	}
+	if len(bs) < 4 {
+		return 0, 0, true
+	}
+	pair := utf16.DecodeRune(r, rune(c.order.Uint16(bs[2:])))
+	if pair == utf8.RuneError {
+		// a lone surrogate, the next unit is decoded on its own
+		return r, 2, false
+	}
+	return pair, 4, true
+}
+
+func (c utf16Charset) encode(bs []byte, r rune) ([]byte, bool) {
+	if !utf8.ValidRune(r) {
+		return bs, false
+	}
+	var unit [2]byte
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		c.order.PutUint16(unit[:], uint16(r1))
+		bs = append(bs, unit[:]...)
+		r = r2
+	}
+	c.order.PutUint16(unit[:], uint16(r))
+	return append(bs, unit[:]...), true
+}
+
+func (utf16Charset) replacement() rune {
+	return utf8.RuneError
+}
+
+// singleByteCharset takes its tables from x/text, undefined bytes are
+// decoded as utf8.RuneError there.
+type singleByteCharset struct {
+	charmap *charmap.Charmap
+}
+
+func (c singleByteCharset) decode(bs []byte) (rune, int, bool) {
+	r := c.charmap.DecodeByte(bs[0])
+	return r, 1, r != utf8.RuneError
+}
+
+func (c singleByteCharset) encode(bs []byte, r rune) ([]byte, bool) {
+	b, ok := c.charmap.EncodeRune(r)
+	if !ok {
+		return bs, false
+	}
+	return append(bs, b), true
+}
+
+func (singleByteCharset) replacement() rune {
+	return '?'
+}
+
+var charsets = map[string]Charset{
+	"utf-8":        utf8Charset{},
+	"utf8":         utf8Charset{},
+	"utf-16le":     utf16Charset{order: binary.LittleEndian},
+	"utf-16be":     utf16Charset{order: binary.BigEndian},
+	"cp1251":       singleByteCharset{charmap: charmap.Windows1251},
+	"windows-1251": singleByteCharset{charmap: charmap.Windows1251},
+	"koi8-r":       singleByteCharset{charmap: charmap.KOI8R},
+	"latin1":       singleByteCharset{charmap: charmap.ISO8859_1},
+	"iso-8859-1":   singleByteCharset{charmap: charmap.ISO8859_1},
+}
+
+func ParseCharset(name string) (Charset, error) {
+	charset, ok := charsets[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown charset %q", name)
+	}
+	return charset, nil
+}
+
+// CharsetTransformer converts text from one charset to another. Sequences
+// split between blocks are kept in state until the rest of them comes.
+type CharsetTransformer struct {
+	state  ParseState
+	from   Charset
+	to     Charset
+	policy InvalidPolicy
+	// offset is the number of input bytes converted, for errors
+	offset int
+}
+
+func (transformer *CharsetTransformer) Transform(bs []byte) ([]byte, error) {
+	allBytes := transformer.state.GetAllBytes(bs)
+	result := make([]byte, 0, len(allBytes))
+	for len(allBytes) > 0 {
+		r, size, valid := transformer.from.decode(allBytes)
+		if size == 0 {
+			break
+		}
+		var err error
+		result, err = transformer.convert(result, r, size, valid)
+		if err != nil {
+			return result, err
+		}
+		allBytes = allBytes[size:]
+	}
+	transformer.state.restBytes = append([]byte(nil), allBytes...)
+	return result, nil
+}
+
+// Flush handles a sequence the input ends in the middle of.
+func (transformer *CharsetTransformer) Flush() ([]byte, error) {
+	rest := transformer.state.Flush()
+	if len(rest) == 0 {
+		return nil, nil
+	}
+	return transformer.convert(nil, 0, len(rest), false)
+}
+
+type charsetState struct {
+	Rest   []byte `json:"rest"`
+	Offset int    `json:"offset"`
+}
+
+func (transformer *CharsetTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(charsetState{Rest: transformer.state.restBytes, Offset: transformer.offset})
+}
+
+func (transformer *CharsetTransformer) LoadState(state []byte) error {
+	var loaded charsetState
+	if err := json.Unmarshal(state, &loaded); err != nil {
+		return err
+	}
+	transformer.state.restBytes, transformer.offset = loaded.Rest, loaded.Offset
+	return nil
+}
+
+func (transformer *CharsetTransformer) convert(bs []byte, r rune, size int, valid bool) ([]byte, error) {
+	offset := transformer.offset
+	transformer.offset += size
+	if !valid {
+		switch transformer.policy {
+		case InvalidSkip:
+			return bs, nil
+		case InvalidFail:
+			return bs, fmt.Errorf("%w: can't decode byte %d", ErrInvalidInput, offset)
+		}
+		r = transformer.to.replacement()
+	}
+
+	result, ok := transformer.to.encode(bs, r)
+	if ok {
+		return result, nil
+	}
+	switch transformer.policy {
+	case InvalidSkip:
+		return bs, nil
+	case InvalidFail:
+		return bs, fmt.Errorf("%w: can't encode %q from byte %d", ErrInvalidInput, r, offset)
+	}
+	result, _ = transformer.to.encode(bs, transformer.to.replacement())
+	return result, nil
+}
+
+func NewCharsetTransformer(from Charset, to Charset, policy InvalidPolicy) *CharsetTransformer {
+	return &CharsetTransformer{
+		from:   from,
+		to:     to,
+		policy: policy,
+	}
+}
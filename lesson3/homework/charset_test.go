@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCharsets(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	// "Привет, мир!" in every charset
+	hello := "Привет, мир!"
+	encoded := map[string]string{
+		"cp1251":   "\xcf\xf0\xe8\xe2\xe5\xf2, \xec\xe8\xf0!",
+		"koi8-r":   "\xf0\xd2\xc9\xd7\xc5\xd4, \xcd\xc9\xd2!",
+		"utf-16le": "\x1f\x04\x40\x04\x38\x04\x32\x04\x35\x04\x42\x04,\x00 \x00\x3c\x04\x38\x04\x40\x04!\x00",
+		"utf-16be": "\x04\x1f\x04\x40\x04\x38\x04\x32\x04\x35\x04\x42\x00,\x00 \x04\x3c\x04\x38\x04\x40\x00!",
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		input  string
+		output string
+		err    bool
+	}{
+		{name: "cp1251 to utf-8", args: []string{"-from-charset", "cp1251"}, input: encoded["cp1251"], output: hello},
+		{name: "koi8-r to utf-8", args: []string{"-from-charset", "KOI8-R"}, input: encoded["koi8-r"], output: hello},
+		{name: "utf-16le to utf-8", args: []string{"-from-charset", "utf-16le"}, input: encoded["utf-16le"], output: hello},
+		{name: "utf-16be to utf-8", args: []string{"-from-charset", "utf-16be"}, input: encoded["utf-16be"], output: hello},
+		{name: "utf-8 to cp1251", args: []string{"-to-charset", "windows-1251"}, input: hello, output: encoded["cp1251"]},
+		{name: "cp1251 to koi8-r", args: []string{"-from-charset", "cp1251", "-to-charset", "koi8-r"}, input: encoded["cp1251"], output: encoded["koi8-r"]},
+		{name: "koi8-r to utf-16le", args: []string{"-from-charset", "koi8-r", "-to-charset", "utf-16le"}, input: encoded["koi8-r"], output: encoded["utf-16le"]},
+		{name: "surrogate pair", args: []string{"-from-charset", "utf-16le"}, input: "\x3d\xd8\x0a\xde", output: "😊"},
+		{name: "conversions between charsets", args: []string{"-from-charset", "cp1251", "-to-charset", "cp1251", "-conv", "upper_case"}, input: encoded["cp1251"], output: "\xcf\xd0\xc8\xc2\xc5\xd2, \xcc\xc8\xd0!"},
+		{name: "latin1 to utf-8", args: []string{"-from-charset", "latin1"}, input: "caf\xe9", output: "café"},
+		{name: "invalid byte replaced", args: []string{"-from-charset", "cp1251"}, input: "a\x98b", output: "a�b"},
+		{name: "invalid byte skipped", args: []string{"-from-charset", "utf-8", "-invalid", "skip"}, input: "a\xffb", output: "ab"},
+		{name: "invalid byte fails", args: []string{"-from-charset", "utf-8", "-invalid", "fail"}, input: "a\xffb", err: true},
+		{name: "unencodable replaced", args: []string{"-to-charset", "latin1"}, input: "café ❤", output: "caf\xe9 ?"},
+		{name: "unencodable fails", args: []string{"-to-charset", "koi8-r", "-invalid", "fail"}, input: "❤", err: true},
+		{name: "truncated sequence replaced", args: []string{"-from-charset", "utf-16le"}, input: "a\x00b", output: "a�"},
+		{name: "truncated sequence fails", args: []string{"-from-charset", "utf-8", "-invalid", "fail"}, input: "a\xd0", err: true},
+		{name: "unknown charset", args: []string{"-from-charset", "cp866"}, input: hello, err: true},
+		{name: "unknown policy", args: []string{"-from-charset", "cp1251", "-invalid", "ignore"}, input: hello, err: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		// sequences are split between blocks at every block size
+		for _, blockSize := range []int{1, 2, 3, 1024} {
+			t.Run(test.name+" with block-size "+strconv.Itoa(blockSize), func(t *testing.T) {
+				cmd = exec.Command(binPath, append(test.args, "-block-size", strconv.Itoa(blockSize))...)
+				cmd.Stdin = strings.NewReader(test.input)
+				stdout := &strings.Builder{}
+				cmd.Stdout = stdout
+				stderr := &strings.Builder{}
+				cmd.Stderr = stderr
+
+				err := cmd.Run()
+
+				if test.err {
+					assert.Error(t, err)
+					assert.NotZero(t, stderr.Len())
+					return
+				}
+				assert.NoError(t, err)
+				assert.Zero(t, stderr.Len(), stderr.String())
+				assert.Equal(t, test.output, stdout.String())
+			})
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Checkpoint is a consistent state of a copy: the input is read up to Input,
+// the output is written up to Output, and the bytes in between are held by
+// the transformers and the output block.
+type Checkpoint struct {
+	// Options the copy was started with, it can be resumed only with the same
+	Options       Options           `json:"options"`
+	Input         int64             `json:"input"`
+	Output        int64             `json:"output"`
+	Transformers  json.RawMessage   `json:"transformers"`
+	Block         []byte            `json:"block"`
+	InputDigests  map[string][]byte `json:"input_digests,omitempty"`
+	OutputDigests map[string][]byte `json:"output_digests,omitempty"`
+}
+
+// ReadCheckpoint reads the checkpoint of a copy with opts.
+func ReadCheckpoint(name string, opts Options) (*Checkpoint, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("can't read checkpoint:%w", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("can't read checkpoint:%w", err)
+	}
+	if !sameCopy(checkpoint.Options, opts) {
+		return nil, errors.New("checkpoint is of a copy with other options")
+	}
+	return &checkpoint, nil
+}
+
+// sameCopy tells if both options make the same output, only how the copy is
+// reported and checkpointed may differ.
+func sameCopy(a Options, b Options) bool {
+	for _, opts := range []*Options{&a, &b} {
+		opts.Status, opts.HashTo, opts.Parallel = "", "", 0
+		opts.Resume, opts.CheckpointInterval = false, 0
+	}
+	return a == b
+}
+
+// Checkpointer saves checkpoints of a copy to a file, at most once in
+// interval.
+type Checkpointer struct {
+	name          string
+	opts          Options
+	interval      time.Duration
+	saved         time.Time
+	output        *os.File
+	transformer   Transformer
+	blockWriter   *BlockWriter
+	inputDigests  *Digests
+	outputDigests *Digests
+}
+
+// Restore loads what the transformers, the output block and the digests
+// held at the checkpoint.
+func (checkpointer *Checkpointer) Restore(checkpoint *Checkpoint) error {
+	if err := checkpointer.transformer.LoadState(checkpoint.Transformers); err != nil {
+		return fmt.Errorf("can't restore transformers:%w", err)
+	}
+	checkpointer.blockWriter.block = append(checkpointer.blockWriter.block[:0], checkpoint.Block...)
+	if err := checkpointer.inputDigests.LoadState(checkpoint.InputDigests); err != nil {
+		return fmt.Errorf("can't restore digests:%w", err)
+	}
+	if err := checkpointer.outputDigests.LoadState(checkpoint.OutputDigests); err != nil {
+		return fmt.Errorf("can't restore digests:%w", err)
+	}
+	return nil
+}
+
+// Save saves the checkpoint with the input read up to offset. The output is
+// synced first and the file is replaced at once, so a crash leaves either
+// the previous checkpoint or this one.
+func (checkpointer *Checkpointer) Save(input int64) error {
+	checkpoint := Checkpoint{
+		Options: checkpointer.opts,
+		Input:   input,
+		Block:   checkpointer.blockWriter.block,
+	}
+	var err error
+	if checkpoint.Output, err = checkpointer.output.Seek(0, io.SeekCurrent); err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+	if checkpoint.Transformers, err = checkpointer.transformer.SaveState(); err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+	if checkpoint.InputDigests, err = checkpointer.inputDigests.SaveState(); err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+	if checkpoint.OutputDigests, err = checkpointer.outputDigests.SaveState(); err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+
+	if err := checkpointer.output.Sync(); err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+	if err := writeFileSync(checkpointer.name+".tmp", data); err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+	if err := os.Rename(checkpointer.name+".tmp", checkpointer.name); err != nil {
+		return fmt.Errorf("can't save checkpoint:%w", err)
+	}
+	checkpointer.saved = time.Now()
+	return nil
+}
+
+// Tick saves the checkpoint if interval has passed since the last one.
+func (checkpointer *Checkpointer) Tick(input int64) error {
+	if time.Since(checkpointer.saved) < checkpointer.interval {
+		return nil
+	}
+	return checkpointer.Save(input)
+}
+
+// Remove removes the checkpoint of a finished copy.
+func (checkpointer *Checkpointer) Remove() error {
+	if err := os.Remove(checkpointer.name); err != nil {
+		return fmt.Errorf("can't remove checkpoint:%w", err)
+	}
+	return nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func NewCheckpointer(opts Options, output *os.File, transformer Transformer, blockWriter *BlockWriter, inputDigests *Digests, outputDigests *Digests) *Checkpointer {
+	return &Checkpointer{
+		name:          opts.Checkpoint,
+		opts:          opts,
+		interval:      opts.CheckpointInterval,
+		output:        output,
+		transformer:   transformer,
+		blockWriter:   blockWriter,
+		inputDigests:  inputDigests,
+		outputDigests: outputDigests,
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	// the zeros make holes with sparse conversion
+	data := bytes.Repeat(append([]byte(testInput), make([]byte, 4096)...), 400)
+	input := filepath.Join(t.TempDir(), "in.txt")
+	assert.NoError(t, os.WriteFile(input, data, 0o644))
+
+	run := func(t *testing.T, args ...string) error {
+		cmd = exec.Command(binPath, append(args, "-from", input)...)
+		stderr := &strings.Builder{}
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		if err != nil {
+			t.Log(stderr.String())
+		}
+		return err
+	}
+
+	// interrupt kills the copy once it has saved a checkpoint with more than
+	// after bytes of input read
+	interrupt := func(t *testing.T, checkpoint string, after int64, args ...string) {
+		cmd := exec.Command(binPath, append(args, "-from", input, "-checkpoint", checkpoint, "-checkpoint-interval", "0")...)
+		assert.NoError(t, cmd.Start())
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+
+		for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			select {
+			case <-done:
+				t.Fatal("copy is done before it is interrupted")
+			default:
+			}
+			bs, err := os.ReadFile(checkpoint)
+			if err != nil {
+				continue
+			}
+			var saved Checkpoint
+			assert.NoError(t, json.Unmarshal(bs, &saved))
+			if saved.Input > after {
+				break
+			}
+		}
+		assert.NoError(t, cmd.Process.Kill())
+		assert.Error(t, <-done)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		// existing is the content of -to before the copy
+		existing []byte
+		// verify checks the digest of output computed through the resumes
+		verify bool
+	}{
+		{name: "plain", args: []string{"-block-size", "512"}},
+		{name: "ibs and obs", args: []string{"-ibs", "500", "-obs", "777"}},
+		{name: "conversions", args: []string{"-ibs", "500", "-obs", "300", "-conv", "upper_case,trim_spaces,dedupe_lines,tabs_to_spaces=4", "-to-charset", "utf-16le"}},
+		{name: "offset, limit and seek", args: []string{"-ibs", "500", "-offset", "1001", "-limit", strconv.Itoa(len(data) - 5000), "-seek", "33"}},
+		{name: "digests", args: []string{"-ibs", "500", "-hash", "sha256,crc32", "-hash-of", "both"}, verify: true},
+		{name: "sparse", args: []string{"-block-size", "512", "-conv", "sparse"}},
+		{name: "notrunc", args: []string{"-block-size", "512", "-conv", "notrunc", "-seek", "100"}, existing: bytes.Repeat([]byte("x"), len(data)+1000)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			expectedName, output, checkpoint := filepath.Join(dir, "expected"), filepath.Join(dir, "out"), filepath.Join(dir, "checkpoint.json")
+			if test.existing != nil {
+				assert.NoError(t, os.WriteFile(expectedName, test.existing, 0o644))
+				assert.NoError(t, os.WriteFile(output, test.existing, 0o644))
+			}
+			assert.NoError(t, run(t, append(test.args, "-to", expectedName, "-hash-to", filepath.Join(dir, "expected.txt"))...))
+			expected, err := os.ReadFile(expectedName)
+			assert.NoError(t, err)
+
+			args := append(test.args, "-to", output, "-hash-to", filepath.Join(dir, "digests.txt"))
+			if test.verify {
+				digest := md5.Sum(expected)
+				args = append(args, "-verify", "md5:"+hex.EncodeToString(digest[:]))
+			}
+			interrupt(t, checkpoint, int64(len(data)/3), args...)
+			interrupt(t, checkpoint, int64(len(data)*2/3), append(args, "-resume")...)
+			assert.NoError(t, run(t, append(args, "-checkpoint", checkpoint, "-resume")...))
+
+			result, err := os.ReadFile(output)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, result)
+			assert.NoFileExists(t, checkpoint)
+			if test.verify {
+				digests, err := os.ReadFile(filepath.Join(dir, "digests.txt"))
+				assert.NoError(t, err)
+				expectedDigests, err := os.ReadFile(filepath.Join(dir, "expected.txt"))
+				assert.NoError(t, err)
+				assert.Equal(t, strings.ReplaceAll(string(expectedDigests), expectedName, output), string(digests))
+			}
+		})
+	}
+
+	t.Run("error with other options", func(t *testing.T) {
+		dir := t.TempDir()
+		checkpoint, output := filepath.Join(dir, "checkpoint.json"), filepath.Join(dir, "out")
+		interrupt(t, checkpoint, int64(len(data)/2), "-block-size", "512", "-to", output)
+		assert.Error(t, run(t, "-block-size", "512", "-conv", "upper_case", "-to", output, "-checkpoint", checkpoint, "-resume"))
+		// the copy can still be resumed with the right options
+		assert.NoError(t, run(t, "-block-size", "512", "-to", output, "-checkpoint", checkpoint, "-resume", "-status", "none"))
+		result, err := os.ReadFile(output)
+		assert.NoError(t, err)
+		assert.Equal(t, data, result)
+	})
+
+	for _, test := range []struct {
+		name string
+		args []string
+	}{
+		{name: "no checkpoint to resume", args: []string{"-resume"}},
+		{name: "resume without checkpoint", args: []string{"-resume", "-checkpoint", ""}},
+		{name: "append", args: []string{"-conv", "append"}},
+		{name: "compress", args: []string{"-compress", "gzip"}},
+		{name: "stdout", args: []string{"-to", ""}},
+	} {
+		t.Run("error with "+test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			args := []string{"-from", input, "-to", filepath.Join(dir, "out"), "-checkpoint", filepath.Join(dir, "checkpoint.json")}
+			cmd = exec.Command(binPath, append(args, test.args...)...)
+			stderr := &strings.Builder{}
+			cmd.Stderr = stderr
+
+			assert.Error(t, cmd.Run())
+			assert.NotZero(t, stderr.Len())
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type Codec struct {
+	// magic is the beginning of every compressed stream
+	magic     []byte
+	newReader func(r io.Reader) (io.ReadCloser, error)
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var codecs = map[string]Codec{
+	"gzip": {
+		magic: []byte{0x1f, 0x8b},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+	},
+	"zstd": {
+		magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			decoder, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+	},
+	"xz": {
+		magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			reader, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(reader), nil
+		},
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		},
+	},
+}
+
+func validateCodec(name string, auto bool) error {
+	if _, ok := codecs[name]; ok || name == "" || auto && name == "auto" {
+		return nil
+	}
+	if auto {
+		return fmt.Errorf("unknown codec %q, expected auto, gzip, zstd or xz", name)
+	}
+	return fmt.Errorf("unknown codec %q, expected gzip, zstd or xz", name)
+}
+
+// NewDecompressReader decompresses r with the codec, "auto" detects it by
+// magic bytes and reads uncompressed input as is.
+func NewDecompressReader(r io.Reader, name string) (io.ReadCloser, error) {
+	if name == "" {
+		return io.NopCloser(r), nil
+	}
+	if name == "auto" {
+		buffered := bufio.NewReader(r)
+		r = buffered
+		name = ""
+		for codecName, codec := range codecs {
+			magic, _ := buffered.Peek(len(codec.magic))
+			if bytes.Equal(magic, codec.magic) {
+				name = codecName
+				break
+			}
+		}
+		if name == "" {
+			return io.NopCloser(r), nil
+		}
+	}
+	reader, err := codecs[name].newReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("can't decompress %s:%w", name, err)
+	}
+	return reader, nil
+}
+
+// NewCompressWriter compresses what is written to w with the codec, Close
+// writes the end of the stream, but doesn't close w.
+func NewCompressWriter(w io.Writer, name string) (io.WriteCloser, error) {
+	if name == "" {
+		return nopWriteCloser{w}, nil
+	}
+	writer, err := codecs[name].newWriter(w)
+	if err != nil {
+		return nil, fmt.Errorf("can't compress %s:%w", name, err)
+	}
+	return writer, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
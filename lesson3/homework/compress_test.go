@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	run := func(t *testing.T, input []byte, args ...string) []byte {
+		cmd = exec.Command(binPath, args...)
+		cmd.Stdin = bytes.NewReader(input)
+		stdout := &bytes.Buffer{}
+		cmd.Stdout = stdout
+		stderr := &strings.Builder{}
+		cmd.Stderr = stderr
+
+		err := cmd.Run()
+
+		assert.NoError(t, err)
+		assert.Zero(t, stderr.Len(), stderr.String())
+		return stdout.Bytes()
+	}
+	input := []byte(strings.Repeat(testInput, 20))
+
+	for _, codec := range []string{"gzip", "zstd", "xz"} {
+		for _, blockSize := range []int{1, 7, 1024, 1 << 16} {
+			size := strconv.Itoa(blockSize)
+			t.Run(codec+" with block-size "+size, func(t *testing.T) {
+				compressed := run(t, input, "-compress", codec, "-block-size", size)
+				assert.Less(t, len(compressed), len(input))
+				assert.Equal(t, codecs[codec].magic, compressed[:len(codecs[codec].magic)])
+
+				assert.Equal(t, input, run(t, compressed, "-decompress", codec, "-block-size", size))
+				assert.Equal(t, input, run(t, compressed, "-decompress", "auto", "-ibs", size, "-obs", "3"))
+			})
+		}
+
+		t.Run(codec+" with offset, limit and conversions", func(t *testing.T) {
+			// the second copy of the hello and machine learning lines
+			offset := len(testInput) + strings.Index(testInput, "hELlO")
+			limit := strings.Index(testInput, "Компьютерные") - strings.Index(testInput, "hELlO")
+			compressed := run(t, input, "-compress", codec, "-conv", "upper_case")
+			output := run(t, compressed, "-decompress", "auto", "-offset", strconv.Itoa(offset), "-limit", strconv.Itoa(limit), "-conv", "lower_case")
+			assert.Equal(t, strings.ToLower(string(input[offset:offset+limit])), string(output))
+		})
+
+		t.Run(codec+" recompressed", func(t *testing.T) {
+			compressed := run(t, input, "-compress", codec)
+			recompressed := run(t, compressed, "-decompress", "auto", "-compress", "gzip", "-block-size", "100")
+			reader, err := gzip.NewReader(bytes.NewReader(recompressed))
+			assert.NoError(t, err)
+			output, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, input, output)
+		})
+	}
+
+	t.Run("auto with uncompressed input", func(t *testing.T) {
+		assert.Equal(t, input, run(t, input, "-decompress", "auto", "-block-size", "3"))
+		assert.Empty(t, run(t, nil, "-decompress", "auto"))
+	})
+
+	t.Run("empty input", func(t *testing.T) {
+		compressed := run(t, nil, "-compress", "zstd")
+		assert.Empty(t, run(t, compressed, "-decompress", "zstd"))
+	})
+
+	for _, test := range []struct {
+		name  string
+		args  []string
+		input string
+	}{
+		{name: "unknown codec", args: []string{"-compress", "bzip2"}, input: testInput},
+		{name: "auto compression", args: []string{"-compress", "auto"}, input: testInput},
+		{name: "corrupted input", args: []string{"-decompress", "gzip"}, input: "\x1f\x8b not gzip"},
+		{name: "uncompressed input", args: []string{"-decompress", "xz"}, input: testInput},
+	} {
+		t.Run("error with "+test.name, func(t *testing.T) {
+			cmd = exec.Command(binPath, test.args...)
+			cmd.Stdin = strings.NewReader(test.input)
+			stderr := &strings.Builder{}
+			cmd.Stderr = stderr
+
+			err := cmd.Run()
+
+			assert.Error(t, err)
+			assert.NotZero(t, stderr.Len())
+		})
+	}
+}
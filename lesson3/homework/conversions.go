@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Conversion is one of -conv values: a name with an optional argument
+// after "=".
+type Conversion struct {
+	Name string
+	Arg  string
+}
+
+// ParseConversions splits -conv by commas. An argument starting with
+// a punctuation character is delimited by it like in sed, so it may contain
+// commas: replace=/a,b/c/ or replace=|/|-|.
+func ParseConversions(s string) ([]Conversion, error) {
+	result := make([]Conversion, 0)
+	for s != "" {
+		end := strings.IndexAny(s, "=,")
+		if end < 0 || s[end] == ',' {
+			if end < 0 {
+				end = len(s)
+			}
+			result = append(result, Conversion{Name: s[:end]})
+			s = strings.TrimPrefix(s[end:], ",")
+			continue
+		}
+
+		name := s[:end]
+		s = s[end+1:]
+		end = strings.IndexByte(s, ',')
+		if end < 0 {
+			end = len(s)
+		}
+		if r, _ := utf8.DecodeRuneInString(s); unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			var err error
+			end, err = delimitedEnd(s, r)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse %s conversion: %w", name, err)
+			}
+			if end < len(s) && s[end] != ',' {
+				return nil, fmt.Errorf("can't parse %s conversion: unexpected %q after %s", name, s[end:], s[:end])
+			}
+		}
+		result = append(result, Conversion{Name: name, Arg: s[:end]})
+		s = strings.TrimPrefix(s[end:], ",")
+	}
+	return result, nil
+}
+
+// delimitedEnd returns the end of /pattern/replacement/ in s, delimiters
+// escaped with a backslash are skipped.
+func delimitedEnd(s string, delimiter rune) (int, error) {
+	delimiters := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '\\':
+			_, escaped := utf8.DecodeRuneInString(s[i+size:])
+			size += escaped
+		case r == delimiter:
+			delimiters++
+			if delimiters == 3 {
+				return i + size, nil
+			}
+		}
+		i += size
+	}
+	return 0, fmt.Errorf("expected 3 %q in %s", delimiter, s)
+}
+
+// splitDelimited splits /pattern/replacement/ and unescapes the delimiter,
+// and backslashes in replacement.
+func splitDelimited(s string) (string, string) {
+	delimiter, size := utf8.DecodeRuneInString(s)
+	parts := make([]string, 0, 2)
+	part := strings.Builder{}
+	for i := size; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r == '\\' {
+			escaped, escapedSize := utf8.DecodeRuneInString(s[i:])
+			if escaped != delimiter && (len(parts) == 0 || escaped != '\\') {
+				part.WriteRune(r)
+			}
+			part.WriteString(s[i : i+escapedSize])
+			i += escapedSize
+			continue
+		}
+		if r == delimiter {
+			parts = append(parts, part.String())
+			part.Reset()
+			continue
+		}
+		part.WriteRune(r)
+	}
+	return parts[0], parts[1]
+}
+
+var (
+	ErrNoArgument  = errors.New("argument is required")
+	ErrLineTooLong = errors.New("line is too long")
+)
+
+// maxLineSize is the most bytes of a line kept until its end comes.
+const maxLineSize = 1 << 20
+
+// conversions make a transformer for -conv by its argument.
+var conversions = map[string]func(arg string) (Transformer, error){
+	"lower_case":     noArgument(func() Transformer { return NewLowerCaseTransformer() }),
+	"upper_case":     noArgument(func() Transformer { return NewUpperCaseTransformer() }),
+	"trim_spaces":    noArgument(func() Transformer { return NewTrimSpacesTransformer() }),
+	"dedupe_lines":   noArgument(func() Transformer { return NewDedupeLinesTransformer() }),
+	"strip_ansi":     noArgument(func() Transformer { return NewStripANSITransformer() }),
+	"crlf_to_lf":     noArgument(func() Transformer { return NewCRLFTransformer() }),
+	"replace":        newReplaceTransformer,
+	"normalize":      newNormalizeTransformer,
+	"tabs_to_spaces": newTabsTransformer,
+}
+
+func noArgument(newTransformer func() Transformer) func(arg string) (Transformer, error) {
+	return func(arg string) (Transformer, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+		return newTransformer(), nil
+	}
+}
+
+func newReplaceTransformer(arg string) (Transformer, error) {
+	if arg == "" {
+		return nil, ErrNoArgument
+	}
+	if _, err := delimitedEnd(arg, []rune(arg)[0]); err != nil {
+		return nil, err
+	}
+	pattern, replacement := splitDelimited(arg)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("can't compile pattern: %w", err)
+	}
+	return NewReplaceTransformer(re, replacement), nil
+}
+
+var normForms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+func newNormalizeTransformer(arg string) (Transformer, error) {
+	if arg == "" {
+		return nil, ErrNoArgument
+	}
+	form, ok := normForms[strings.ToUpper(arg)]
+	if !ok {
+		return nil, fmt.Errorf("unknown form %q, expected NFC, NFD, NFKC or NFKD", arg)
+	}
+	return NewNormalizeTransformer(form), nil
+}
+
+func newTabsTransformer(arg string) (Transformer, error) {
+	if arg == "" {
+		return nil, ErrNoArgument
+	}
+	width, err := strconv.Atoi(arg)
+	if err != nil || width <= 0 {
+		return nil, fmt.Errorf("tab width should be a number more than 0, got %q", arg)
+	}
+	return NewTabsTransformer(width), nil
+}
+
+// LineTransformer converts the input line by line, a line split between
+// blocks is kept until its end comes, up to maxLineSize bytes.
+type LineTransformer struct {
+	restBytes []byte
+	// function gets a line with "\n" at the end, but the last one
+	function func(line []byte) []byte
+}
+
+func (transformer *LineTransformer) Transform(bs []byte) ([]byte, error) {
+	allBytes := append(transformer.restBytes, bs...)
+	result := make([]byte, 0, len(allBytes))
+	for {
+		end := bytes.IndexByte(allBytes, '\n')
+		if end < 0 {
+			break
+		}
+		result = append(result, transformer.function(allBytes[:end+1])...)
+		allBytes = allBytes[end+1:]
+	}
+	if len(allBytes) > maxLineSize {
+		return nil, fmt.Errorf("%w: no end of line in %d bytes", ErrLineTooLong, maxLineSize)
+	}
+	transformer.restBytes = append(transformer.restBytes[:0:0], allBytes...)
+	return result, nil
+}
+
+// Flush converts the last line without "\n".
+func (transformer *LineTransformer) Flush() ([]byte, error) {
+	rest := transformer.restBytes
+	transformer.restBytes = nil
+	if len(rest) == 0 {
+		return nil, nil
+	}
+	return transformer.function(rest), nil
+}
+
+func (transformer *LineTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(transformer.restBytes)
+}
+
+func (transformer *LineTransformer) LoadState(state []byte) error {
+	return json.Unmarshal(state, &transformer.restBytes)
+}
+
+// ReplaceTransformer replaces regexp matches line by line like sed, so
+// a match can't span lines.
+type ReplaceTransformer struct {
+	LineTransformer
+}
+
+func NewReplaceTransformer(re *regexp.Regexp, replacement string) *ReplaceTransformer {
+	return &ReplaceTransformer{
+		LineTransformer{function: func(line []byte) []byte {
+			text, eol := cutEOL(line)
+			return append(re.ReplaceAll(text, []byte(replacement)), eol...)
+		}},
+	}
+}
+
+// DedupeLinesTransformer drops lines equal to the previous one like uniq.
+type DedupeLinesTransformer struct {
+	LineTransformer
+	previous []byte
+	first    bool
+}
+
+type dedupeLinesState struct {
+	Rest     []byte `json:"rest"`
+	Previous []byte `json:"previous"`
+	First    bool   `json:"first"`
+}
+
+func (transformer *DedupeLinesTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(dedupeLinesState{
+		Rest:     transformer.restBytes,
+		Previous: transformer.previous,
+		First:    transformer.first,
+	})
+}
+
+func (transformer *DedupeLinesTransformer) LoadState(state []byte) error {
+	var loaded dedupeLinesState
+	if err := json.Unmarshal(state, &loaded); err != nil {
+		return err
+	}
+	transformer.restBytes, transformer.previous, transformer.first = loaded.Rest, loaded.Previous, loaded.First
+	return nil
+}
+
+func NewDedupeLinesTransformer() *DedupeLinesTransformer {
+	transformer := &DedupeLinesTransformer{first: true}
+	transformer.function = func(line []byte) []byte {
+		text, _ := cutEOL(line)
+		if !transformer.first && bytes.Equal(text, transformer.previous) {
+			return nil
+		}
+		transformer.first = false
+		transformer.previous = append(transformer.previous[:0], text...)
+		return line
+	}
+	return transformer
+}
+
+// ansiEscape matches CSI sequences like colors, OSC sequences like window
+// titles and two-character escapes like reset.
+var ansiEscape = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\^-~])`)
+
+var (
+	// ansiEscapeStart matches an escape at the start of the bytes.
+	ansiEscapeStart = regexp.MustCompile(`^` + ansiEscape.String())
+	// unterminatedEscape matches bytes that are the start of an escape the
+	// next block may end.
+	unterminatedEscape = regexp.MustCompile(`^\x1b(\[[0-?]*[ -/]*|\][^\x07\x1b]*\x1b?)?$`)
+)
+
+// maxEscapeSize is the most bytes of an unterminated escape kept until the
+// next block, longer ones are left as is.
+const maxEscapeSize = 4096
+
+// StripANSITransformer removes ANSI escapes, an escape split between blocks
+// is kept until its end comes.
+type StripANSITransformer struct {
+	restBytes []byte
+}
+
+func (transformer *StripANSITransformer) Transform(bs []byte) ([]byte, error) {
+	allBytes := append(transformer.restBytes, bs...)
+	end := len(allBytes)
+	for i := 0; i < len(allBytes); {
+		escape := bytes.IndexByte(allBytes[i:], '\x1b')
+		if escape < 0 {
+			break
+		}
+		i += escape
+		if loc := ansiEscapeStart.FindIndex(allBytes[i:]); loc != nil {
+			i += loc[1]
+			continue
+		}
+		if len(allBytes)-i <= maxEscapeSize && unterminatedEscape.Match(allBytes[i:]) {
+			end = i
+			break
+		}
+		i++
+	}
+	result := ansiEscape.ReplaceAll(allBytes[:end], nil)
+	transformer.restBytes = append(transformer.restBytes[:0:0], allBytes[end:]...)
+	return result, nil
+}
+
+// Flush returns the unterminated escape as is.
+func (transformer *StripANSITransformer) Flush() ([]byte, error) {
+	rest := transformer.restBytes
+	transformer.restBytes = nil
+	return rest, nil
+}
+
+func (transformer *StripANSITransformer) SaveState() ([]byte, error) {
+	return json.Marshal(transformer.restBytes)
+}
+
+func (transformer *StripANSITransformer) LoadState(state []byte) error {
+	return json.Unmarshal(state, &transformer.restBytes)
+}
+
+func NewStripANSITransformer() *StripANSITransformer {
+	return &StripANSITransformer{}
+}
+
+func cutEOL(line []byte) ([]byte, []byte) {
+	if bytes.HasSuffix(line, []byte("\n")) {
+		return line[:len(line)-1], line[len(line)-1:]
+	}
+	return line, nil
+}
+
+// CRLFTransformer replaces "\r\n" with "\n", "\r" at the end of a block
+// waits for the next one.
+type CRLFTransformer struct {
+	carriageReturn bool
+}
+
+func (transformer *CRLFTransformer) Transform(bs []byte) ([]byte, error) {
+	result := make([]byte, 0, len(bs)+1)
+	if transformer.carriageReturn {
+		transformer.carriageReturn = false
+		if len(bs) == 0 || bs[0] != '\n' {
+			result = append(result, '\r')
+		}
+	}
+	if len(bs) > 0 && bs[len(bs)-1] == '\r' {
+		transformer.carriageReturn = true
+		bs = bs[:len(bs)-1]
+	}
+	return append(result, bytes.ReplaceAll(bs, []byte("\r\n"), []byte("\n"))...), nil
+}
+
+func (transformer *CRLFTransformer) Flush() ([]byte, error) {
+	if !transformer.carriageReturn {
+		return nil, nil
+	}
+	transformer.carriageReturn = false
+	return []byte("\r"), nil
+}
+
+func (transformer *CRLFTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(transformer.carriageReturn)
+}
+
+func (transformer *CRLFTransformer) LoadState(state []byte) error {
+	return json.Unmarshal(state, &transformer.carriageReturn)
+}
+
+func NewCRLFTransformer() *CRLFTransformer {
+	return &CRLFTransformer{}
+}
+
+// NormalizeTransformer converts text to a unicode normalization form.
+// Text after the last boundary may combine with the next block, so it waits
+// for it.
+type NormalizeTransformer struct {
+	form      norm.Form
+	restBytes []byte
+}
+
+func (transformer *NormalizeTransformer) Transform(bs []byte) ([]byte, error) {
+	allBytes := append(transformer.restBytes, bs...)
+	boundary := transformer.form.LastBoundary(allBytes)
+	if boundary <= 0 {
+		transformer.restBytes = allBytes
+		return nil, nil
+	}
+	result := transformer.form.Bytes(allBytes[:boundary])
+	transformer.restBytes = append(transformer.restBytes[:0:0], allBytes[boundary:]...)
+	return result, nil
+}
+
+func (transformer *NormalizeTransformer) Flush() ([]byte, error) {
+	rest := transformer.restBytes
+	transformer.restBytes = nil
+	return transformer.form.Bytes(rest), nil
+}
+
+func (transformer *NormalizeTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(transformer.restBytes)
+}
+
+func (transformer *NormalizeTransformer) LoadState(state []byte) error {
+	return json.Unmarshal(state, &transformer.restBytes)
+}
+
+func NewNormalizeTransformer(form norm.Form) *NormalizeTransformer {
+	return &NormalizeTransformer{form: form}
+}
+
+// TabsTransformer expands tabs to spaces up to the next tab stop like
+// expand, a column is a rune.
+type TabsTransformer struct {
+	state  ParseState
+	width  int
+	column int
+}
+
+func (transformer *TabsTransformer) Transform(bs []byte) ([]byte, error) {
+	result := make([]byte, 0, len(bs))
+	transformer.state.ParseRunes(bs, func(r rune, raw []byte) {
+		switch {
+		case raw != nil:
+			result = append(result, raw...)
+			transformer.column++
+		case r == '\t':
+			spaces := transformer.width - transformer.column%transformer.width
+			result = append(result, bytes.Repeat([]byte{' '}, spaces)...)
+			transformer.column += spaces
+		case r == '\n':
+			result = append(result, '\n')
+			transformer.column = 0
+		default:
+			result = utf8.AppendRune(result, r)
+			transformer.column++
+		}
+	})
+	return result, nil
+}
+
+func (transformer *TabsTransformer) Flush() ([]byte, error) {
+	return transformer.state.Flush(), nil
+}
+
+type tabsState struct {
+	Rest   []byte `json:"rest"`
+	Column int    `json:"column"`
+}
+
+func (transformer *TabsTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(tabsState{Rest: transformer.state.restBytes, Column: transformer.column})
+}
+
+func (transformer *TabsTransformer) LoadState(state []byte) error {
+	var loaded tabsState
+	if err := json.Unmarshal(state, &loaded); err != nil {
+		return err
+	}
+	transformer.state.restBytes, transformer.column = loaded.Rest, loaded.Column
+	return nil
+}
+
+func NewTabsTransformer(width int) *TabsTransformer {
+	return &TabsTransformer{width: width}
+}
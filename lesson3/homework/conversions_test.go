@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversions(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	tests := []struct {
+		name   string
+		conv   string
+		input  string
+		output string
+		err    bool
+	}{
+		{name: "replace", conv: "replace=/машин(ное|ного)/ML/", input: testInput, output: strings.ReplaceAll(testInput, "машинного", "ML")},
+		{name: "replace with groups", conv: "replace=/(\\w+)@(\\w+)/$2 at $1/", input: "user@example\nroot@host", output: "example at user\nhost at root"},
+		{name: "replace with commas", conv: "replace=/, */;/,upper_case", input: "a, b,c", output: "A;B;C"},
+		{name: "replace with escaped delimiter", conv: "replace=/\\/+/|/", input: "/usr//local/bin", output: "|usr|local|bin"},
+		{name: "replace with another delimiter", conv: "replace=#/#\\\\#", input: "C:/Windows/System32", output: "C:\\Windows\\System32"},
+		{name: "dedupe lines", conv: "dedupe_lines", input: "a\na\n\n\nb\na\na", output: "a\n\nb\na\n"},
+		{name: "strip ansi", conv: "strip_ansi", input: "\x1b[1;31merror\x1b[0m: \x1b]0;title\x07done\x1bc", output: "error: done"},
+		{name: "normalize NFC", conv: "normalize=NFC", input: "e\u0301 \u0435\u0308", output: "\u00e9 \u0451"},
+		{name: "normalize NFKD", conv: "normalize=nfkd", input: "ﬁ ²", output: "fi 2"},
+		{name: "crlf to lf", conv: "crlf_to_lf", input: "a\r\nb\rc\r\n\r", output: "a\nb\rc\n\r"},
+		{name: "tabs to spaces", conv: "tabs_to_spaces=4", input: "\tа\tbc\tdef\tg\nя\t|", output: "    а   bc  def g\nя   |"},
+		{name: "line conversions with trim spaces", conv: "crlf_to_lf,dedupe_lines,trim_spaces", input: "  \r\nx\r\nx\r\ny  \r\n", output: "x\ny"},
+		{name: "unknown conversion", conv: "replace=/a/b/,reverse", err: true},
+		{name: "unterminated replace", conv: "replace=/a/b", err: true},
+		{name: "text after replace", conv: "replace=/a/b/c", err: true},
+		{name: "invalid pattern", conv: "replace=/(/b/", err: true},
+		{name: "replace without argument", conv: "replace", err: true},
+		{name: "unknown form", conv: "normalize=NFX", err: true},
+		{name: "invalid tab width", conv: "tabs_to_spaces=0", err: true},
+		{name: "unexpected argument", conv: "crlf_to_lf=1", err: true},
+	}
+
+	for _, test := range tests {
+		// lines and escapes are split between blocks at small block sizes
+		for _, blockSize := range []int{1, 3, 1024} {
+			t.Run(test.name+" with block-size "+strconv.Itoa(blockSize), func(t *testing.T) {
+				cmd = exec.Command(binPath, "-conv", test.conv, "-block-size", strconv.Itoa(blockSize))
+				cmd.Stdin = strings.NewReader(test.input)
+				stdout := &strings.Builder{}
+				cmd.Stdout = stdout
+				stderr := &strings.Builder{}
+				cmd.Stderr = stderr
+
+				err := cmd.Run()
+
+				if test.err {
+					assert.Error(t, err)
+					assert.NotZero(t, stderr.Len())
+					return
+				}
+				assert.NoError(t, err)
+				assert.Zero(t, stderr.Len(), stderr.String())
+				assert.Equal(t, test.output, stdout.String())
+			})
+		}
+	}
+}
+
+func TestParseConversions(t *testing.T) {
+	tests := []struct {
+		conv   string
+		result []Conversion
+		err    bool
+	}{
+		{conv: "", result: []Conversion{}},
+		{conv: "upper_case,trim_spaces", result: []Conversion{{Name: "upper_case"}, {Name: "trim_spaces"}}},
+		{conv: "tabs_to_spaces=4,notrunc", result: []Conversion{{Name: "tabs_to_spaces", Arg: "4"}, {Name: "notrunc"}}},
+		{conv: "replace=/a,b/c=d/", result: []Conversion{{Name: "replace", Arg: "/a,b/c=d/"}}},
+		{conv: "replace=|a\\|b|,|,lower_case", result: []Conversion{{Name: "replace", Arg: "|a\\|b|,|"}, {Name: "lower_case"}}},
+		{conv: "replace=/a/b/c", err: true},
+		{conv: "replace=/a,b/", err: true},
+	}
+
+	for _, test := range tests {
+		result, err := ParseConversions(test.conv)
+		if test.err {
+			assert.Error(t, err, test.conv)
+			continue
+		}
+		assert.NoError(t, err, test.conv)
+		assert.Equal(t, test.result, result, test.conv)
+	}
+}
@@ -2,7 +2,12 @@ module lecture03_homework
 
 go 1.19
 
-require github.com/stretchr/testify v1.8.2
+require (
+	github.com/klauspost/compress v1.17.6
+	github.com/stretchr/testify v1.8.2
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/text v0.9.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+}
+
+// hashesBySize tells the algorithm of a -verify digest without a prefix.
+var hashesBySize = map[int]string{
+	md5.Size:    "md5",
+	sha1.Size:   "sha1",
+	sha256.Size: "sha256",
+	crc32.Size:  "crc32",
+}
+
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+func ParseHashes(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	algorithms := strings.Split(strings.ToLower(s), ",")
+	seen := make(map[string]struct{}, len(algorithms))
+	for _, algorithm := range algorithms {
+		if _, ok := hashes[algorithm]; !ok {
+			return nil, fmt.Errorf("unknown hash %q, expected md5, sha1, sha256 or crc32", algorithm)
+		}
+		if _, ok := seen[algorithm]; ok {
+			return nil, fmt.Errorf("hash %q is repeated", algorithm)
+		}
+		seen[algorithm] = struct{}{}
+	}
+	return algorithms, nil
+}
+
+// ParseVerify parses algorithm:digest, the algorithm may be omitted if
+// the digest size tells it.
+func ParseVerify(s string) (algorithm string, digest string, err error) {
+	if s == "" {
+		return "", "", nil
+	}
+	algorithm, digest, found := strings.Cut(strings.ToLower(s), ":")
+	if !found {
+		algorithm, digest = "", algorithm
+	}
+	bs, err := hex.DecodeString(digest)
+	if err != nil {
+		return "", "", fmt.Errorf("digest should be hexadecimal: %w", err)
+	}
+	if algorithm == "" {
+		algorithm = hashesBySize[len(bs)]
+		if algorithm == "" {
+			return "", "", fmt.Errorf("can't tell the hash of %d bytes digest, use algorithm:digest", len(bs))
+		}
+	}
+	newHash, ok := hashes[algorithm]
+	if !ok {
+		return "", "", fmt.Errorf("unknown hash %q, expected md5, sha1, sha256 or crc32", algorithm)
+	}
+	if size := newHash().Size(); size != len(bs) {
+		return "", "", fmt.Errorf("%s digest should be %d bytes, got %d", algorithm, size, len(bs))
+	}
+	return algorithm, digest, nil
+}
+
+// Digests is a writer computing several hashes of a stream at once.
+type Digests struct {
+	algorithms []string
+	hashes     map[string]hash.Hash
+}
+
+func (digests *Digests) Write(bs []byte) (int, error) {
+	for _, h := range digests.hashes {
+		h.Write(bs)
+	}
+	return len(bs), nil
+}
+
+// Sum is the hex digest of the stream written so far.
+func (digests *Digests) Sum(algorithm string) string {
+	return hex.EncodeToString(digests.hashes[algorithm].Sum(nil))
+}
+
+// Report writes digests like sha256sum --tag: SHA256 (name) = digest.
+func (digests *Digests) Report(writer io.Writer, name string) error {
+	for _, algorithm := range digests.algorithms {
+		_, err := fmt.Fprintf(writer, "%s (%s) = %s\n", strings.ToUpper(algorithm), name, digests.Sum(algorithm))
+		if err != nil {
+			return fmt.Errorf("can't write digest:%w", err)
+		}
+	}
+	return nil
+}
+
+// SaveState saves the states of the hashes, so a resumed copy can go on
+// computing them.
+func (digests *Digests) SaveState() (map[string][]byte, error) {
+	states := make(map[string][]byte, len(digests.hashes))
+	for algorithm, h := range digests.hashes {
+		state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("can't save %s state:%w", algorithm, err)
+		}
+		states[algorithm] = state
+	}
+	return states, nil
+}
+
+func (digests *Digests) LoadState(states map[string][]byte) error {
+	for algorithm, h := range digests.hashes {
+		state, ok := states[algorithm]
+		if !ok {
+			return fmt.Errorf("no %s state", algorithm)
+		}
+		if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+			return fmt.Errorf("can't load %s state:%w", algorithm, err)
+		}
+	}
+	return nil
+}
+
+// NewDigests computes hashes of algorithms and reports them, verify is only
+// computed.
+func NewDigests(algorithms []string, verify string) *Digests {
+	digests := &Digests{
+		algorithms: algorithms,
+		hashes:     make(map[string]hash.Hash),
+	}
+	for _, algorithm := range algorithms {
+		digests.hashes[algorithm] = hashes[algorithm]()
+	}
+	if verify != "" && digests.hashes[verify] == nil {
+		digests.hashes[verify] = hashes[verify]()
+	}
+	return digests
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHash(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	sha256Of := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	md5Of := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	sha1Of := func(s string) string {
+		sum := sha1.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	crc32Of := func(s string) string {
+		return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(s)))
+	}
+	converted := strings.ToUpper(strings.TrimSpace(testInput))
+
+	tests := []struct {
+		name   string
+		args   []string
+		stderr string
+		err    bool
+	}{
+		{name: "output by default", args: []string{"-hash", "sha256"}, stderr: "SHA256 (-) = " + sha256Of(testInput) + "\n"},
+		{
+			name: "all hashes",
+			args: []string{"-hash", "md5,sha1,SHA256,crc32", "-block-size", "7"},
+			stderr: "MD5 (-) = " + md5Of(testInput) + "\nSHA1 (-) = " + sha1Of(testInput) + "\n" +
+				"SHA256 (-) = " + sha256Of(testInput) + "\nCRC32 (-) = " + crc32Of(testInput) + "\n",
+		},
+		{
+			name:   "input after offset and limit",
+			args:   []string{"-hash", "md5", "-hash-of", "input", "-offset", "100", "-limit", "300"},
+			stderr: "MD5 (-) = " + md5Of(testInput[100:400]) + "\n",
+		},
+		{
+			name:   "both with conversions",
+			args:   []string{"-hash", "crc32", "-hash-of", "both", "-conv", "trim_spaces,upper_case"},
+			stderr: "CRC32 (-) = " + crc32Of(testInput) + "\nCRC32 (-) = " + crc32Of(converted) + "\n",
+		},
+		{name: "verify", args: []string{"-verify", sha256Of(testInput)}},
+		{name: "verify with algorithm", args: []string{"-verify", "MD5:" + strings.ToUpper(md5Of(testInput))}},
+		{name: "verify output with conversions", args: []string{"-conv", "trim_spaces,upper_case", "-verify", "sha1:" + sha1Of(converted)}},
+		{name: "verify input", args: []string{"-hash-of", "input", "-conv", "upper_case", "-verify", crc32Of(testInput)}},
+		{name: "verify mismatch", args: []string{"-conv", "upper_case", "-verify", sha256Of(testInput)}, stderr: "digest mismatch", err: true},
+		{name: "verify with another hash", args: []string{"-hash", "md5", "-verify", "crc32:" + crc32Of(testInput)}, stderr: "MD5 (-) = " + md5Of(testInput) + "\n"},
+		{name: "unknown hash", args: []string{"-hash", "sha512"}, stderr: "unknown hash", err: true},
+		{name: "repeated hash", args: []string{"-hash", "sha256,SHA256"}, stderr: "repeated", err: true},
+		{name: "digest of unknown size", args: []string{"-verify", "abcdef"}, stderr: "can't tell the hash", err: true},
+		{name: "digest of wrong size", args: []string{"-verify", "sha1:" + md5Of(testInput)}, stderr: "should be 20 bytes", err: true},
+		{name: "digest isn't hex", args: []string{"-verify", "md5:xyz"}, stderr: "hexadecimal", err: true},
+		{name: "unknown stream", args: []string{"-hash", "md5", "-hash-of", "all"}, stderr: "hash-of should be", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd = exec.Command(binPath, test.args...)
+			cmd.Stdin = strings.NewReader(testInput)
+			stdout := &strings.Builder{}
+			cmd.Stdout = stdout
+			stderr := &strings.Builder{}
+			cmd.Stderr = stderr
+
+			err := cmd.Run()
+
+			if test.err {
+				assert.Error(t, err)
+				assert.Contains(t, stderr.String(), test.stderr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.stderr, stderr.String())
+		})
+	}
+
+	t.Run("sidecar file", func(t *testing.T) {
+		dir := t.TempDir()
+		input := filepath.Join(dir, "in.txt")
+		assert.NoError(t, os.WriteFile(input, []byte(testInput), 0o644))
+		output := filepath.Join(dir, "out.txt")
+		sidecar := filepath.Join(dir, "out.txt.sha256")
+		cmd = exec.Command(binPath, "-from", input, "-to", output, "-hash", "sha256", "-hash-of", "both", "-hash-to", sidecar)
+		stderr := &strings.Builder{}
+		cmd.Stderr = stderr
+
+		err := cmd.Run()
+
+		assert.NoError(t, err)
+		assert.Zero(t, stderr.Len(), stderr.String())
+		data, err := os.ReadFile(sidecar)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("SHA256 (%s) = %s\nSHA256 (%s) = %s\n", input, sha256Of(testInput), output, sha256Of(testInput)), string(data))
+
+		// the sidecar file isn't overwritten like the output one, and the
+		// copy fails before the output is written
+		another := filepath.Join(dir, "another.txt")
+		cmd = exec.Command(binPath, "-from", input, "-to", another, "-hash", "md5", "-hash-to", sidecar)
+		assert.Error(t, cmd.Run())
+		assert.NoFileExists(t, another)
+	})
+}
@@ -1,19 +1,27 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"math"
 	"os"
-	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
 
+// Transformer converts a stream block by block. Transform may hold back
+// bytes it can't convert yet, e.g. a rune split between blocks, Flush returns
+// them at the end of input. SaveState and LoadState keep what is held back
+// in a checkpoint, so an interrupted copy can be resumed.
 type Transformer interface {
-	Transform(bs []byte) []byte
+	Transform(bs []byte) ([]byte, error)
+	Flush() ([]byte, error)
+	SaveState() ([]byte, error)
+	LoadState(state []byte) error
 }
 
 type TransformersComposer struct {
@@ -24,11 +32,65 @@ func (transformer *TransformersComposer) AddTransformer(t Transformer) {
 	transformer.transformers = append(transformer.transformers, t)
 }
 
-func (transformer *TransformersComposer) Transform(bs []byte) []byte {
-	for _, transformer := range transformer.transformers {
-		bs = transformer.Transform(bs)
+func (transformer *TransformersComposer) Transform(bs []byte) ([]byte, error) {
+	return transformer.transform(bs, 0)
+}
+
+func (transformer *TransformersComposer) transform(bs []byte, from int) ([]byte, error) {
+	for _, transformer := range transformer.transformers[from:] {
+		var err error
+		bs, err = transformer.Transform(bs)
+		if err != nil {
+			return bs, err
+		}
+	}
+	return bs, nil
+}
+
+// Flush passes what every transformer held back through the ones after it.
+func (transformer *TransformersComposer) Flush() ([]byte, error) {
+	result := make([]byte, 0)
+	for i, t := range transformer.transformers {
+		bs, err := t.Flush()
+		if err != nil {
+			return result, err
+		}
+		bs, err = transformer.transform(bs, i+1)
+		result = append(result, bs...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// SaveState saves the states of all transformers as a json array.
+func (transformer *TransformersComposer) SaveState() ([]byte, error) {
+	states := make([]json.RawMessage, 0, len(transformer.transformers))
+	for _, t := range transformer.transformers {
+		state, err := t.SaveState()
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
 	}
-	return bs
+	return json.Marshal(states)
+}
+
+func (transformer *TransformersComposer) LoadState(state []byte) error {
+	var states []json.RawMessage
+	if err := json.Unmarshal(state, &states); err != nil {
+		return err
+	}
+	if len(states) != len(transformer.transformers) {
+		return fmt.Errorf("expected states of %d transformers, got %d", len(transformer.transformers), len(states))
+	}
+	for i, t := range transformer.transformers {
+		if err := t.LoadState(states[i]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func NewTransformersComposer() *TransformersComposer {
@@ -36,27 +98,42 @@ func NewTransformersComposer() *TransformersComposer {
 }
 
 type CaseTransformer struct {
-	state    *ParseState
+	state    ParseState
 	function func(r rune) rune
 }
 
-func (transformer *CaseTransformer) Transform(bs []byte) []byte {
-	allBytes := transformer.state.GetAllBytes(bs)
-	runes, bytesNum := parseRunes(allBytes)
-	transformer.state.restBytes = allBytes[bytesNum:]
-	for i, r := range runes {
-		runes[i] = transformer.function(r)
-	}
-	return []byte(string(runes))
+func (transformer *CaseTransformer) Transform(bs []byte) ([]byte, error) {
+	result := make([]byte, 0, len(bs))
+	transformer.state.ParseRunes(bs, func(r rune, raw []byte) {
+		if raw != nil {
+			result = append(result, raw...)
+			return
+		}
+		result = utf8.AppendRune(result, transformer.function(r))
+	})
+	return result, nil
+}
+
+// Flush returns an incomplete rune the input ends with as is.
+func (transformer *CaseTransformer) Flush() ([]byte, error) {
+	return transformer.state.Flush(), nil
+}
+
+func (transformer *CaseTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(transformer.state.restBytes)
+}
+
+func (transformer *CaseTransformer) LoadState(state []byte) error {
+	return json.Unmarshal(state, &transformer.state.restBytes)
 }
 
 type LowerCaseTransformer struct {
 	CaseTransformer
 }
 
-func NewLowerCaseTransformer(state *ParseState) *LowerCaseTransformer {
+func NewLowerCaseTransformer() *LowerCaseTransformer {
 	return &LowerCaseTransformer{
-		CaseTransformer{state: state, function: unicode.ToLower},
+		CaseTransformer{function: unicode.ToLower},
 	}
 }
 
@@ -64,40 +141,78 @@ type UpperCaseTransformer struct {
 	CaseTransformer
 }
 
-func NewUpperCaseTransformer(state *ParseState) *UpperCaseTransformer {
+func NewUpperCaseTransformer() *UpperCaseTransformer {
 	return &UpperCaseTransformer{
-		CaseTransformer{state: state, function: unicode.ToUpper},
+		CaseTransformer{function: unicode.ToUpper},
 	}
 }
 
 type TrimSpacesTransformer struct {
-	state       *ParseState
-	spaces      []rune
+	state       ParseState
+	spaces      []byte
 	isBeginning bool
 }
 
-func (transformer *TrimSpacesTransformer) Transform(bs []byte) []byte {
-	allBytes := transformer.state.GetAllBytes(bs)
-	runes, bytesNum := parseRunes(allBytes)
-	transformer.state.restBytes = allBytes[bytesNum:]
-	text := make([]rune, 0)
-	for _, r := range runes {
-		if !unicode.IsSpace(r) {
-			text = append(text, transformer.spaces...)
-			text = append(text, r)
-			transformer.spaces = make([]rune, 0)
-			transformer.isBeginning = false
-		} else if !transformer.isBeginning {
-			transformer.spaces = append(transformer.spaces, r)
+func (transformer *TrimSpacesTransformer) Transform(bs []byte) ([]byte, error) {
+	text := make([]byte, 0, len(bs))
+	transformer.state.ParseRunes(bs, func(r rune, raw []byte) {
+		if raw == nil && unicode.IsSpace(r) {
+			if !transformer.isBeginning {
+				transformer.spaces = utf8.AppendRune(transformer.spaces, r)
+			}
+			return
+		}
+		text = append(text, transformer.spaces...)
+		if raw != nil {
+			text = append(text, raw...)
+		} else {
+			text = utf8.AppendRune(text, r)
 		}
+		transformer.spaces = transformer.spaces[:0]
+		transformer.isBeginning = false
+	})
+	return text, nil
+}
+
+// Flush drops trailing spaces, but not an incomplete rune after them.
+func (transformer *TrimSpacesTransformer) Flush() ([]byte, error) {
+	rest := transformer.state.Flush()
+	if len(rest) == 0 {
+		return nil, nil
+	}
+	text := append(transformer.spaces, rest...)
+	transformer.spaces = nil
+	return text, nil
+}
+
+type trimSpacesState struct {
+	Rest        []byte `json:"rest"`
+	Spaces      []byte `json:"spaces"`
+	IsBeginning bool   `json:"is_beginning"`
+}
+
+func (transformer *TrimSpacesTransformer) SaveState() ([]byte, error) {
+	return json.Marshal(trimSpacesState{
+		Rest:        transformer.state.restBytes,
+		Spaces:      transformer.spaces,
+		IsBeginning: transformer.isBeginning,
+	})
+}
+
+func (transformer *TrimSpacesTransformer) LoadState(state []byte) error {
+	var loaded trimSpacesState
+	if err := json.Unmarshal(state, &loaded); err != nil {
+		return err
 	}
-	return []byte(string(text))
+	transformer.state.restBytes = loaded.Rest
+	transformer.spaces = append(make([]byte, 0), loaded.Spaces...)
+	transformer.isBeginning = loaded.IsBeginning
+	return nil
 }
 
-func NewTrimSpacesTransformer(state *ParseState) *TrimSpacesTransformer {
+func NewTrimSpacesTransformer() *TrimSpacesTransformer {
 	return &TrimSpacesTransformer{
-		state:       state,
-		spaces:      make([]rune, 0),
+		spaces:      make([]byte, 0),
 		isBeginning: true,
 	}
 }
@@ -108,7 +223,24 @@ type TransformerWriter struct {
 }
 
 func (writer *TransformerWriter) Write(bs []byte) (n int, err error) {
-	return writer.writer.Write(writer.transformer.Transform(bs))
+	transformed, err := writer.transformer.Transform(bs)
+	if _, writeErr := writer.writer.Write(transformed); writeErr != nil {
+		return 0, writeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(bs), nil
+}
+
+// Close writes what the transformer held back, it doesn't close the
+// underlying writer.
+func (writer *TransformerWriter) Close() error {
+	transformed, err := writer.transformer.Flush()
+	if _, writeErr := writer.writer.Write(transformed); writeErr != nil {
+		return writeErr
+	}
+	return err
 }
 
 func NewTransformerWriter(writer io.Writer, transformer Transformer) *TransformerWriter {
@@ -118,22 +250,7 @@ func NewTransformerWriter(writer io.Writer, transformer Transformer) *Transforme
 	}
 }
 
-// returns parsed runes and number of parsed bytes
-func parseRunes(bs []byte) ([]rune, int) {
-	result := make([]rune, 0, utf8.RuneCount(bs))
-	resultSize := 0
-	for {
-		r, size := utf8.DecodeRune(bs)
-		if r == utf8.RuneError {
-			break
-		}
-		bs = bs[size:]
-		resultSize += size
-		result = append(result, r)
-	}
-	return result, resultSize
-}
-
+// ParseState keeps a rune split between blocks, every transformer has its own.
 type ParseState struct {
 	restBytes []byte
 }
@@ -142,13 +259,56 @@ func (state *ParseState) GetAllBytes(bs []byte) []byte {
 	return append(state.restBytes, bs...)
 }
 
+// ParseRunes calls fn for every rune of the rest bytes followed by bs, raw
+// is the byte itself when it isn't valid utf-8. An incomplete rune at the
+// end is kept until the next call.
+func (state *ParseState) ParseRunes(bs []byte, fn func(r rune, raw []byte)) {
+	allBytes := state.GetAllBytes(bs)
+	for len(allBytes) > 0 && utf8.FullRune(allBytes) {
+		r, size := utf8.DecodeRune(allBytes)
+		if r == utf8.RuneError && size == 1 {
+			fn(r, allBytes[:1])
+		} else {
+			fn(r, nil)
+		}
+		allBytes = allBytes[size:]
+	}
+	state.restBytes = append(state.restBytes[:0:0], allBytes...)
+}
+
+// Flush returns the rest bytes and forgets them.
+func (state *ParseState) Flush() []byte {
+	rest := state.restBytes
+	state.restBytes = nil
+	return rest
+}
+
 type Options struct {
-	From      string
-	To        string
-	Offset    int
-	Limit     int
-	BlockSize int
-	Conv      string
+	From        string
+	To          string
+	Offset      int
+	Limit       int
+	BlockSize   int
+	InputBlock  int
+	OutputBlock int
+	Seek        int
+	Count       int
+	Conv        string
+	FromCharset string
+	ToCharset   string
+	Invalid     string
+	Status      string
+	Hash        string
+	HashOf      string
+	HashTo      string
+	Verify      string
+	Compress    string
+	Decompress  string
+	Parallel    int
+	Checkpoint  string
+	Resume      bool
+	// CheckpointInterval is the least time between checkpoints
+	CheckpointInterval time.Duration
 }
 
 func ParseFlags() (*Options, error) {
@@ -159,7 +319,26 @@ func ParseFlags() (*Options, error) {
 	flag.IntVar(&opts.Offset, "offset", 0, "number of bytes to skip. by default - 0")
 	flag.IntVar(&opts.Limit, "limit", math.MaxInt, "maximum number of bytes to read. by default - max integer value")
 	flag.IntVar(&opts.BlockSize, "block-size", 1024, "file to write. by default - 1024")
-	flag.StringVar(&opts.Conv, "conv", "", "conversions to apply on input data. by default - nothing")
+	flag.IntVar(&opts.InputBlock, "ibs", 0, "size of a block to read. by default - block-size")
+	flag.IntVar(&opts.OutputBlock, "obs", 0, "size of a block to write. by default - block-size")
+	flag.IntVar(&opts.Seek, "seek", 0, "number of bytes to skip in output. by default - 0")
+	flag.IntVar(&opts.Count, "count", math.MaxInt, "maximum number of input blocks to read. by default - max integer value")
+	flag.StringVar(&opts.Conv, "conv", "", "conversions to apply on input data, notrunc, append, excl and sparse tell how to write output. by default - nothing")
+	flag.StringVar(&opts.FromCharset, "from-charset", "", "charset of input: utf-8, utf-16le, utf-16be, cp1251, koi8-r or latin1. by default - utf-8 as is")
+	flag.StringVar(&opts.ToCharset, "to-charset", "", "charset of output, the same as of -from-charset. by default - utf-8 as is")
+	flag.StringVar(&opts.Invalid, "invalid", "replace", "what to do with bytes invalid in -from-charset and characters -to-charset lacks: replace, skip or fail")
+
+	flag.StringVar(&opts.Status, "status", "", "what to report to stderr: progress, noxfer or none. by default - stats on SIGUSR1 only")
+	flag.StringVar(&opts.Hash, "hash", "", "digests to compute: md5, sha1, sha256 or crc32, separated by comma. by default - nothing")
+	flag.StringVar(&opts.HashOf, "hash-of", "output", "stream to compute digests of: input after -offset and -limit, output or both")
+	flag.StringVar(&opts.HashTo, "hash-to", "", "file to write digests to. by default - stderr")
+	flag.StringVar(&opts.Compress, "compress", "", "codec to compress output with: gzip, zstd or xz. by default - nothing")
+	flag.StringVar(&opts.Decompress, "decompress", "", "codec to decompress input with before -offset and -limit: auto, gzip, zstd or xz. by default - nothing")
+	flag.IntVar(&opts.Parallel, "parallel", 1, "number of workers copying parts of a regular file at once, without conversions, digests and codecs. by default - 1")
+	flag.StringVar(&opts.Verify, "verify", "", "digest the output, or the input with -hash-of=input, should have: [algorithm:]hex")
+	flag.StringVar(&opts.Checkpoint, "checkpoint", "", "file to save the state of a copy from -from file to -to file to, so it can be resumed. by default - nothing")
+	flag.DurationVar(&opts.CheckpointInterval, "checkpoint-interval", time.Second, "least time between checkpoints")
+	flag.BoolVar(&opts.Resume, "resume", false, "continue the copy from -checkpoint")
 
 	flag.Parse()
 
@@ -172,31 +351,101 @@ func ParseFlags() (*Options, error) {
 	if opts.BlockSize < 0 {
 		return &opts, errors.New("block-size should not be less than 0")
 	}
+	if opts.InputBlock == 0 {
+		opts.InputBlock = opts.BlockSize
+	}
+	if opts.OutputBlock == 0 {
+		opts.OutputBlock = opts.BlockSize
+	}
+	if opts.InputBlock <= 0 || opts.OutputBlock <= 0 {
+		return &opts, errors.New("ibs and obs should be more than 0")
+	}
+	if opts.Seek < 0 {
+		return &opts, errors.New("seek should not be less than 0")
+	}
+	if opts.Count < 0 {
+		return &opts, errors.New("count should not be less than 0")
+	}
+	if opts.Parallel < 1 {
+		return &opts, errors.New("parallel should be more than 0")
+	}
+	if err := validateCodec(opts.Compress, false); err != nil {
+		return &opts, err
+	}
+	if err := validateCodec(opts.Decompress, true); err != nil {
+		return &opts, err
+	}
+	if opts.HashOf != "input" && opts.HashOf != "output" && opts.HashOf != "both" {
+		return &opts, errors.New("hash-of should be input, output or both")
+	}
+	if opts.Resume && opts.Checkpoint == "" {
+		return &opts, errors.New("resume needs checkpoint")
+	}
+	// a checkpoint refers to offsets in files and codecs can't be restarted
+	// in the middle of a stream
+	if opts.Checkpoint != "" && (opts.From == "" || opts.To == "") {
+		return &opts, errors.New("checkpoint can't be used with stdin or stdout")
+	}
+	if opts.Checkpoint != "" && (opts.Compress != "" || opts.Decompress != "") {
+		return &opts, errors.New("checkpoint can't be used with compress or decompress")
+	}
+	// -count is the same as -limit in bytes
+	if opts.Count <= opts.Limit/opts.InputBlock {
+		opts.Limit = opts.Count * opts.InputBlock
+	}
 
 	return &opts, nil
 }
 
 func run(opts Options) error {
 	conversionsSet := make(map[string]struct{})
-	state := &ParseState{
-		restBytes: make([]byte, 0),
+	transformer := NewTransformersComposer()
+	var outputFlags OutputFlags
+
+	// conversions work with utf-8, so input is decoded before them and
+	// output is encoded after them
+	policy, err := ParseInvalidPolicy(opts.Invalid)
+	if err != nil {
+		return err
+	}
+	status, err := ParseStatusLevel(opts.Status)
+	if err != nil {
+		return err
 	}
-	conversions := map[string]Transformer{
-		"lower_case":  NewLowerCaseTransformer(state),
-		"upper_case":  NewUpperCaseTransformer(state),
-		"trim_spaces": NewTrimSpacesTransformer(state),
+	algorithms, err := ParseHashes(opts.Hash)
+	if err != nil {
+		return err
+	}
+	verifyAlgorithm, verifyDigest, err := ParseVerify(opts.Verify)
+	if err != nil {
+		return err
+	}
+	if opts.FromCharset != "" {
+		from, err := ParseCharset(opts.FromCharset)
+		if err != nil {
+			return err
+		}
+		transformer.AddTransformer(NewCharsetTransformer(from, utf8Charset{}, policy))
 	}
-	transformer := NewTransformersComposer()
 
-	if opts.Conv != "" {
-		for _, conversion := range strings.Split(opts.Conv, ",") {
-			t, ok := conversions[conversion]
-			if !ok {
-				return errors.New("no such convertor:" + conversion)
-			}
-			conversionsSet[conversion] = struct{}{}
-			transformer.AddTransformer(t)
+	parsedConversions, err := ParseConversions(opts.Conv)
+	if err != nil {
+		return err
+	}
+	for _, conversion := range parsedConversions {
+		if conversion.Arg == "" && outputFlags.Set(conversion.Name) {
+			continue
+		}
+		newTransformer, ok := conversions[conversion.Name]
+		if !ok {
+			return errors.New("no such convertor:" + conversion.Name)
 		}
+		t, err := newTransformer(conversion.Arg)
+		if err != nil {
+			return fmt.Errorf("can't use %s conversion: %w", conversion.Name, err)
+		}
+		conversionsSet[conversion.Name] = struct{}{}
+		transformer.AddTransformer(t)
 	}
 
 	_, ok1 := conversionsSet["lower_case"]
@@ -205,6 +454,26 @@ func run(opts Options) error {
 		return errors.New("lower_case conversion can't be used with upper_case conversion")
 	}
 
+	if opts.ToCharset != "" {
+		to, err := ParseCharset(opts.ToCharset)
+		if err != nil {
+			return err
+		}
+		transformer.AddTransformer(NewCharsetTransformer(utf8Charset{}, to, policy))
+	}
+
+	if opts.Checkpoint != "" && outputFlags.Append {
+		return errors.New("checkpoint can't be used with append conversion")
+	}
+	checkpointOpts := opts
+	var checkpoint *Checkpoint
+	if opts.Resume {
+		checkpoint, err = ReadCheckpoint(opts.Checkpoint, opts)
+		if err != nil {
+			return err
+		}
+	}
+
 	input := os.Stdin
 	if opts.From != "" {
 		file, err := os.Open(opts.From)
@@ -214,25 +483,105 @@ func run(opts Options) error {
 		input = file
 	}
 	defer input.Close()
-
-	output := os.Stdout
-	if opts.To != "" {
-		_, err := os.Stat(opts.To)
-		if !os.IsNotExist(err) {
-			return errors.New("output file is already exist")
+	if checkpoint != nil {
+		// the rest of the copy is the input after the checkpoint
+		if _, err := input.Seek(checkpoint.Input, io.SeekStart); err != nil {
+			return fmt.Errorf("can't read from file:%w", err)
 		}
-		file, err := os.Create(opts.To)
+		opts.Limit -= int(checkpoint.Input) - opts.Offset
+		opts.Offset = 0
+	}
+	decompressed, err := NewDecompressReader(NewHoleReader(input), opts.Decompress)
+	if err != nil {
+		return err
+	}
+	defer decompressed.Close()
+
+	// the digests file is opened before the output, so that an existing one
+	// fails the copy before anything is written
+	hashTo := io.Writer(os.Stderr)
+	if len(algorithms) > 0 && opts.HashTo != "" {
+		file, err := OpenHashTo(opts.HashTo, checkpoint != nil)
 		if err != nil {
-			return fmt.Errorf("can't open file:%w", err)
+			return err
 		}
-		output = file
+		defer file.Close()
+		hashTo = file
+	}
+
+	var output *os.File
+	if checkpoint != nil {
+		output, err = OpenResumedOutput(opts.To, checkpoint.Output)
+	} else {
+		output, err = OpenOutput(opts.To, outputFlags, int64(opts.Seek))
+	}
+	if err != nil {
+		return err
 	}
 	defer output.Close()
 
-	block := make([]byte, opts.BlockSize)
-	reader := io.LimitReader(input, int64(opts.Offset))
+	stats := NewStats(time.Now(), inputSize(input, opts))
+	reporter := NewReporter(stats, status, os.Stderr)
+	reporter.Start()
+	defer reporter.Stop()
+
+	// only a plain copy of a regular file can be split between workers,
+	// transformers, digests and codecs need the bytes in order
+	if opts.Parallel > 1 && len(transformer.transformers) == 0 && opts.Compress == "" && opts.Decompress == "" &&
+		len(algorithms) == 0 && verifyAlgorithm == "" && !outputFlags.Sparse && !outputFlags.Append && opts.Checkpoint == "" &&
+		canCopyParallel(input, output) {
+		return copyFileParallel(input, output, opts, stats)
+	}
+
+	blockSize := int64(opts.InputBlock)
+	// -verify checks the output unless only the input is hashed
+	inputDigests, outputDigests := NewDigests(nil, ""), NewDigests(nil, verifyAlgorithm)
+	switch opts.HashOf {
+	case "input":
+		inputDigests, outputDigests = NewDigests(algorithms, verifyAlgorithm), NewDigests(nil, "")
+	case "output":
+		outputDigests = NewDigests(algorithms, verifyAlgorithm)
+	case "both":
+		inputDigests, outputDigests = NewDigests(algorithms, ""), NewDigests(algorithms, verifyAlgorithm)
+	}
+
+	reader := io.TeeReader(io.LimitReader(decompressed, int64(opts.Limit)), inputDigests)
+	target := io.Writer(output)
+	var sparseWriter *SparseWriter
+	if outputFlags.Sparse {
+		// output that can't seek gets zeros as is
+		sparseWriter = NewSparseWriter(output)
+		if sparseWriter != nil {
+			target = sparseWriter
+		}
+	}
+	blockWriter := NewBlockWriter(NewStatsWriter(io.MultiWriter(target, outputDigests), stats, opts.OutputBlock), opts.OutputBlock)
+	compressor, err := NewCompressWriter(blockWriter, opts.Compress)
+	if err != nil {
+		return err
+	}
+	writer := NewTransformerWriter(compressor, transformer)
+
+	// position is the offset in input, checkpoints refer to it
+	position := int64(opts.Offset)
+	var checkpointer *Checkpointer
+	if checkpointOpts.Checkpoint != "" {
+		checkpointer = NewCheckpointer(checkpointOpts, output, transformer, blockWriter, inputDigests, outputDigests)
+		if checkpoint != nil {
+			position = checkpoint.Input
+			if err := checkpointer.Restore(checkpoint); err != nil {
+				return err
+			}
+		}
+		if err := checkpointer.Save(position); err != nil {
+			return err
+		}
+	}
+
+	block := make([]byte, opts.InputBlock)
+	skipped := io.LimitReader(decompressed, int64(opts.Offset))
 	for i := 0; i < opts.Offset; {
-		bytesNum, err := reader.Read(block)
+		bytesNum, err := skipped.Read(block)
 		i += bytesNum
 		if err == io.EOF && i < opts.Offset {
 			return errors.New("offset is more than the file size")
@@ -242,19 +591,95 @@ func run(opts Options) error {
 		}
 	}
 
-	blockSize := int64(opts.BlockSize)
-	reader = io.LimitReader(input, int64(opts.Limit))
-	writer := NewTransformerWriter(output, transformer)
 	for {
-		_, err := io.CopyN(writer, reader, blockSize)
+		bytesNum, err := io.CopyN(writer, reader, blockSize)
+		stats.AddIn(int(bytesNum), opts.InputBlock)
+		position += bytesNum
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return fmt.Errorf("can't copy:%w", err)
+		}
+		if checkpointer != nil {
+			if err := checkpointer.Tick(position); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("can't copy:%w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("can't copy:%w", err)
+	}
+	if err := blockWriter.Close(); err != nil {
+		return fmt.Errorf("can't copy:%w", err)
+	}
+	if sparseWriter != nil {
+		if err := sparseWriter.Close(); err != nil {
+			return err
+		}
+	}
+	if checkpointer != nil {
+		if err := checkpointer.Remove(); err != nil {
+			return err
+		}
+	}
+
+	if len(algorithms) > 0 {
+		if err := reportDigests(hashTo, opts, inputDigests, outputDigests); err != nil {
+			return err
+		}
+	}
+	if verifyAlgorithm != "" {
+		verified := outputDigests
+		if opts.HashOf == "input" {
+			verified = inputDigests
+		}
+		if digest := verified.Sum(verifyAlgorithm); digest != verifyDigest {
+			return fmt.Errorf("%w: expected %s %s, got %s", ErrDigestMismatch, verifyAlgorithm, verifyDigest, digest)
+		}
 	}
 
 	return nil
 }
 
+// reportDigests writes digests of input and output to writer, stdin and
+// stdout are named "-" there.
+func reportDigests(writer io.Writer, opts Options, inputDigests *Digests, outputDigests *Digests) error {
+	inputName, outputName := "-", "-"
+	if opts.From != "" {
+		inputName = opts.From
+	}
+	if opts.To != "" {
+		outputName = opts.To
+	}
+	if err := inputDigests.Report(writer, inputName); err != nil {
+		return err
+	}
+	return outputDigests.Report(writer, outputName)
+}
+
+// inputSize is the number of bytes to copy from a regular file after its
+// current offset, 0 if input isn't one or its size after decompression isn't
+// known.
+func inputSize(input *os.File, opts Options) int64 {
+	info, err := input.Stat()
+	if err != nil || !info.Mode().IsRegular() || opts.Decompress != "" {
+		return 0
+	}
+	position, err := input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0
+	}
+	size := info.Size() - position - int64(opts.Offset)
+	if size > int64(opts.Limit) {
+		size = int64(opts.Limit)
+	}
+	return size
+}
+
 func main() {
 	opts, err := ParseFlags()
 	if err != nil {
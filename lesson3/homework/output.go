@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// OutputFlags are the -conv values that tell how to open the -to file
+// rather than convert the text.
+type OutputFlags struct {
+	// NoTrunc writes into an existing file, keeping the bytes that aren't
+	// overwritten.
+	NoTrunc bool
+	// Append writes to the end of an existing file.
+	Append bool
+	// Excl fails if the file exists, it is what happens by default.
+	Excl bool
+	// Sparse seeks over blocks of zeros instead of writing them.
+	Sparse bool
+}
+
+// Set sets the flag with the conversion name, it returns false if there is
+// no such flag.
+func (flags *OutputFlags) Set(name string) bool {
+	switch name {
+	case "notrunc":
+		flags.NoTrunc = true
+	case "append":
+		flags.Append = true
+	case "excl":
+		flags.Excl = true
+	case "sparse":
+		flags.Sparse = true
+	default:
+		return false
+	}
+	return true
+}
+
+func (flags *OutputFlags) fileFlags() (int, error) {
+	if flags.Excl && (flags.NoTrunc || flags.Append) {
+		return 0, errors.New("excl conversion can't be used with notrunc or append conversions")
+	}
+	switch {
+	case flags.Append:
+		return os.O_WRONLY | os.O_CREATE | os.O_APPEND, nil
+	case flags.NoTrunc:
+		return os.O_WRONLY | os.O_CREATE, nil
+	default:
+		return os.O_WRONLY | os.O_CREATE | os.O_EXCL, nil
+	}
+}
+
+// OpenOutput opens the -to file, stdout if it is empty, and skips seek bytes
+// of it.
+func OpenOutput(name string, flags OutputFlags, seek int64) (*os.File, error) {
+	fileFlags, err := flags.fileFlags()
+	if err != nil {
+		return nil, err
+	}
+	if seek > 0 && flags.Append {
+		return nil, errors.New("seek can't be used with append conversion")
+	}
+	if flags.Sparse && flags.Append {
+		return nil, errors.New("sparse conversion can't be used with append conversion")
+	}
+
+	output := os.Stdout
+	if name != "" {
+		output, err = os.OpenFile(name, fileFlags, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			return nil, errors.New("output file is already exist")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't open file:%w", err)
+		}
+	}
+
+	if seek == 0 {
+		return output, nil
+	}
+	if _, err := output.Seek(seek, io.SeekStart); err != nil {
+		// pipes and terminals can't seek, the skipped bytes are zeros there
+		if _, err := io.CopyN(output, zeroReader{}, seek); err != nil {
+			output.Close()
+			return nil, fmt.Errorf("can't seek output:%w", err)
+		}
+	}
+	return output, nil
+}
+
+// OpenResumedOutput opens the -to file of an interrupted copy to write from
+// offset. The file is extended up to offset if it ends with a hole.
+func OpenResumedOutput(name string, offset int64) (*os.File, error) {
+	output, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't open file:%w", err)
+	}
+	info, err := output.Stat()
+	if err == nil && info.Size() < offset {
+		err = output.Truncate(offset)
+	}
+	if err == nil {
+		_, err = output.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		output.Close()
+		return nil, fmt.Errorf("can't seek output:%w", err)
+	}
+	return output, nil
+}
+
+// OpenHashTo opens the -hash-to file, it fails if the file exists like -to
+// does. A resumed copy writes to the empty file its interrupted run opened.
+func OpenHashTo(name string, resume bool) (*os.File, error) {
+	if !resume {
+		return OpenOutput(name, OutputFlags{}, 0)
+	}
+	file, err := OpenOutput(name, OutputFlags{NoTrunc: true}, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("can't open file:%w", err)
+	}
+	if info.Size() > 0 {
+		file.Close()
+		return nil, errors.New("hash file isn't empty")
+	}
+	return file, nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// BlockWriter writes blocks of exactly size bytes, only the last one written
+// by Close may be shorter.
+type BlockWriter struct {
+	writer io.Writer
+	block  []byte
+}
+
+func (writer *BlockWriter) Write(bs []byte) (int, error) {
+	n := 0
+	for len(bs) > 0 {
+		free := cap(writer.block) - len(writer.block)
+		if free > len(bs) {
+			free = len(bs)
+		}
+		writer.block = append(writer.block, bs[:free]...)
+		bs = bs[free:]
+		n += free
+		if len(writer.block) == cap(writer.block) {
+			if err := writer.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last block, it doesn't close the underlying writer.
+func (writer *BlockWriter) Close() error {
+	if len(writer.block) == 0 {
+		return nil
+	}
+	return writer.flush()
+}
+
+func (writer *BlockWriter) flush() error {
+	_, err := writer.writer.Write(writer.block)
+	writer.block = writer.block[:0]
+	return err
+}
+
+func NewBlockWriter(writer io.Writer, size int) *BlockWriter {
+	return &BlockWriter{
+		writer: writer,
+		block:  make([]byte, 0, size),
+	}
+}
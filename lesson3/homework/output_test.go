@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// assertGolden compares actual with testdata/name.golden, -update rewrites it.
+func assertGolden(t *testing.T, name string, actual []byte) {
+	golden := filepath.Join("testdata", strings.ReplaceAll(name, " ", "_")+".golden")
+	if *update {
+		assert.NoError(t, os.MkdirAll("testdata", 0o755))
+		assert.NoError(t, os.WriteFile(golden, actual, 0o644))
+	}
+	expected, err := os.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func TestOutputModes(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	const existing = "0123456789\n"
+	tests := []struct {
+		name string
+		args []string
+		// existing is written to the output file before the run if not empty
+		existing string
+		input    string
+		toFile   bool
+		err      bool
+	}{
+		{name: "seek in new file", args: []string{"-seek", "3"}, input: "hello\n", toFile: true},
+		{name: "seek in stdout", args: []string{"-seek", "3"}, input: "hello\n"},
+		{name: "notrunc", args: []string{"-conv", "notrunc", "-seek", "2"}, existing: existing, input: "abc", toFile: true},
+		{name: "notrunc past the end", args: []string{"-conv", "notrunc", "-seek", "9"}, existing: existing, input: "abc\n", toFile: true},
+		{name: "notrunc with conversions", args: []string{"-conv", "upper_case,notrunc", "-block-size", "1"}, existing: existing, input: "привет", toFile: true},
+		{name: "append", args: []string{"-conv", "append"}, existing: existing, input: "appended\n", toFile: true},
+		{name: "append with notrunc", args: []string{"-conv", "notrunc,append"}, existing: existing, input: "appended\n", toFile: true},
+		{name: "excl", args: []string{"-conv", "excl"}, input: "hello\n", toFile: true},
+		{name: "count", args: []string{"-count", "3", "-ibs", "7"}, input: testInput},
+		{name: "count after offset", args: []string{"-count", "2", "-block-size", "10", "-offset", "3"}, input: "0123456789abcdefghijklmnopqrstuvwxyz"},
+		{name: "limit less than count", args: []string{"-count", "4", "-ibs", "10", "-limit", "15"}, input: "0123456789abcdefghijklmnopqrstuvwxyz"},
+		{name: "zero count", args: []string{"-count", "0"}, input: testInput},
+		{name: "ibs and obs", args: []string{"-ibs", "3", "-obs", "7", "-conv", "trim_spaces,lower_case"}, input: testInput},
+		{name: "excl with existing file", args: []string{"-conv", "excl"}, existing: existing, input: "hello\n", toFile: true, err: true},
+		{name: "existing file", existing: existing, input: "hello\n", toFile: true, err: true},
+		{name: "excl with notrunc", args: []string{"-conv", "excl,notrunc"}, input: "hello\n", toFile: true, err: true},
+		{name: "seek with append", args: []string{"-conv", "append", "-seek", "1"}, existing: existing, input: "hello\n", toFile: true, err: true},
+		{name: "negative seek", args: []string{"-seek", "-1"}, input: "hello\n", err: true},
+		{name: "negative count", args: []string{"-count", "-1"}, input: "hello\n", err: true},
+		{name: "negative ibs", args: []string{"-ibs", "-1"}, input: "hello\n", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out.txt")
+			if test.existing != "" {
+				assert.NoError(t, os.WriteFile(output, []byte(test.existing), 0o644))
+			}
+			args := test.args
+			if test.toFile {
+				args = append(args, "-to", output)
+			}
+			cmd = exec.Command(binPath, args...)
+			cmd.Stdin = strings.NewReader(test.input)
+			stdout := &bytes.Buffer{}
+			cmd.Stdout = stdout
+			stderr := &strings.Builder{}
+			cmd.Stderr = stderr
+
+			err := cmd.Run()
+
+			if test.err {
+				assert.Error(t, err)
+				assert.NotZero(t, stderr.Len())
+				assert.Zero(t, stdout.Len())
+				if test.existing != "" {
+					data, err := os.ReadFile(output)
+					assert.NoError(t, err)
+					assert.Equal(t, test.existing, string(data), "output file isn't changed")
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Zero(t, stderr.Len(), stderr.String())
+			if !test.toFile {
+				assertGolden(t, test.name, stdout.Bytes())
+				return
+			}
+			assert.Zero(t, stdout.Len())
+			data, err := os.ReadFile(output)
+			assert.NoError(t, err)
+			assertGolden(t, test.name, data)
+		})
+	}
+}
+
+// blockSizes records sizes of the writes.
+type blockSizes []int
+
+func (sizes *blockSizes) Write(bs []byte) (int, error) {
+	*sizes = append(*sizes, len(bs))
+	return len(bs), nil
+}
+
+func TestBlockWriter(t *testing.T) {
+	sizes := blockSizes{}
+	writer := NewBlockWriter(&sizes, 4)
+	for _, chunk := range []string{"a", "bcdefghij", "", "kl", "m"} {
+		n, err := writer.Write([]byte(chunk))
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	assert.Equal(t, blockSizes{4, 4, 4}, sizes)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, blockSizes{4, 4, 4, 1}, sizes)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, blockSizes{4, 4, 4, 1}, sizes, "nothing left to write")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// CopyParallel copies size bytes of input from inputOffset to output from
+// outputOffset. The bytes are split into ranges copied by workers at once,
+// ranges are whole input and output blocks, so records are counted the same
+// as in a sequential copy.
+func CopyParallel(input io.ReaderAt, output io.WriterAt, inputOffset int64, outputOffset int64, size int64, workers int, opts Options, stats *Stats) error {
+	chunk := lcm(int64(opts.InputBlock), int64(opts.OutputBlock))
+	rangeSize := (size/int64(workers) + chunk - 1) / chunk * chunk
+	if rangeSize == 0 {
+		rangeSize = chunk
+	}
+
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for start := int64(0); start < size; start += rangeSize {
+		length := rangeSize
+		if length > size-start {
+			length = size - start
+		}
+		wg.Add(1)
+		go func(start int64, length int64) {
+			defer wg.Done()
+			errs <- copyRange(input, output, inputOffset+start, outputOffset+start, length, opts, stats)
+		}(start, length)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyRange(input io.ReaderAt, output io.WriterAt, inputOffset int64, outputOffset int64, length int64, opts Options, stats *Stats) error {
+	reader := io.NewSectionReader(input, inputOffset, length)
+	writer := NewBlockWriter(NewStatsWriter(&offsetWriter{writer: output, offset: outputOffset}, stats, opts.OutputBlock), opts.OutputBlock)
+	for {
+		bytesNum, err := io.CopyN(writer, reader, int64(opts.InputBlock))
+		stats.AddIn(int(bytesNum), opts.InputBlock)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// offsetWriter writes to writer sequentially from offset.
+type offsetWriter struct {
+	writer io.WriterAt
+	offset int64
+}
+
+func (writer *offsetWriter) Write(p []byte) (int, error) {
+	n, err := writer.writer.WriteAt(p, writer.offset)
+	writer.offset += int64(n)
+	return n, err
+}
+
+func lcm(a int64, b int64) int64 {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
+
+// canCopyParallel tells if files are regular ones, so they can be read and
+// written at any offset, and the size of input is what there is to read.
+// Files of procfs and sysfs have zero or a page size whatever they contain,
+// they are copied in order until the end.
+func canCopyParallel(input *os.File, output *os.File) bool {
+	for _, file := range []*os.File{input, output} {
+		info, err := file.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+	}
+	info, err := input.Stat()
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+	return !onPseudoFileSystem(input)
+}
+
+// copyFileParallel copies input from -offset up to -limit bytes to output
+// from its current offset.
+func copyFileParallel(input *os.File, output *os.File, opts Options, stats *Stats) error {
+	inputOffset, err := input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("can't read from file:%w", err)
+	}
+	outputOffset, err := output.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("can't write to file:%w", err)
+	}
+	info, err := input.Stat()
+	if err != nil {
+		return fmt.Errorf("can't read from file:%w", err)
+	}
+	inputOffset += int64(opts.Offset)
+	if inputOffset > info.Size() {
+		return errors.New("offset is more than the file size")
+	}
+	size := info.Size() - inputOffset
+	if size > int64(opts.Limit) {
+		size = int64(opts.Limit)
+	}
+
+	if err := CopyParallel(input, output, inputOffset, outputOffset, size, opts.Parallel, opts, stats); err != nil {
+		return fmt.Errorf("can't copy:%w", err)
+	}
+
+	// the file may grow while it is copied, the rest is copied in order up
+	// to the end it has then
+	grown, err := input.Stat()
+	if err != nil {
+		return fmt.Errorf("can't read from file:%w", err)
+	}
+	if grown.Size() <= info.Size() || size == int64(opts.Limit) {
+		return nil
+	}
+	start := inputOffset + size
+	rest := int64(opts.Limit) - size
+	if rest > math.MaxInt64-start {
+		rest = math.MaxInt64 - start
+	}
+	if err := copyRange(input, output, start, outputOffset+size, rest, opts, stats); err != nil {
+		return fmt.Errorf("can't copy:%w", err)
+	}
+	return nil
+}
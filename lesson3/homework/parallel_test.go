@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallel(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.bin")
+	data := make([]byte, 3<<20+123)
+	_, err := rand.Read(data)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(input, data, 0o644))
+
+	run := func(t *testing.T, args ...string) ([]byte, string) {
+		output := filepath.Join(t.TempDir(), "out.bin")
+		cmd = exec.Command(binPath, append(args, "-from", input, "-to", output, "-status", "noxfer")...)
+		stderr := &strings.Builder{}
+		cmd.Stderr = stderr
+		assert.NoError(t, cmd.Run(), stderr.String())
+		result, err := os.ReadFile(output)
+		assert.NoError(t, err)
+		return result, stderr.String()
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "whole file", args: []string{"-block-size", "65536"}},
+		{name: "small blocks", args: []string{"-block-size", "1000"}},
+		{name: "ibs and obs", args: []string{"-ibs", "4096", "-obs", "1536"}},
+		{name: "offset and limit", args: []string{"-offset", "12345", "-limit", "1000001", "-block-size", "4096"}},
+		{name: "count and seek", args: []string{"-count", "100", "-ibs", "3000", "-seek", "777"}},
+		{name: "more workers than blocks", args: []string{"-limit", "5000", "-block-size", "4096"}},
+		{name: "conversions fall back", args: []string{"-conv", "upper_case", "-block-size", "4096"}},
+		{name: "digests fall back", args: []string{"-hash", "md5", "-hash-of", "input", "-block-size", "4096"}},
+		{name: "sparse falls back", args: []string{"-conv", "sparse", "-block-size", "4096"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, expectedStats := run(t, test.args...)
+			for _, workers := range []int{2, 3, 8} {
+				result, stats := run(t, append(test.args, "-parallel", strconv.Itoa(workers))...)
+				assert.Equal(t, expected, result, "%d workers", workers)
+				assert.Equal(t, expectedStats, stats, "%d workers", workers)
+			}
+		})
+	}
+
+	t.Run("notrunc keeps the rest of the file", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "out.bin")
+		existing := bytes.Repeat([]byte("x"), 5<<20)
+		assert.NoError(t, os.WriteFile(output, existing, 0o644))
+		cmd = exec.Command(binPath, "-from", input, "-to", output, "-conv", "notrunc", "-seek", "100", "-parallel", "4")
+		assert.NoError(t, cmd.Run())
+
+		result, err := os.ReadFile(output)
+		assert.NoError(t, err)
+		copy(existing[100:], data)
+		assert.Equal(t, existing, result)
+	})
+
+	t.Run("procfs falls back", func(t *testing.T) {
+		expected, err := os.ReadFile("/proc/version")
+		if err != nil {
+			t.Skip("there is no procfs")
+		}
+		output := filepath.Join(t.TempDir(), "out.bin")
+		cmd = exec.Command(binPath, "-from", "/proc/version", "-to", output, "-parallel", "4")
+		assert.NoError(t, cmd.Run())
+		result, err := os.ReadFile(output)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, result)
+		assert.Equal(t, expected, result)
+	})
+
+	t.Run("stdin falls back", func(t *testing.T) {
+		cmd = exec.Command(binPath, "-parallel", "4")
+		cmd.Stdin = bytes.NewReader(data)
+		stdout := &bytes.Buffer{}
+		cmd.Stdout = stdout
+		assert.NoError(t, cmd.Run())
+		assert.Equal(t, data, stdout.Bytes())
+	})
+
+	for _, args := range [][]string{{"-parallel", "0"}, {"-parallel", "4", "-offset", strconv.Itoa(len(data) + 1)}} {
+		t.Run("error with "+strings.Join(args, " "), func(t *testing.T) {
+			cmd = exec.Command(binPath, append(args, "-from", input, "-to", filepath.Join(t.TempDir(), "out.bin"))...)
+			stderr := &strings.Builder{}
+			cmd.Stderr = stderr
+			assert.Error(t, cmd.Run())
+			assert.NotZero(t, stderr.Len())
+		})
+	}
+}
+
+func TestCanCopyParallel(t *testing.T) {
+	dir := t.TempDir()
+	output, err := os.Create(filepath.Join(dir, "out.bin"))
+	assert.NoError(t, err)
+	defer output.Close()
+
+	open := func(path string) *os.File {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Skipf("can't open %s: %v", path, err)
+		}
+		t.Cleanup(func() { file.Close() })
+		return file
+	}
+	regular := filepath.Join(dir, "in.bin")
+	assert.NoError(t, os.WriteFile(regular, []byte(testInput), 0o644))
+	empty := filepath.Join(dir, "empty.bin")
+	assert.NoError(t, os.WriteFile(empty, nil, 0o644))
+
+	assert.True(t, canCopyParallel(open(regular), output))
+	assert.False(t, canCopyParallel(open(empty), output), "files of zero size may be read past it")
+	t.Run("procfs", func(t *testing.T) {
+		assert.False(t, canCopyParallel(open("/proc/version"), output))
+	})
+	t.Run("sysfs", func(t *testing.T) {
+		assert.False(t, canCopyParallel(open("/sys/devices/system/cpu/online"), output))
+	})
+}
+
+// rangesWriter is a WriterAt that records offsets of the writes.
+type rangesWriter struct {
+	mu      sync.Mutex
+	data    []byte
+	offsets []int64
+}
+
+func (w *rangesWriter) WriteAt(p []byte, offset int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	copy(w.data[offset:], p)
+	w.offsets = append(w.offsets, offset)
+	return len(p), nil
+}
+
+func TestCopyParallel(t *testing.T) {
+	data := []byte(strings.Repeat(testInput, 10))
+	opts := Options{InputBlock: 100, OutputBlock: 150}
+	stats := NewStats(time.Now(), 0)
+	output := &rangesWriter{data: make([]byte, len(data)+10)}
+
+	err := CopyParallel(bytes.NewReader(data), output, 0, 10, int64(len(data)), 4, opts, stats)
+
+	assert.NoError(t, err)
+	assert.Equal(t, data, output.data[10:])
+	// 4 ranges start at multiples of 300 bytes, lcm of the blocks
+	rangeSize := int64(math.Ceil(float64(len(data))/4/300) * 300)
+	for i := int64(0); i < 4; i++ {
+		assert.Contains(t, output.offsets, 10+i*rangeSize)
+	}
+	assert.Equal(t, int64(len(data)/100), stats.fullIn.Load())
+	assert.Equal(t, int64(1), stats.partialIn.Load())
+	assert.Equal(t, int64(len(data)/150), stats.fullOut.Load())
+}
+
+func BenchmarkCopy(b *testing.B) {
+	dir := b.TempDir()
+	input := filepath.Join(dir, "in.bin")
+	data := make([]byte, 256<<20)
+	_, err := rand.Read(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(input, data, 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run("parallel "+strconv.Itoa(workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				output := filepath.Join(dir, "out.bin")
+				err := run(Options{
+					From:        input,
+					To:          output,
+					Limit:       math.MaxInt,
+					InputBlock:  1 << 20,
+					OutputBlock: 1 << 20,
+					Count:       math.MaxInt,
+					Invalid:     "replace",
+					HashOf:      "output",
+					Parallel:    workers,
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if err := os.Remove(output); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
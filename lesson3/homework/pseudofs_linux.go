@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// magic numbers of file systems whose files are generated when they are
+// read, their sizes are zero or a page whatever the contents are
+var pseudoFileSystems = map[int64]struct{}{
+	0x9fa0:     {}, // proc
+	0x62656572: {}, // sysfs
+	0x64626720: {}, // debugfs
+	0x74726163: {}, // tracefs
+	0x73636673: {}, // securityfs
+	0x27e0eb:   {}, // cgroup
+	0x63677270: {}, // cgroup2
+	0x62656570: {}, // configfs
+}
+
+// onPseudoFileSystem tells if the size of file says nothing about how much
+// can be read from it.
+func onPseudoFileSystem(file *os.File) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Fstatfs(int(file.Fd()), &stat); err != nil {
+		return false
+	}
+	_, ok := pseudoFileSystems[int64(stat.Type)]
+	return ok
+}
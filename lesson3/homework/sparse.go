@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// SparseWriter seeks over blocks of zeros instead of writing them, so they
+// become holes in the file. With notrunc conversion the old data stays
+// where the zeros are.
+type SparseWriter struct {
+	file *os.File
+	// holeAtEnd tells that the last block was skipped, so the file should
+	// be extended up to the offset
+	holeAtEnd bool
+}
+
+func (writer *SparseWriter) Write(bs []byte) (int, error) {
+	if !isZero(bs) {
+		writer.holeAtEnd = false
+		return writer.file.Write(bs)
+	}
+	if _, err := writer.file.Seek(int64(len(bs)), io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	writer.holeAtEnd = len(bs) > 0 || writer.holeAtEnd
+	return len(bs), nil
+}
+
+// Close extends the file if it ends with a hole, it doesn't close the file.
+func (writer *SparseWriter) Close() error {
+	if !writer.holeAtEnd {
+		return nil
+	}
+	offset, err := writer.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("can't extend file:%w", err)
+	}
+	info, err := writer.file.Stat()
+	if err != nil {
+		return fmt.Errorf("can't extend file:%w", err)
+	}
+	if info.Size() >= offset {
+		return nil
+	}
+	if err := writer.file.Truncate(offset); err != nil {
+		return fmt.Errorf("can't extend file:%w", err)
+	}
+	return nil
+}
+
+// NewSparseWriter returns nil if file can't seek, e.g. it is a pipe.
+func NewSparseWriter(file *os.File) *SparseWriter {
+	if _, err := file.Seek(0, io.SeekCurrent); err != nil {
+		return nil
+	}
+	return &SparseWriter{file: file}
+}
+
+func isZero(bs []byte) bool {
+	for _, b := range bs {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
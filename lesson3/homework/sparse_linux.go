@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// whence values of lseek finding data and holes, syscall lacks them
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// HoleReader reads a sparse file, holes are returned as zeros without
+// reading them from disk.
+type HoleReader struct {
+	file   *os.File
+	size   int64
+	offset int64
+	// data and hole are the bounds of the data region around offset, the
+	// region before data is a hole
+	data int64
+	hole int64
+}
+
+func (reader *HoleReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		// the file may grow while it is copied, the rest is read as is
+		return reader.readAt(p)
+	}
+	if reader.offset >= reader.hole {
+		reader.findData()
+	}
+
+	if reader.offset < reader.data {
+		n := len(p)
+		if int64(n) > reader.data-reader.offset {
+			n = int(reader.data - reader.offset)
+		}
+		for i := range p[:n] {
+			p[i] = 0
+		}
+		reader.offset += int64(n)
+		return n, nil
+	}
+
+	if int64(len(p)) > reader.hole-reader.offset {
+		p = p[:reader.hole-reader.offset]
+	}
+	return reader.readAt(p)
+}
+
+func (reader *HoleReader) readAt(p []byte) (int, error) {
+	n, err := reader.file.ReadAt(p, reader.offset)
+	reader.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// findData finds the next data region, the whole rest is data if the file
+// system can't tell.
+func (reader *HoleReader) findData() {
+	reader.data, reader.hole = reader.offset, reader.size
+	data, err := reader.file.Seek(reader.offset, seekData)
+	if errors.Is(err, syscall.ENXIO) {
+		// no data up to the end
+		reader.data = reader.size
+		return
+	}
+	if err != nil {
+		return
+	}
+	hole, err := reader.file.Seek(data, seekHole)
+	if err != nil {
+		return
+	}
+	reader.data, reader.hole = data, hole
+}
+
+// NewHoleReader reads holes of a regular file without reading them, other
+// files are read as is. So are files the file system can't find data in and
+// files of zero size, procfs files have it but aren't empty.
+func NewHoleReader(file *os.File) io.Reader {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return file
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return file
+	}
+	if _, err := file.Seek(offset, seekData); err != nil && !errors.Is(err, syscall.ENXIO) {
+		return file
+	}
+	// the position is where the copy starts
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return file
+	}
+	return &HoleReader{
+		file:   file,
+		size:   info.Size(),
+		offset: offset,
+		data:   offset,
+		hole:   offset,
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// sparseSize is the size of a sparse file with data in its first and
+	// middle 64KiB, the rest is holes
+	sparseSize = 16 << 20
+	dataSize   = 64 << 10
+)
+
+// createSparseFile returns the name of the file, the test is skipped if the
+// file system doesn't make holes.
+func createSparseFile(t *testing.T, dir string) string {
+	name := filepath.Join(dir, "disk.img")
+	file, err := os.Create(name)
+	assert.NoError(t, err)
+	defer file.Close()
+	_, err = file.Write(bytes.Repeat([]byte("a"), dataSize))
+	assert.NoError(t, err)
+	_, err = file.WriteAt(bytes.Repeat([]byte("b"), dataSize), sparseSize/2)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Truncate(sparseSize))
+
+	if allocated(t, name) >= sparseSize {
+		t.Skip("file system doesn't support sparse files")
+	}
+	return name
+}
+
+// allocated is the number of bytes allocated on disk for the file.
+func allocated(t *testing.T, name string) int64 {
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+func TestSparse(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	dir := t.TempDir()
+	input := createSparseFile(t, dir)
+	expected, err := os.ReadFile(input)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		args []string
+		// sparse tells that output should take no more space than input
+		sparse bool
+	}{
+		{name: "sparse", args: []string{"-conv", "sparse", "-block-size", "4096"}, sparse: true},
+		{name: "sparse with large blocks", args: []string{"-conv", "sparse", "-ibs", "65536", "-obs", "65536"}, sparse: true},
+		{name: "sparse with conversions", args: []string{"-conv", "sparse,upper_case", "-block-size", "4096"}, sparse: true},
+		{name: "not sparse", args: []string{"-block-size", "4096"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "copy.img")
+			cmd = exec.Command(binPath, append(test.args, "-from", input, "-to", output)...)
+			stderr := &strings.Builder{}
+			cmd.Stderr = stderr
+
+			err := cmd.Run()
+
+			assert.NoError(t, err)
+			assert.Zero(t, stderr.Len(), stderr.String())
+			data, err := os.ReadFile(output)
+			assert.NoError(t, err)
+			if strings.Contains(test.name, "conversions") {
+				assert.Equal(t, bytes.ToUpper(expected), data)
+			} else {
+				assert.Equal(t, expected, data)
+			}
+
+			if test.sparse {
+				assert.LessOrEqual(t, allocated(t, output), allocated(t, input))
+			} else {
+				assert.GreaterOrEqual(t, allocated(t, output), int64(sparseSize))
+			}
+		})
+	}
+
+	t.Run("sparse with trailing hole and seek", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "copy.img")
+		cmd = exec.Command(binPath, "-conv", "sparse", "-seek", strconv.Itoa(1<<20), "-to", output)
+		cmd.Stdin = bytes.NewReader(append([]byte("data"), make([]byte, 1<<20)...))
+
+		assert.NoError(t, cmd.Run())
+		info, err := os.Stat(output)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2<<20+4), info.Size(), "the file is extended up to the trailing hole")
+		assert.Less(t, allocated(t, output), int64(1<<20))
+	})
+
+	t.Run("sparse to pipe", func(t *testing.T) {
+		cmd = exec.Command(binPath, "-conv", "sparse", "-from", input, "-block-size", "65536")
+		stdout := &bytes.Buffer{}
+		cmd.Stdout = stdout
+
+		assert.NoError(t, cmd.Run())
+		assert.Equal(t, expected, stdout.Bytes())
+	})
+
+	t.Run("error with sparse and append", func(t *testing.T) {
+		cmd = exec.Command(binPath, "-conv", "sparse,append", "-from", input, "-to", filepath.Join(t.TempDir(), "copy.img"))
+		stderr := &strings.Builder{}
+		cmd.Stderr = stderr
+
+		assert.Error(t, cmd.Run())
+		assert.Contains(t, stderr.String(), "sparse")
+	})
+}
+
+func TestHoleReader(t *testing.T) {
+	name := createSparseFile(t, t.TempDir())
+	expected, err := os.ReadFile(name)
+	assert.NoError(t, err)
+
+	for _, size := range []int{1000, 4096, 1 << 20} {
+		t.Run("buffer "+strconv.Itoa(size), func(t *testing.T) {
+			file, err := os.Open(name)
+			assert.NoError(t, err)
+			defer file.Close()
+			_, err = file.Seek(100, io.SeekStart)
+			assert.NoError(t, err)
+			reader := NewHoleReader(file)
+			assert.IsType(t, &HoleReader{}, reader)
+
+			data := make([]byte, 0, len(expected))
+			buffer := make([]byte, size)
+			for {
+				n, err := reader.Read(buffer)
+				data = append(data, buffer[:n]...)
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, expected[100:], data)
+		})
+	}
+
+	t.Run("file growing while read", func(t *testing.T) {
+		file, err := os.OpenFile(name, os.O_RDWR, 0)
+		assert.NoError(t, err)
+		defer file.Close()
+		reader := NewHoleReader(file)
+		assert.IsType(t, &HoleReader{}, reader)
+		_, err = file.WriteAt([]byte("appended"), sparseSize)
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, append(expected, "appended"...), data)
+	})
+}
+
+func TestHoleReaderProcfs(t *testing.T) {
+	expected, err := os.ReadFile("/proc/version")
+	if err != nil {
+		t.Skip("there is no procfs")
+	}
+	file, err := os.Open("/proc/version")
+	assert.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	data, err := io.ReadAll(NewHoleReader(file))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+	assert.Equal(t, expected, data)
+}
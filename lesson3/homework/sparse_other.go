@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// NewHoleReader reads file as is, there is no SEEK_DATA and SEEK_HOLE here.
+func NewHoleReader(file *os.File) io.Reader {
+	return file
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatusLevel tells what is reported to stderr while copying.
+type StatusLevel int
+
+const (
+	// StatusDefault reports only on SIGUSR1.
+	StatusDefault StatusLevel = iota
+	// StatusNone never reports.
+	StatusNone
+	// StatusNoXfer reports records in and out at the end.
+	StatusNoXfer
+	// StatusProgress reports progress every second and the whole summary
+	// at the end.
+	StatusProgress
+)
+
+var statusLevels = map[string]StatusLevel{
+	"":         StatusDefault,
+	"none":     StatusNone,
+	"noxfer":   StatusNoXfer,
+	"progress": StatusProgress,
+}
+
+func ParseStatusLevel(s string) (StatusLevel, error) {
+	level, ok := statusLevels[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown status %q, expected progress, noxfer or none", s)
+	}
+	return level, nil
+}
+
+// Stats counts copied records and bytes, reports read it while copying.
+type Stats struct {
+	fullIn     atomic.Int64
+	partialIn  atomic.Int64
+	fullOut    atomic.Int64
+	partialOut atomic.Int64
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+	start      time.Time
+	// total is the number of bytes to read, 0 if it isn't known
+	total int64
+}
+
+func NewStats(start time.Time, total int64) *Stats {
+	return &Stats{start: start, total: total}
+}
+
+// AddIn counts a block of n bytes read, it is full if n is blockSize.
+func (stats *Stats) AddIn(n int, blockSize int) {
+	addRecord(&stats.fullIn, &stats.partialIn, n, blockSize)
+	stats.bytesIn.Add(int64(n))
+}
+
+// AddOut counts a block of n bytes written.
+func (stats *Stats) AddOut(n int, blockSize int) {
+	addRecord(&stats.fullOut, &stats.partialOut, n, blockSize)
+	stats.bytesOut.Add(int64(n))
+}
+
+func addRecord(full *atomic.Int64, partial *atomic.Int64, n int, blockSize int) {
+	switch {
+	case n == blockSize:
+		full.Add(1)
+	case n > 0:
+		partial.Add(1)
+	}
+}
+
+// Summary is the report of dd, xfer adds the line with bytes and speed.
+func (stats *Stats) Summary(now time.Time, xfer bool) string {
+	summary := fmt.Sprintf("%d+%d records in\n%d+%d records out\n",
+		stats.fullIn.Load(), stats.partialIn.Load(), stats.fullOut.Load(), stats.partialOut.Load())
+	if xfer {
+		summary += stats.transfer(now) + "\n"
+	}
+	return summary
+}
+
+// Progress is a line with bytes, speed and time left if the input size is
+// known.
+func (stats *Stats) Progress(now time.Time) string {
+	progress := stats.transfer(now)
+	elapsed := now.Sub(stats.start).Seconds()
+	bytesIn := stats.bytesIn.Load()
+	if stats.total > 0 && bytesIn > 0 && elapsed > 0 {
+		left := float64(stats.total-bytesIn) / (float64(bytesIn) / elapsed)
+		progress += ", ETA " + (time.Duration(math.Max(left, 0)) * time.Second).String()
+	}
+	return progress
+}
+
+func (stats *Stats) transfer(now time.Time) string {
+	bytes := stats.bytesOut.Load()
+	elapsed := now.Sub(stats.start).Seconds()
+	size := ""
+	if bytes >= 1000 {
+		size = fmt.Sprintf(" (%s, %s)", humanSize(float64(bytes), 1000), humanSize(float64(bytes), 1024))
+	}
+	rate := "0 B/s"
+	if elapsed > 0 {
+		rate = humanSize(float64(bytes)/elapsed, 1000) + "/s"
+	}
+	return fmt.Sprintf("%d bytes%s copied, %.6f s, %s", bytes, size, elapsed, rate)
+}
+
+// humanSize formats n like dd does: 1.5 kB with base 1000, 1.5 KiB with 1024.
+func humanSize(n float64, base float64) string {
+	prefixes, suffix := "kMGTPE", "B"
+	if base == 1024 {
+		prefixes, suffix = "KMGTPE", "iB"
+	}
+	unit := "B"
+	for i := 0; n >= base && i < len(prefixes); i++ {
+		n /= base
+		unit = prefixes[i:i+1] + suffix
+	}
+	if n < 10 && unit != "B" {
+		return fmt.Sprintf("%.1f %s", n, unit)
+	}
+	return fmt.Sprintf("%.0f %s", n, unit)
+}
+
+// progressInterval is how often progress is reported.
+const progressInterval = time.Second
+
+// Reporter writes stats to stderr while copying, on SIGUSR1 and at the end.
+type Reporter struct {
+	stats  *Stats
+	level  StatusLevel
+	writer io.Writer
+	mu     sync.Mutex
+	// progressLen is the length of the last progress line, it is overwritten
+	// by the next one
+	progressLen int
+	done        chan struct{}
+	stopped     sync.WaitGroup
+}
+
+func NewReporter(stats *Stats, level StatusLevel, writer io.Writer) *Reporter {
+	return &Reporter{
+		stats:  stats,
+		level:  level,
+		writer: writer,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start reports in background until Stop is called.
+func (reporter *Reporter) Start() {
+	if reporter.level == StatusNone {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	notifyReport(signals)
+	var ticks <-chan time.Time
+	var ticker *time.Ticker
+	if reporter.level == StatusProgress {
+		ticker = time.NewTicker(progressInterval)
+		ticks = ticker.C
+	}
+
+	reporter.stopped.Add(1)
+	go func() {
+		defer reporter.stopped.Done()
+		defer stopReport(signals)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-signals:
+				reporter.write(reporter.stats.Summary(time.Now(), reporter.level != StatusNoXfer))
+			case <-ticks:
+				reporter.progress(reporter.stats.Progress(time.Now()))
+			case <-reporter.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops reporting in background and writes the final summary.
+func (reporter *Reporter) Stop() {
+	if reporter.level == StatusNone {
+		return
+	}
+	close(reporter.done)
+	reporter.stopped.Wait()
+	switch reporter.level {
+	case StatusNoXfer:
+		reporter.write(reporter.stats.Summary(time.Now(), false))
+	case StatusProgress:
+		reporter.write(reporter.stats.Summary(time.Now(), true))
+	}
+}
+
+func (reporter *Reporter) progress(line string) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	padding := ""
+	if len(line) < reporter.progressLen {
+		padding = strings.Repeat(" ", reporter.progressLen-len(line))
+	}
+	_, _ = fmt.Fprint(reporter.writer, "\r"+line+padding)
+	reporter.progressLen = len(line)
+}
+
+func (reporter *Reporter) write(s string) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	if reporter.progressLen > 0 {
+		// the progress line is finished first
+		s = "\n" + s
+		reporter.progressLen = 0
+	}
+	_, _ = fmt.Fprint(reporter.writer, s)
+}
+
+// StatsWriter counts every write as an output block.
+type StatsWriter struct {
+	writer    io.Writer
+	stats     *Stats
+	blockSize int
+}
+
+func (writer *StatsWriter) Write(bs []byte) (int, error) {
+	n, err := writer.writer.Write(bs)
+	writer.stats.AddOut(n, writer.blockSize)
+	return n, err
+}
+
+func NewStatsWriter(writer io.Writer, stats *Stats, blockSize int) *StatsWriter {
+	return &StatsWriter{
+		writer:    writer,
+		stats:     stats,
+		blockSize: blockSize,
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyReport does nothing, there is no SIGUSR1 here.
+func notifyReport(chan<- os.Signal) {}
+
+func stopReport(chan<- os.Signal) {}
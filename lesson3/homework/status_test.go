@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	input := strings.Repeat("0123456789", 250)
+	tests := []struct {
+		name   string
+		args   []string
+		stderr string
+		err    bool
+	}{
+		{name: "by default", stderr: "^$"},
+		{name: "none", args: []string{"-status", "none"}, stderr: "^$"},
+		{
+			name:   "noxfer",
+			args:   []string{"-status", "noxfer", "-ibs", "1000", "-obs", "300"},
+			stderr: "^2\\+1 records in\n8\\+1 records out\n$",
+		},
+		{
+			name:   "progress",
+			args:   []string{"-status", "progress", "-block-size", "500", "-limit", "1200"},
+			stderr: "^2\\+1 records in\n2\\+1 records out\n1200 bytes \\(1\\.2 kB, 1\\.2 KiB\\) copied, [0-9.]+ s, [0-9.]+ [kMG]?B/s\n$",
+		},
+		{
+			name:   "progress with conversions",
+			args:   []string{"-status", "progress", "-block-size", "1000", "-limit", "10", "-conv", "trim_spaces"},
+			stderr: "^0\\+1 records in\n0\\+1 records out\n10 bytes copied, [0-9.]+ s, [0-9.]+ [kMG]?B/s\n$",
+		},
+		{name: "unknown status", args: []string{"-status", "verbose"}, stderr: "unknown status", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd = exec.Command(binPath, test.args...)
+			cmd.Stdin = strings.NewReader(input)
+			stdout := &strings.Builder{}
+			cmd.Stdout = stdout
+			stderr := &strings.Builder{}
+			cmd.Stderr = stderr
+
+			err := cmd.Run()
+
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Regexp(t, regexp.MustCompile(test.stderr), stderr.String())
+		})
+	}
+}
+
+func TestStatsReport(t *testing.T) {
+	start := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	stats := NewStats(start, 10_000_000)
+	for i := 0; i < 3; i++ {
+		stats.AddIn(1<<20, 1<<20)
+	}
+	stats.AddIn(100, 1<<20)
+	stats.AddOut(2<<20, 2<<20)
+	stats.AddOut(1<<20+100, 2<<20)
+	now := start.Add(2 * time.Second)
+
+	assert.Equal(t, "3+1 records in\n1+1 records out\n", stats.Summary(now, false))
+	assert.Equal(t, "3+1 records in\n1+1 records out\n"+
+		"3145828 bytes (3.1 MB, 3.0 MiB) copied, 2.000000 s, 1.6 MB/s\n", stats.Summary(now, true))
+	assert.Equal(t, "3145828 bytes (3.1 MB, 3.0 MiB) copied, 2.000000 s, 1.6 MB/s, ETA 4s", stats.Progress(now))
+
+	unknownSize := NewStats(start, 0)
+	unknownSize.AddIn(10, 100)
+	unknownSize.AddOut(10, 100)
+	assert.Equal(t, "10 bytes copied, 2.000000 s, 5 B/s", unknownSize.Progress(now))
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		n      float64
+		base   float64
+		result string
+	}{
+		{n: 999, base: 1000, result: "999 B"},
+		{n: 1000, base: 1000, result: "1.0 kB"},
+		{n: 1000, base: 1024, result: "1000 B"},
+		{n: 1536, base: 1024, result: "1.5 KiB"},
+		{n: 12_345_678, base: 1000, result: "12 MB"},
+		{n: 5 << 30, base: 1024, result: "5.0 GiB"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.result, humanSize(test.n, test.base))
+	}
+}
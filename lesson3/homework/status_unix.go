@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReport sends SIGUSR1 to signals, like dd reports on it.
+func notifyReport(signals chan<- os.Signal) {
+	signal.Notify(signals, syscall.SIGUSR1)
+}
+
+func stopReport(signals chan<- os.Signal) {
+	signal.Stop(signals)
+}
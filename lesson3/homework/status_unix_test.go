@@ -0,0 +1,89 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusOnSignal(t *testing.T) {
+	binPath := composeBinaryPath()
+	cmd := exec.Command("go", "build", "-o", binPath, "./")
+	assert.NoError(t, cmd.Run())
+	defer func() {
+		assert.NoError(t, os.Remove(binPath))
+	}()
+
+	for _, status := range []string{"", "noxfer"} {
+		t.Run("status "+status, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+			defer cancel()
+			cmd = exec.CommandContext(ctx, binPath, "-status", status, "-block-size", "4")
+			stdin, err := cmd.StdinPipe()
+			assert.NoError(t, err)
+			stdout, err := cmd.StdoutPipe()
+			assert.NoError(t, err)
+			stderr, err := cmd.StderrPipe()
+			assert.NoError(t, err)
+			assert.NoError(t, cmd.Start())
+
+			// once the first block is copied, the signal is handled
+			_, err = io.WriteString(stdin, "abc\n")
+			assert.NoError(t, err)
+			line, err := bufio.NewReader(stdout).ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, "abc\n", line)
+
+			// the block is counted after it is written, so the signal is
+			// sent until a report counts it
+			report := bufio.NewReader(stderr)
+			lines := 3
+			if status == "noxfer" {
+				lines = 2
+			}
+			readReport := func() string {
+				result := &strings.Builder{}
+				for i := 0; i < lines; i++ {
+					line, err := report.ReadString('\n')
+					assert.NoError(t, err)
+					result.WriteString(line)
+				}
+				return result.String()
+			}
+			counted := func(summary string) bool {
+				return strings.HasPrefix(summary, "1+0 records in\n1+0 records out\n") &&
+					(status == "noxfer" || strings.Contains(summary, "\n4 bytes copied, "))
+			}
+			var signalled string
+			for i := 0; i < 100 && !counted(signalled); i++ {
+				if i > 0 {
+					time.Sleep(10 * time.Millisecond)
+				}
+				assert.NoError(t, cmd.Process.Signal(syscall.SIGUSR1))
+				signalled = readReport()
+			}
+			assert.True(t, counted(signalled), signalled)
+
+			assert.NoError(t, stdin.Close())
+			rest, err := io.ReadAll(report)
+			assert.NoError(t, err)
+			assert.NoError(t, cmd.Wait())
+			assert.NoError(t, ctx.Err(), "process timed out")
+			if status == "" {
+				assert.Empty(t, string(rest), "by default there is no report at the end")
+				return
+			}
+			assert.Equal(t, "1+0 records in\n1+0 records out\n", string(rest))
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
+)
+
+// newChain composes the stages picked by the bits of mask, so that the fuzzer
+// tries every combination.
+func newChain(mask uint8) *TransformersComposer {
+	stages := []func() Transformer{
+		func() Transformer { return NewCharsetTransformer(charsets["koi8-r"], utf8Charset{}, InvalidReplace) },
+		func() Transformer { return NewTrimSpacesTransformer() },
+		func() Transformer { return NewUpperCaseTransformer() },
+		func() Transformer { return NewTrimSpacesTransformer() },
+		func() Transformer { return NewLowerCaseTransformer() },
+		func() Transformer { return NewCRLFTransformer() },
+		func() Transformer { return NewNormalizeTransformer(norm.NFD) },
+		func() Transformer { return NewCharsetTransformer(utf8Charset{}, charsets["utf-16le"], InvalidSkip) },
+	}
+	chain := NewTransformersComposer()
+	for i, stage := range stages {
+		if mask&(1<<i) != 0 {
+			chain.AddTransformer(stage())
+		}
+	}
+	return chain
+}
+
+func transformAll(t *testing.T, chain Transformer, chunks ...[]byte) []byte {
+	result := make([]byte, 0)
+	for _, chunk := range chunks {
+		bs, err := chain.Transform(chunk)
+		assert.NoError(t, err)
+		result = append(result, bs...)
+	}
+	bs, err := chain.Flush()
+	assert.NoError(t, err)
+	return append(result, bs...)
+}
+
+func TestTransformersFlush(t *testing.T) {
+	tests := []struct {
+		name   string
+		chain  Transformer
+		input  string
+		output string
+	}{
+		{name: "trailing spaces", chain: NewTrimSpacesTransformer(), input: " \tПривет, мир! \n", output: "Привет, мир!"},
+		{name: "incomplete rune after spaces", chain: NewTrimSpacesTransformer(), input: " a \xd0", output: "a \xd0"},
+		{name: "incomplete rune", chain: NewUpperCaseTransformer(), input: "мир\xd0", output: "МИР\xd0"},
+		{name: "invalid bytes", chain: NewLowerCaseTransformer(), input: "A\xffB\xd0C", output: "a\xffb\xd0c"},
+		{name: "chain", chain: newChain(0b00110), input: "  ab  \xd0", output: "AB  \xd0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := []byte(test.input)
+			chunks := make([][]byte, len(input))
+			for i := range input {
+				chunks[i] = input[i : i+1]
+			}
+			assert.Equal(t, test.output, string(transformAll(t, test.chain, chunks...)))
+		})
+	}
+}
+
+func TestStripANSIHoldsBackEscapes(t *testing.T) {
+	transformer := NewStripANSITransformer()
+	for _, step := range []struct{ input, output string }{
+		{input: "text without lines \x1b[1", output: "text without lines "},
+		{input: ";31mred\x1b", output: "red"},
+		{input: "c", output: ""},
+		{input: "\x1b]0;title\x1b", output: ""},
+		{input: "\\done\x1b]0;", output: "done"},
+	} {
+		result, err := transformer.Transform([]byte(step.input))
+		assert.NoError(t, err)
+		assert.Equal(t, step.output, string(result), "after %q", step.input)
+	}
+	rest, err := transformer.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, "\x1b]0;", string(rest))
+
+	// a title too long for an escape isn't held back
+	long := append([]byte("\x1b]0;"), bytes.Repeat([]byte("t"), maxEscapeSize)...)
+	result, err := NewStripANSITransformer().Transform(long)
+	assert.NoError(t, err)
+	assert.Equal(t, long, result)
+}
+
+func TestLineTooLong(t *testing.T) {
+	transformer := NewDedupeLinesTransformer()
+	_, err := transformer.Transform(bytes.Repeat([]byte("a"), maxLineSize))
+	assert.NoError(t, err)
+	_, err = transformer.Transform([]byte("a"))
+	assert.ErrorIs(t, err, ErrLineTooLong)
+}
+
+func FuzzTransformersComposer(f *testing.F) {
+	f.Add([]byte("  Привет, мир!  "), uint8(0b000110), uint8(1))
+	f.Add([]byte("\xf0\xd2\xc9\xd7\xc5\xd4 \xcd\xc9\xd2"), uint8(0b10000111), uint8(3))
+	f.Add([]byte(" a\xffb\xd0 "), uint8(0b011010), uint8(2))
+	f.Add([]byte("😊 \t😊\n"), uint8(0b11111110), uint8(5))
+	f.Add([]byte("e\u0301\r\n\r\u0435\u0308\r"), uint8(0b01100000), uint8(1))
+
+	f.Fuzz(func(t *testing.T, input []byte, mask uint8, blockSize uint8) {
+		if blockSize == 0 {
+			return
+		}
+		expected := transformAll(t, newChain(mask), input)
+
+		chunks := make([][]byte, 0)
+		for rest := input; len(rest) > 0; {
+			size := int(blockSize)
+			if size > len(rest) {
+				size = len(rest)
+			}
+			chunks = append(chunks, rest[:size])
+			rest = rest[size:]
+		}
+		assert.Equal(t, expected, transformAll(t, newChain(mask), chunks...))
+	})
+}
+
+// TestTransformersState checks that transformers restored from a state saved
+// in the middle of the input go on like the ones that saved it.
+func TestTransformersState(t *testing.T) {
+	input := []byte("  é\r\n\r\n\r\n\ta\r\tb\n\x1b[1mПривет\x1b[0m, мир!\nмир!\nмир!\n \xd0")
+	chains := make(map[string]func() Transformer)
+	for mask := 0; mask < 256; mask++ {
+		mask := uint8(mask)
+		chains["chain "+strconv.Itoa(int(mask))] = func() Transformer { return newChain(mask) }
+	}
+	for name, arg := range map[string]string{"dedupe_lines": "", "strip_ansi": "", "replace": "/и/i/", "tabs_to_spaces": "4"} {
+		name, arg := name, arg
+		chains[name] = func() Transformer {
+			transformer, err := conversions[name](arg)
+			assert.NoError(t, err)
+			return transformer
+		}
+	}
+
+	for name, newTransformer := range chains {
+		t.Run(name, func(t *testing.T) {
+			expected := transformAll(t, newTransformer(), input)
+			for i := range input {
+				transformer := newTransformer()
+				result, err := transformer.Transform(input[:i])
+				assert.NoError(t, err)
+				state, err := transformer.SaveState()
+				assert.NoError(t, err)
+
+				resumed := newTransformer()
+				assert.NoError(t, resumed.LoadState(state))
+				result = append(result, transformAll(t, resumed, input[i:])...)
+				assert.Equal(t, expected, result, "state after %d bytes: %s", i, state)
+			}
+		})
+	}
+}